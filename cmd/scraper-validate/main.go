@@ -0,0 +1,129 @@
+// Command scraper-validate checks scraper definitions: that they are complete, that their
+// selectors and patterns compile, and that they extract results from a saved search page.
+//
+//	scraper-validate scrapers/                 validate every definition and its fixture
+//	scraper-validate -search "big buck bunny" scrapers/example.yaml
+//
+// A definition's fixture is a saved search results page next to it with the same name and
+// an .html extension (scrapers/example.html for scrapers/example.yaml). Every row it yields
+// must have a title and magnet link, and there must be at least -min-results of them.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"torrent-play/services"
+)
+
+func main() {
+	search := flag.String("search", "", "Also search each base URL live for this query")
+	minResults := flag.Int("min-results", 1, "Minimum results a fixture or live search must yield")
+	verbose := flag.Bool("v", false, "Print the extracted results")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] definition.yaml|dir...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, arg := range flag.Args() {
+		for _, path := range definitionFiles(arg) {
+			if err := validate(path, *search, *minResults, *verbose); err != nil {
+				fmt.Printf("FAIL %s\n%s\n", path, indent(err.Error()))
+				failed = true
+				continue
+			}
+			fmt.Printf("ok   %s\n", path)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// definitionFiles lists the definitions at path, a file or a directory.
+func definitionFiles(path string) []string {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return []string{path} // Let validate report the error
+	}
+	var paths []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, _ := filepath.Glob(filepath.Join(path, pattern))
+		paths = append(paths, matches...)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func validate(path, query string, minResults int, verbose bool) error {
+	def, err := services.LoadScraperDefinition(path)
+	if err != nil {
+		return err
+	}
+	var errs []error
+
+	fixture := strings.TrimSuffix(path, filepath.Ext(path)) + ".html"
+	if f, err := os.Open(fixture); err == nil {
+		results, err := services.NewDefinitionScraper(def, def.BaseURLs[0]).ParseResults(f)
+		f.Close()
+		if err == nil {
+			err = checkResults(results, minResults, verbose)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("fixture %s: %w", fixture, err))
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		errs = append(errs, err)
+	} else {
+		fmt.Printf("     %s: no fixture at %s\n", def.Name, fixture)
+	}
+
+	if query != "" {
+		for _, baseURL := range def.BaseURLs {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			results, err := services.NewDefinitionScraper(def, baseURL).SearchTorrents(ctx, query, 0, services.SortBySeeders)
+			cancel()
+			if err == nil {
+				err = checkResults(results, minResults, verbose)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("search %s: %w", baseURL, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkResults checks that there are enough results, printing them if verbose.
+func checkResults(results []services.TorrentSearchResult, minResults int, verbose bool) error {
+	if verbose {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "     TITLE\tSIZE\tSEEDERS\tLEECHERS\tUPLOADED\tINFOHASH")
+		for _, r := range results {
+			fmt.Fprintf(w, "     %s\t%d\t%d\t%d\t%s\t%s\n", r.Title, r.Size, r.Seeders, r.Leechers, r.UploadDate, r.InfoHash)
+		}
+		w.Flush()
+	}
+	if len(results) < minResults {
+		return fmt.Errorf("got %d results, want at least %d", len(results), minResults)
+	}
+	return nil
+}
+
+func indent(s string) string {
+	return "     " + strings.ReplaceAll(s, "\n", "\n     ")
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"torrent-play/services"
+)
+
+// maxPlayAlternatives bounds the alternatives returned alongside the chosen torrent.
+const maxPlayAlternatives = 5
+
+// PlayHandler resolves a title to the best torrent and starts streaming it.
+type PlayHandler struct {
+	Resolver   *services.PlayResolver
+	HlsService *services.HlsService
+	ListenAddr string
+}
+
+// NewPlayHandler creates and returns a new PlayHandler.
+func NewPlayHandler(resolver *services.PlayResolver, hlsService *services.HlsService, listenAddr string) *PlayHandler {
+	return &PlayHandler{
+		Resolver:   resolver,
+		HlsService: hlsService,
+		ListenAddr: listenAddr,
+	}
+}
+
+// playResponse describes the started stream, the torrent chosen for it and the runners-up.
+type playResponse struct {
+	Title        *services.SearchResult   `json:"title"`
+	Chosen       services.PlayCandidate   `json:"chosen"`
+	Alternatives []services.PlayCandidate `json:"alternatives"`
+	StreamID     string                   `json:"streamId"`
+	Status       string                   `json:"status"`
+	HlsURL       string                   `json:"hlsUrl"`
+	DashURL      string                   `json:"dashUrl,omitempty"`
+}
+
+// PlayHandler handles POST requests to /play?imdbId=<id>&season=<n>&episode=<n>. The stream
+// options of /add (profile, audio, burn, fast) are accepted too.
+func (h *PlayHandler) PlayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed. Only POST is supported.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	imdbID := params.Get("imdbId")
+	if imdbID == "" {
+		http.Error(w, "Missing 'imdbId' query parameter", http.StatusBadRequest)
+		return
+	}
+	season, err := optionalInt(params.Get("season"))
+	if err != nil {
+		http.Error(w, "Invalid 'season' query parameter", http.StatusBadRequest)
+		return
+	}
+	episode, err := optionalInt(params.Get("episode"))
+	if err != nil || (episode > 0 && season == 0) {
+		http.Error(w, "Invalid 'episode' query parameter; it requires 'season'", http.StatusBadRequest)
+		return
+	}
+	profile := params.Get("profile")
+	if _, ok := services.LookupTranscodeProfile(profile); !ok {
+		http.Error(w, fmt.Sprintf("Unknown profile %q", profile), http.StatusBadRequest)
+		return
+	}
+
+	title, candidates, err := h.Resolver.Resolve(r.Context(), imdbID, season, episode)
+	switch {
+	case errors.Is(err, services.ErrTitleNotFound):
+		http.Error(w, "Title not found", http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrNoSuitableTorrent):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error resolving %s for playback: %v", imdbID, err)
+		if writeUpstreamError(w, err, "Search provider") {
+			return
+		}
+		http.Error(w, "Failed to find a torrent for this title.", http.StatusInternalServerError)
+		return
+	}
+
+	chosen := candidates[0]
+	log.Printf("Playing %s (%s) from %s", title.Title, imdbID, chosen.Title)
+	opts := services.StreamOptions{
+		Audio:        params.Get("audio"),
+		BurnSubtitle: params.Get("burn"),
+		Profile:      profile,
+		FastStart:    parseBool(params.Get("fast")),
+	}
+	streamInfo, err := h.HlsService.PrepareStream(r.Context(), chosen.MagnetURL, opts)
+	if err != nil {
+		log.Printf("Error preparing stream: %v", err)
+		http.Error(w, fmt.Sprintf("Error preparing stream: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	alternatives := candidates[1:]
+	if len(alternatives) > maxPlayAlternatives {
+		alternatives = alternatives[:maxPlayAlternatives]
+	}
+	resp := playResponse{
+		Title:        title,
+		Chosen:       chosen,
+		Alternatives: alternatives,
+		StreamID:     streamInfo.ID,
+		Status:       string(streamInfo.State),
+		HlsURL:       fmt.Sprintf("http://%s/hls/%s/master.m3u8", h.ListenAddr, streamInfo.ID),
+	}
+	if opts.SupportsDASH() {
+		resp.DashURL = fmt.Sprintf("http://%s/dash/%s/manifest.mpd", h.ListenAddr, streamInfo.ID)
+	}
+	writeJSON(w, resp)
+}
+
+// optionalInt parses a non-negative integer query parameter; empty means 0.
+func optionalInt(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number %q", v)
+	}
+	return n, nil
+}
@@ -2,8 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 	"torrent-play/services" // Adjust import path if needed
 )
 
@@ -26,36 +31,94 @@ func NewSearchHandler(imdbService services.ImdbSearcher) *SearchHandler {
 	}
 }
 
-// SearchMoviesHandler handles GET requests to /search?q=<query>.
-// It fetches movie/show details based on the query parameter using the ImdbService.
+// Search years before the first films or well past the current year can't match anything.
+const (
+	minSearchYear      = 1870
+	maxSearchYearAhead = 10 // Announced titles can be dated a few years ahead
+)
+
+// parseSearchYear parses a four-digit year within the range titles are searched in.
+func parseSearchYear(v string, currentYear int) (int, bool) {
+	if len(v) != 4 {
+		return 0, false
+	}
+	for _, c := range v {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	year, _ := strconv.Atoi(v)
+	if year < minSearchYear || year > currentYear+maxSearchYearAhead {
+		return 0, false
+	}
+	return year, true
+}
+
+// SearchMoviesHandler handles GET requests to /search?q=<query>&page=<n>&type=<type>&year=<yyyy>.
+// page is 1-indexed, type is one of movie, series or episode, and year restricts results to titles
+// released that year. It fetches one page of matching titles using the ImdbService.
 func (h *SearchHandler) SearchMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed. Only GET is supported.", http.StatusMethodNotAllowed)
 		return
 	}
 
-	query := r.URL.Query().Get("q")
-	if query == "" {
+	params := r.URL.Query()
+	query := services.SearchQuery{Query: strings.TrimSpace(params.Get("q")), Page: 1}
+	if query.Query == "" {
 		http.Error(w, "Missing 'q' query parameter", http.StatusBadRequest)
 		return
 	}
+	if v := params.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid 'page' query parameter; expected a positive integer", http.StatusBadRequest)
+			return
+		}
+		query.Page = n
+	}
+	titleType, err := services.ParseTitleType(params.Get("type"))
+	if err != nil {
+		types := make([]string, len(services.TitleTypes))
+		for i, t := range services.TitleTypes {
+			types[i] = string(t)
+		}
+		http.Error(w, fmt.Sprintf("Invalid 'type' query parameter. Available types: %s", strings.Join(types, ", ")), http.StatusBadRequest)
+		return
+	}
+	query.Type = titleType
+	if v := params.Get("year"); v != "" {
+		year, ok := parseSearchYear(v, time.Now().Year())
+		if !ok {
+			http.Error(w, fmt.Sprintf("Invalid 'year' query parameter; expected a four-digit year from %d to %d", minSearchYear, time.Now().Year()+maxSearchYearAhead), http.StatusBadRequest)
+			return
+		}
+		query.Year = year
+	}
 
-	log.Printf("Received search query: %s", query)
+	log.Printf("Received search query: %s (page %d, type %q, year %d)", query.Query, query.Page, query.Type, query.Year)
 
-	results, err := h.ImdbService.Search(r.Context(), query) // Pass request context
+	page, err := h.ImdbService.Search(r.Context(), query) // Pass request context
+	if errors.Is(err, services.ErrUnsupportedQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		log.Printf("Error searching IMDB via service: %v", err)
+		if writeUpstreamError(w, err, "Title search provider") {
+			return
+		}
 		http.Error(w, "Failed to fetch search results from IMDB.", http.StatusInternalServerError)
 		return
 	}
 
 	// Ensure that a nil slice is encoded as an empty JSON array "[]" rather than "null"
-	if results == nil {
-		results = []services.SearchResult{}
+	if page.Results == nil {
+		page.Results = []services.SearchResult{}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(results); err != nil {
+	if err := json.NewEncoder(w).Encode(page); err != nil {
 		log.Printf("Error encoding search results to JSON: %v", err)
 		// The header might have already been sent, so we can only log this server-side error.
 	}
@@ -0,0 +1,30 @@
+package handlers
+
+import "testing"
+
+func TestParseSearchYear(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"1994", 1994, true},
+		{"1870", 1870, true},
+		{"2036", 2036, true},
+		{"2037", 0, false},
+		{"1869", 0, false},
+		{"0000", 0, false},
+		{"-123", 0, false},
+		{"+123", 0, false},
+		{"199", 0, false},
+		{"19945", 0, false},
+		{"19a4", 0, false},
+		{" 994", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseSearchYear(tt.in, 2026)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseSearchYear(%q) = %d, %v, want %d, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"torrent-play/services"
+)
+
+// StatusHandler reports the state of running streams, aggregate stream metrics and, when
+// caching is enabled, cache statistics.
+type StatusHandler struct {
+	HlsService *services.HlsService
+	ListenAddr string
+	Caches     []services.CacheReporter
+	Network    services.NetworkSettings
+}
+
+// NewStatusHandler creates and returns a new StatusHandler.
+func NewStatusHandler(hlsService *services.HlsService, listenAddr string) *StatusHandler {
+	return &StatusHandler{
+		HlsService: hlsService,
+		ListenAddr: listenAddr,
+	}
+}
+
+// streamStatusResponse adds playback URLs to a stream's status.
+type streamStatusResponse struct {
+	services.StreamStatus
+	HlsURL        string `json:"hlsUrl"`
+	DashURL       string `json:"dashUrl,omitempty"`
+	ThumbnailsURL string `json:"thumbnailsUrl,omitempty"`
+	PosterURL     string `json:"posterUrl,omitempty"`
+}
+
+func (h *StatusHandler) withURLs(st services.StreamStatus) streamStatusResponse {
+	resp := streamStatusResponse{
+		StreamStatus: st,
+		HlsURL:       fmt.Sprintf("http://%s/hls/%s/master.m3u8", h.ListenAddr, st.ID),
+	}
+	if st.DASH {
+		resp.DashURL = fmt.Sprintf("http://%s/dash/%s/manifest.mpd", h.ListenAddr, st.ID)
+	}
+	if st.Thumbnails {
+		resp.ThumbnailsURL = fmt.Sprintf("http://%s/hls/%s/thumbs/thumbs.vtt", h.ListenAddr, st.ID)
+	}
+	if st.Poster {
+		resp.PosterURL = fmt.Sprintf("http://%s/streams/%s/poster", h.ListenAddr, st.ID)
+	}
+	return resp
+}
+
+// StreamsHandler handles GET requests to /streams (all streams, newest first),
+// /streams/{id} (a single stream) and /streams/{id}/poster (the stream's poster frame).
+// A stream's "playable" field turns true as soon as its first segment is written.
+func (h *StatusHandler) StreamsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed. Only GET is supported.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/streams"), "/")
+	if id, ok := strings.CutSuffix(streamID, "/poster"); ok {
+		h.servePoster(w, r, id)
+		return
+	}
+	if streamID == "" {
+		statuses := h.HlsService.ListStreamStatuses()
+		resp := make([]streamStatusResponse, len(statuses))
+		for i, st := range statuses {
+			resp[i] = h.withURLs(st)
+		}
+		writeJSON(w, resp)
+		return
+	}
+
+	st, ok := h.HlsService.StreamStatus(streamID)
+	if !ok {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, h.withURLs(st))
+}
+
+func (h *StatusHandler) servePoster(w http.ResponseWriter, r *http.Request, streamID string) {
+	posterPath, err := h.HlsService.PosterPath(streamID)
+	if errors.Is(err, services.ErrStreamNotFound) {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Poster not available yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	http.ServeFile(w, r, posterPath)
+}
+
+// MetricsHandler handles GET requests to /status, returning aggregate stream timings
+// such as the time to first segment, and cache hit/miss counts under "caches".
+func (h *StatusHandler) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed. Only GET is supported.", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := statusResponse{StreamMetrics: h.HlsService.Metrics()}
+	for _, c := range h.Caches {
+		if resp.Caches == nil {
+			resp.Caches = map[string]services.CacheStats{}
+		}
+		for name, stats := range c.CacheStats() {
+			resp.Caches[name] = stats
+		}
+	}
+	writeJSON(w, resp)
+}
+
+// NetworkHandler handles GET requests to /status/network, returning the effective proxy,
+// which traffic goes through it, and the outbound rate limits.
+func (h *StatusHandler) NetworkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed. Only GET is supported.", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, h.Network)
+}
+
+// statusResponse adds cache statistics to the stream metrics.
+type statusResponse struct {
+	services.StreamMetrics
+	Caches map[string]services.CacheStats `json:"caches,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response to JSON: %v", err)
+	}
+}
+
+// upstreamErrorResponse is the body of 429 and 503 responses caused by a provider.
+type upstreamErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"` // "quota_exceeded" or "upstream_unavailable"
+}
+
+// writeUpstreamError answers with 429 Too Many Requests when the named provider's quota is
+// exceeded and 503 Service Unavailable when it is down or blocks us, with a JSON error code. It reports
+// false, writing nothing, for other errors.
+func writeUpstreamError(w http.ResponseWriter, err error, provider string) bool {
+	code := services.UpstreamErrorCode(err)
+	status, message := http.StatusServiceUnavailable, provider+" is unavailable; try again later."
+	switch code {
+	case "":
+		return false
+	case "quota_exceeded":
+		status, message = http.StatusTooManyRequests, provider+" quota exceeded; try again later."
+	case "blocked":
+		message = provider + " blocked the request with a captcha or block page."
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(upstreamErrorResponse{Error: message, Code: code}); err != nil {
+		log.Printf("Error encoding response to JSON: %v", err)
+	}
+	return true
+}
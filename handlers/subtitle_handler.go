@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"torrent-play/services"
+)
+
+// SubtitleHandler handles searching external subtitle providers and attaching
+// downloaded subtitles to running streams.
+type SubtitleHandler struct {
+	Provider   services.SubtitleProvider
+	HlsService *services.HlsService
+}
+
+// NewSubtitleHandler creates and returns a new SubtitleHandler.
+func NewSubtitleHandler(provider services.SubtitleProvider, hlsService *services.HlsService) *SubtitleHandler {
+	if provider == nil {
+		log.Println("Warning: SubtitleProvider is nil during SubtitleHandler creation")
+	}
+	return &SubtitleHandler{
+		Provider:   provider,
+		HlsService: hlsService,
+	}
+}
+
+// SearchSubtitlesHandler handles GET requests to
+// /subtitles/search?imdbId=<id>&hash=<hash>&q=<name>&lang=<codes>&streamId=<id>.
+// When streamId is given without a hash, the hash of the stream's file is used.
+func (h *SubtitleHandler) SearchSubtitlesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed. Only GET is supported.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	query := services.SubtitleQuery{
+		ImdbID:   params.Get("imdbId"),
+		FileHash: params.Get("hash"),
+		Query:    params.Get("q"),
+	}
+	if lang := params.Get("lang"); lang != "" {
+		query.Languages = strings.Split(lang, ",")
+	}
+
+	if streamID := params.Get("streamId"); streamID != "" && query.FileHash == "" {
+		hash, err := h.HlsService.StreamFileHash(r.Context(), streamID)
+		if errors.Is(err, services.ErrStreamNotFound) {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			// Not fatal: the search can still match by IMDb ID or name.
+			log.Printf("[%s] Could not hash stream file for subtitle search: %v", streamID, err)
+		}
+		query.FileHash = hash
+	}
+
+	if query.ImdbID == "" && query.FileHash == "" && query.Query == "" {
+		http.Error(w, "One of 'imdbId', 'hash', 'q' or 'streamId' query parameters is required", http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.Provider.SearchSubtitles(r.Context(), query)
+	if err != nil {
+		log.Printf("Error searching subtitles: %v", err)
+		if writeUpstreamError(w, err, "Subtitle provider") {
+			return
+		}
+		http.Error(w, "Failed to fetch subtitle search results.", http.StatusInternalServerError)
+		return
+	}
+	if results == nil {
+		results = []services.SubtitleSearchResult{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		log.Printf("Error encoding subtitle results to JSON: %v", err)
+	}
+}
+
+// AttachSubtitleHandler handles POST requests to /subtitles/attach?streamId=<id>&fileId=<id>&lang=<code>.
+// It downloads the subtitle from the provider and adds it to the stream as a WebVTT rendition.
+func (h *SubtitleHandler) AttachSubtitleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed. Only POST is supported.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	streamID := params.Get("streamId")
+	fileID := params.Get("fileId")
+	if streamID == "" || fileID == "" {
+		http.Error(w, "Missing 'streamId' or 'fileId' query parameter", http.StatusBadRequest)
+		return
+	}
+	if _, ok := h.HlsService.GetStreamInfo(streamID); !ok {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+
+	data, fileName, err := h.Provider.DownloadSubtitle(r.Context(), fileID)
+	if err != nil {
+		log.Printf("Error downloading subtitle %s: %v", fileID, err)
+		if writeUpstreamError(w, err, "Subtitle provider") {
+			return
+		}
+		http.Error(w, "Failed to download subtitle.", http.StatusBadGateway)
+		return
+	}
+
+	track, err := h.HlsService.AttachSubtitle(streamID, data, fileName, params.Get("lang"))
+	if errors.Is(err, services.ErrStreamNotFound) {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[%s] Error attaching subtitle %s: %v", streamID, fileID, err)
+		http.Error(w, fmt.Sprintf("Error attaching subtitle: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(track); err != nil {
+		log.Printf("Error encoding subtitle track to JSON: %v", err)
+	}
+}
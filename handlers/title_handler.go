@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"torrent-play/services"
+)
+
+// imdbIDPattern matches IMDb title IDs such as "tt0111161".
+var imdbIDPattern = regexp.MustCompile(`^tt\d{7,}$`)
+
+// TitleHandler serves title details for a detail page shown before streaming.
+type TitleHandler struct {
+	ImdbService services.ImdbSearcher
+}
+
+// NewTitleHandler creates and returns a new TitleHandler.
+func NewTitleHandler(imdbService services.ImdbSearcher) *TitleHandler {
+	return &TitleHandler{ImdbService: imdbService}
+}
+
+// TitlesHandler handles GET requests to /titles/{imdbId} and /titles/{imdbId}/seasons/{n}.
+func (h *TitleHandler) TitlesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed. Only GET is supported.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/titles"), "/"), "/")
+	imdbID := parts[0]
+	if !imdbIDPattern.MatchString(imdbID) {
+		http.Error(w, "Invalid IMDb ID; expected e.g. tt0111161", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		details, err := h.ImdbService.Details(r.Context(), imdbID)
+		if err != nil {
+			writeTitleError(w, imdbID, err)
+			return
+		}
+		writeJSON(w, details)
+	case len(parts) == 3 && parts[1] == "seasons":
+		season, err := strconv.Atoi(parts[2])
+		if err != nil || season < 1 {
+			http.Error(w, "Invalid season number", http.StatusBadRequest)
+			return
+		}
+		details, err := h.ImdbService.Season(r.Context(), imdbID, season)
+		if err != nil {
+			writeTitleError(w, imdbID, err)
+			return
+		}
+		writeJSON(w, details)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeTitleError(w http.ResponseWriter, imdbID string, err error) {
+	if errors.Is(err, services.ErrTitleNotFound) {
+		http.Error(w, "Title not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Error fetching title %s: %v", imdbID, err)
+	if writeUpstreamError(w, err, "Title details provider") {
+		return
+	}
+	http.Error(w, "Failed to fetch title details.", http.StatusInternalServerError)
+}
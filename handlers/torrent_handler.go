@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"torrent-play/services" // Adjust import path if needed
 )
 
@@ -25,24 +26,49 @@ func (h *TorrentHandler) AddTorrentHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	profile := r.URL.Query().Get("profile") // Optional transcode profile, e.g. "hevc"
+	if _, ok := services.LookupTranscodeProfile(profile); !ok {
+		http.Error(w, fmt.Sprintf("Unknown profile %q. Available profiles: %s", profile, strings.Join(services.TranscodeProfileNames(), ", ")), http.StatusBadRequest)
+		return
+	}
+
+	opts := services.StreamOptions{
+		Audio:        r.URL.Query().Get("audio"), // Optional default audio language, e.g. "eng"
+		BurnSubtitle: r.URL.Query().Get("burn"),  // Optional subtitle to burn in, by language or stream index
+		Profile:      profile,
+		FastStart:    parseBool(r.URL.Query().Get("fast")), // Short first segments so playback starts sooner
+	}
+
 	log.Printf("Received request to add magnet: %s", magnetURI)
 
-	streamInfo, err := h.HlsService.PrepareStream(r.Context(), magnetURI)
+	streamInfo, err := h.HlsService.PrepareStream(r.Context(), magnetURI, opts)
 	if err != nil {
 		log.Printf("Error preparing stream: %v", err)
 		http.Error(w, fmt.Sprintf("Error preparing stream: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	hlsURL := fmt.Sprintf("http://%s/hls/%s/playlist.m3u8", h.ListenAddr, streamInfo.ID)
+	hlsURL := fmt.Sprintf("http://%s/hls/%s/master.m3u8", h.ListenAddr, streamInfo.ID)
 	log.Printf("Stream %s prepared. HLS URL: %s", streamInfo.ID, hlsURL)
 
-	// Respond with the stream info (including the HLS URL)
+	// Respond with the stream info (including the HLS URL, and the DASH URL when the stream has one)
 	w.Header().Set("Content-Type", "application/json")
 	response := map[string]string{
 		"streamId": streamInfo.ID,
 		"hlsUrl":   hlsURL,
 		"status":   string(streamInfo.State),
 	}
+	if streamInfo.Options.SupportsDASH() {
+		response["dashUrl"] = fmt.Sprintf("http://%s/dash/%s/manifest.mpd", h.ListenAddr, streamInfo.ID)
+	}
 	json.NewEncoder(w).Encode(response)
 }
+
+// parseBool reports whether a query flag such as "fast" is switched on.
+func parseBool(v string) bool {
+	switch strings.ToLower(v) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"torrent-play/services"
+)
+
+// TorrentSearchHandler handles requests for searching torrents.
+type TorrentSearchHandler struct {
+	Searcher services.TorrentSearcher
+}
+
+// NewTorrentSearchHandler creates and returns a new TorrentSearchHandler.
+func NewTorrentSearchHandler(searcher services.TorrentSearcher) *TorrentSearchHandler {
+	if searcher == nil {
+		log.Println("Warning: TorrentSearcher is nil during TorrentSearchHandler creation")
+	}
+	return &TorrentSearchHandler{
+		Searcher: searcher,
+	}
+}
+
+// torrentSearchResponse carries the results of every provider that answered, plus the
+// errors of those that didn't.
+type torrentSearchResponse struct {
+	Results []services.TorrentSearchResult `json:"results"`
+	Errors  []services.ProviderError       `json:"errors"`
+}
+
+// SearchTorrentsHandler handles GET requests to /torrents/search?q=<query>&page=<n>&orderBy=<order>.
+// page is 0-indexed and orderBy is one of seeders (default), size or date. Results from the
+// providers that answered are returned even when others failed; the failures are listed in "errors".
+func (h *TorrentSearchHandler) SearchTorrentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed. Only GET is supported.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	query := strings.TrimSpace(params.Get("q"))
+	if query == "" {
+		http.Error(w, "Missing 'q' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	page := 0
+	if v := params.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid 'page' query parameter; expected a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		page = n
+	}
+
+	orderBy, err := services.ParseTorrentSortOrder(params.Get("orderBy"))
+	if err != nil {
+		orders := make([]string, len(services.TorrentSortOrders))
+		for i, o := range services.TorrentSortOrders {
+			orders[i] = string(o)
+		}
+		http.Error(w, fmt.Sprintf("Invalid 'orderBy' query parameter. Available orders: %s", strings.Join(orders, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Received torrent search query: %s (page %d, order %s)", query, page, orderBy)
+
+	results, err := h.Searcher.SearchTorrents(r.Context(), query, page, orderBy)
+	resp := torrentSearchResponse{Results: results, Errors: []services.ProviderError{}}
+	var partial *services.PartialSearchError
+	switch {
+	case errors.As(err, &partial):
+		resp.Errors = partial.Failures
+	case err != nil:
+		log.Printf("Error searching torrents: %v", err)
+		if writeUpstreamError(w, err, "Torrent search") {
+			return
+		}
+		http.Error(w, "Failed to fetch torrent search results.", http.StatusInternalServerError)
+		return
+	}
+	if resp.Results == nil {
+		resp.Results = []services.TorrentSearchResult{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding torrent search results to JSON: %v", err)
+	}
+}
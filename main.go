@@ -1,16 +1,21 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"torrent-play/config"   // Adjust import path
 	"torrent-play/handlers" // Adjust import path
 	"torrent-play/services" // Adjust import path
+	"torrent-play/web"
 
 	"github.com/anacrolix/torrent"
 )
@@ -21,18 +26,179 @@ func usage() {
 	os.Exit(2)
 }
 
+// newTorrentSearcher aggregates every configured torrent search provider. Their requests go
+// through transport.
+func newTorrentSearcher(cfg *config.AppConfig, transport http.RoundTripper) (services.TorrentSearcher, error) {
+	profile, err := scraperProfile(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var providers []services.TorrentProvider
+	for _, kind := range cfg.TorrentSearchProviders {
+		switch kind {
+		case "html":
+			baseURLs := cfg.TorrentSearchBaseURLs
+			if len(baseURLs) == 0 {
+				baseURLs = []string{services.DefaultBaseURLForTorrentSearch}
+			}
+			for _, baseURL := range baseURLs {
+				searcher := services.NewConcreteTorrentSearchService(baseURL)
+				searcher.Client.Transport = transport
+				if err := searcher.UseProfile(profile); err != nil {
+					return nil, err
+				}
+				providers = append(providers, services.TorrentProvider{
+					Name:     hostName(baseURL),
+					Searcher: searcher,
+					Timeout:  cfg.TorrentProviderTimeout,
+				})
+			}
+		case "torznab":
+			if cfg.TorznabURL == "" {
+				return nil, fmt.Errorf("torznab provider selected but TORZNAB_URL is not set")
+			}
+			searcher := services.NewTorznabService(cfg.TorznabURL, cfg.TorznabAPIKey)
+			searcher.Client.Transport = transport
+			providers = append(providers, services.TorrentProvider{
+				Name:     "torznab:" + hostName(cfg.TorznabURL),
+				Searcher: searcher,
+				Timeout:  cfg.TorrentProviderTimeout,
+			})
+		case "scrapers":
+			if cfg.ScraperDefinitions == "" {
+				return nil, fmt.Errorf("scrapers provider selected but SCRAPER_DEFINITIONS is not set")
+			}
+			defs, err := services.LoadScraperDefinitions(cfg.ScraperDefinitions)
+			if err != nil {
+				return nil, err
+			}
+			for _, def := range defs {
+				for _, baseURL := range def.BaseURLs {
+					searcher := services.NewDefinitionScraper(def, baseURL)
+					searcher.Client.Transport = transport
+					if def.Profile == "" {
+						if err := searcher.UseProfile(profile); err != nil {
+							return nil, err
+						}
+					}
+					providers = append(providers, services.TorrentProvider{
+						Name:     def.Name + ":" + hostName(baseURL),
+						Searcher: searcher,
+						Timeout:  cfg.TorrentProviderTimeout,
+					})
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown torrent search provider %q (expected html, torznab or scrapers)", kind)
+		}
+	}
+	return services.NewTorrentSearchAggregator(providers...), nil
+}
+
+// scraperProfile returns the browser profile configured for the HTML torrent sites.
+func scraperProfile(cfg *config.AppConfig) (services.ScraperProfile, error) {
+	if cfg.ScraperProfileFile != "" {
+		return services.LoadScraperProfile(cfg.ScraperProfileFile)
+	}
+	profile, ok := services.LookupScraperProfile(cfg.ScraperProfile)
+	if !ok {
+		return profile, fmt.Errorf("unknown SCRAPER_PROFILE %q (available: %s)", cfg.ScraperProfile, strings.Join(services.ScraperProfileNames(), ", "))
+	}
+	return profile, nil
+}
+
+// newTitleSearcher creates the configured title metadata provider, sending its requests
+// through transport.
+func newTitleSearcher(cfg *config.AppConfig, transport http.RoundTripper) (services.ImdbSearcher, error) {
+	switch cfg.MetadataProvider {
+	case "omdb":
+		searcher := services.NewConcreteImdbService(cfg.ImdbAPIKey)
+		searcher.Client.Transport = transport
+		return searcher, nil
+	case "tmdb":
+		if cfg.TMDBAPIKey == "" {
+			return nil, fmt.Errorf("tmdb metadata provider selected but TMDB_API_KEY is not set")
+		}
+		searcher := services.NewTMDBService(cfg.TMDBAPIKey)
+		searcher.Client.Transport = transport
+		return searcher, nil
+	}
+	return nil, fmt.Errorf("unknown metadata provider %q (expected omdb or tmdb)", cfg.MetadataProvider)
+}
+
+// playPreferences returns the policy /play picks torrents by.
+func playPreferences(cfg *config.AppConfig) services.PlayPreferences {
+	return services.PlayPreferences{
+		Resolutions: cfg.PlayResolutions,
+		MinSeeders:  cfg.PlayMinSeeders,
+		MaxSize:     cfg.PlayMaxSize,
+	}
+}
+
+// outboundLimits returns the rate limits and retries for provider requests.
+func outboundLimits(cfg *config.AppConfig) services.OutboundLimits {
+	limits := services.DefaultOutboundLimits
+	limits.Rate = cfg.OutboundRate
+	limits.Burst = cfg.OutboundBurst
+	limits.HostRates = cfg.OutboundHostRates
+	limits.MaxRetries = cfg.OutboundMaxRetries
+	return limits
+}
+
+// hostName returns the host of a URL, for naming providers; unparsable URLs are used as-is.
+func hostName(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
 func main() {
 	flag.Usage = usage
-	appConfig := config.LoadConfig()
+	appConfig, err := config.LoadConfig()
+	if appConfig.PrintConfig {
+		if err := appConfig.WriteYAML(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if appConfig.ConfigFile != "" {
+		log.Printf("Loaded configuration from %s", appConfig.ConfigFile)
+	}
+	services.FFmpegPath = appConfig.FFmpegPath
+	services.FFprobePath = appConfig.FFprobePath
 
 	// Ensure data directory exists
 	if err := os.MkdirAll(appConfig.DataDir, 0750); err != nil {
 		log.Fatalf("Error creating data directory %s: %v", appConfig.DataDir, err)
 	}
 
+	// Outbound proxy for providers and the torrent client's HTTP traffic
+	proxyURL, err := services.ParseProxyURL(appConfig.ProxyURL)
+	if err != nil {
+		log.Fatalf("Error in PROXY_URL: %v", err)
+	}
+	proxyTransport, err := services.NewProxyTransport(proxyURL)
+	if err != nil {
+		log.Fatalf("Error configuring proxy: %v", err)
+	}
+
 	// Create a single torrent client
 	clientConfig := torrent.NewDefaultClientConfig()
 	clientConfig.DataDir = appConfig.DataDir
+	if err := services.ApplyProxy(clientConfig, proxyURL); err != nil {
+		log.Fatalf("Error configuring proxy for the torrent client: %v", err)
+	}
+	if proxyURL != nil {
+		log.Printf("Routing provider and HTTP tracker traffic through %s", proxyURL.Redacted())
+	}
 	// clientConfig.Debug = true // Enable for more verbose logging
 	client, err := torrent.NewClient(clientConfig)
 	if err != nil {
@@ -42,21 +208,84 @@ func main() {
 	log.Println("Torrent client started.")
 
 	// Create HLS service
-	hlsService, err := services.NewHlsService(client, appConfig.ListenAddr)
+	hlsService, err := services.NewHlsService(client, appConfig.ListenAddr, appConfig.WorkDir)
 	if err != nil {
 		log.Fatalf("Error creating HLS service: %v", err)
 	}
 	defer hlsService.Cleanup()
 
+	// Provider requests share per-host rate limits and retries, and the proxy.
+	limits := outboundLimits(appConfig)
+	outbound := services.NewOutboundTransport(proxyTransport, limits)
+
+	// Optional RSS watcher, grabbing new feed items that match the configured rules
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	if appConfig.RSSRulesFile != "" {
+		rssConfig, err := services.LoadRSSConfig(appConfig.RSSRulesFile)
+		if err != nil {
+			log.Fatalf("Error loading RSS rules: %v", err)
+		}
+		watcher, err := services.NewRSSWatcher(rssConfig, client, hlsService, outbound, filepath.Join(appConfig.DataDir, "rss-state.json"))
+		if err != nil {
+			log.Fatalf("Error creating RSS watcher: %v", err)
+		}
+		go watcher.Run(watchCtx)
+	}
+
 	// Setup handlers
 	torrentHandler := &handlers.TorrentHandler{HlsService: hlsService, ListenAddr: appConfig.ListenAddr}
+	subtitleProvider := services.NewOpenSubtitlesService(appConfig.OpenSubtitlesBaseURL, appConfig.OpenSubtitlesAPIKey)
+	subtitleProvider.Client.Transport = outbound
+	subtitleHandler := handlers.NewSubtitleHandler(subtitleProvider, hlsService)
+	statusHandler := handlers.NewStatusHandler(hlsService, appConfig.ListenAddr)
+	statusHandler.Network = services.NewNetworkSettings(proxyURL, limits)
+	torrentSearcher, err := newTorrentSearcher(appConfig, outbound)
+	if err != nil {
+		log.Fatalf("Error configuring torrent search: %v", err)
+	}
+	imdbService, err := newTitleSearcher(appConfig, outbound)
+	if err != nil {
+		log.Fatalf("Error configuring title metadata: %v", err)
+	}
+
+	// Cache provider responses; both searchers are shared by every handler below.
+	cacheDir := ""
+	if appConfig.PersistCache {
+		cacheDir = filepath.Join(appConfig.DataDir, "cache")
+	}
+	if appConfig.TorrentCacheTTL > 0 {
+		cached := services.NewCachingTorrentSearcher(torrentSearcher, appConfig.TorrentCacheTTL, cacheDir)
+		defer cached.Flush() // Persist the last misses on shutdown
+		statusHandler.Caches = append(statusHandler.Caches, cached)
+		torrentSearcher = cached
+	}
+	if appConfig.MetadataCacheTTL > 0 {
+		cached := services.NewCachingImdbSearcher(imdbService, appConfig.MetadataCacheTTL, cacheDir)
+		defer cached.Flush()
+		statusHandler.Caches = append(statusHandler.Caches, cached)
+		imdbService = cached
+	}
+	torrentSearchHandler := handlers.NewTorrentSearchHandler(torrentSearcher)
+	playHandler := handlers.NewPlayHandler(services.NewPlayResolver(imdbService, torrentSearcher, playPreferences(appConfig)), hlsService, appConfig.ListenAddr)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/add", torrentHandler.AddTorrentHandler)
-	mux.HandleFunc("/hls/", hlsService.ServeHTTP) // HLS service handles requests under /hls/
-	mux.HandleFunc("/search", handlers.NewSearchHandler(services.NewConcreteImdbService(appConfig.ImdbAPIKey)).SearchMoviesHandler)
+	mux.HandleFunc("/hls/", hlsService.ServeHTTP)  // HLS service handles requests under /hls/
+	mux.HandleFunc("/dash/", hlsService.ServeDASH) // DASH manifests for fMP4 streams, same segments
+	mux.HandleFunc("/search", handlers.NewSearchHandler(imdbService).SearchMoviesHandler)
+	mux.HandleFunc("/play", playHandler.PlayHandler)
+	mux.HandleFunc("/titles/", handlers.NewTitleHandler(imdbService).TitlesHandler)
+	mux.HandleFunc("/torrents/search", torrentSearchHandler.SearchTorrentsHandler)
+	mux.HandleFunc("/subtitles/search", subtitleHandler.SearchSubtitlesHandler)
+	mux.HandleFunc("/subtitles/attach", subtitleHandler.AttachSubtitleHandler)
+	mux.HandleFunc("/streams", statusHandler.StreamsHandler)
+	mux.HandleFunc("/streams/", statusHandler.StreamsHandler)
+	mux.HandleFunc("/status", statusHandler.MetricsHandler)
+	mux.HandleFunc("/status/network", statusHandler.NetworkHandler)
+	mux.Handle("/", web.Handler()) // Embedded web player and library UI
 
-	log.Printf("Starting HTTP server on http://%s", appConfig.ListenAddr)
+	log.Printf("Starting HTTP server on http://%s (web UI at http://%s/)", appConfig.ListenAddr, appConfig.ListenAddr)
 
 	// Graceful shutdown
 	go func() {
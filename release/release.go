@@ -0,0 +1,358 @@
+// Package release parses scene-style release names, such as torrent titles and the file names
+// inside torrents, into structured metadata:
+//
+//	Some.Show.S01E02.1080p.WEB-DL.DDP5.1.H.264-GROUP
+//	The Movie (2019) [2160p] [BluRay] [HDR10] [x265]
+package release
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Info is the metadata parsed from a release name. Fields are zero when not present.
+type Info struct {
+	Title      string   `json:"title"`
+	Year       int      `json:"year,omitempty"`
+	Season     int      `json:"season,omitempty"`
+	Episode    int      `json:"episode,omitempty"`    // 0 with a Season means a season pack
+	EpisodeEnd int      `json:"episodeEnd,omitempty"` // Last episode of a multi-episode release
+	Resolution int      `json:"resolution,omitempty"` // Vertical resolution, e.g. 1080
+	Source     string   `json:"source,omitempty"`     // BluRay, WEB-DL, WEBRip, WEB, HDTV, DVDRip, DVD, HDRip, CAM, TS
+	Remux      bool     `json:"remux,omitempty"`
+	Codec      string   `json:"codec,omitempty"` // H.264 (x264, AVC), H.265 (x265, HEVC), AV1, VP9, XviD
+	HDR        []string `json:"hdr,omitempty"`   // HDR10+, HDR10, HDR, DV, HLG
+	Audio      string   `json:"audio,omitempty"` // e.g. "DDP 5.1", "TrueHD Atmos 7.1"
+	Languages  []string `json:"languages,omitempty"`
+	Proper     bool     `json:"proper,omitempty"` // PROPER or REPACK
+	Group      string   `json:"group,omitempty"`
+}
+
+// EpisodeKey returns "S01E02" for episodes, "S01" for season packs and "" otherwise.
+func (i Info) EpisodeKey() string {
+	switch {
+	case i.Season > 0 && i.Episode > 0:
+		return fmt.Sprintf("S%02dE%02d", i.Season, i.Episode)
+	case i.Season > 0:
+		return fmt.Sprintf("S%02d", i.Season)
+	}
+	return ""
+}
+
+// videoExtensions are stripped from file names before parsing.
+var videoExtensions = map[string]bool{
+	".mkv": true, ".mp4": true, ".m4v": true, ".avi": true, ".mov": true, ".wmv": true,
+	".ts": true, ".m2ts": true, ".webm": true, ".mpg": true, ".mpeg": true,
+}
+
+var (
+	// A trailing "-GROUP", optionally followed by a site tag such as "[rarbg]".
+	trailingGroupPattern = regexp.MustCompile(`-([A-Za-z0-9][A-Za-z0-9_]*)(\s*\[[^\]]*\])?\s*$`)
+	// A leading "[Group]", as used by anime fansub releases.
+	leadingGroupPattern = regexp.MustCompile(`^\[([^\]]+)\]\s*`)
+
+	yearPattern       = regexp.MustCompile(`\b(19[2-9]\d|20\d\d)\b`)
+	episodePattern    = regexp.MustCompile(`(?i)\bS(\d{1,3}) ?E(\d{1,4})(?:(?: ?-? ?E| ?-)(\d{1,4}))?\b`)
+	crossEpPattern    = regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})\b`)
+	seasonPattern     = regexp.MustCompile(`(?i)\bS(\d{1,3})\b|\bSeason ?(\d{1,3})\b`)
+	resolutionPattern = regexp.MustCompile(`(?i)\b(2160|1440|1080|720|576|540|480|360)[pi]\b|\b(4k|uhd)\b`)
+	remuxPattern      = regexp.MustCompile(`(?i)\bremux\b`)
+	properPattern     = regexp.MustCompile(`(?i)\b(proper|repack|rerip)\b`)
+	// Fansub releases number episodes absolutely: "[Group] Title - 05 (1080p)".
+	absoluteEpisodePattern = regexp.MustCompile(`\s-\s(\d{1,4})(?:v\d)?\b`)
+)
+
+// patternValue pairs a pattern with the normalised value it stands for.
+type patternValue struct {
+	pattern *regexp.Regexp
+	value   string
+}
+
+func pv(expr, value string) patternValue {
+	return patternValue{regexp.MustCompile(`(?i)\b(?:` + expr + `)\b`), value}
+}
+
+// Order matters: the first matching entry wins, so more specific spellings come first.
+// Strong tokens are unambiguous and end the title wherever they appear; weak ones (such as
+// "WEB", "CAM" or "DD") could be words of a title, so they're only looked for after it.
+var (
+	strongSources = []patternValue{
+		pv(`web ?-?dl`, "WEB-DL"),
+		pv(`web ?-?rip`, "WEBRip"),
+		pv(`blu ?-?ray|bdrip|brrip|bdremux|bd25|bd50`, "BluRay"),
+		pv(`hdtv|pdtv`, "HDTV"),
+		pv(`dvdrip`, "DVDRip"),
+		pv(`hdrip`, "HDRip"),
+		pv(`hdcam|camrip`, "CAM"),
+		pv(`telesync|hdts`, "TS"),
+	}
+	weakSources = []patternValue{
+		pv(`dvdr|dvd5|dvd9|dvd`, "DVD"),
+		pv(`web`, "WEB"),
+		pv(`cam`, "CAM"),
+		pv(`ts`, "TS"),
+	}
+	codecs = []patternValue{
+		pv(`[xh] ?264|avc`, "H.264"),
+		pv(`[xh] ?265|hevc`, "H.265"),
+		pv(`av1`, "AV1"),
+		pv(`vp9`, "VP9"),
+		pv(`xvid|divx`, "XviD"),
+	}
+	hdrFormats = []patternValue{
+		{regexp.MustCompile(`(?i)\bhdr10 ?(?:\+|plus\b)`), "HDR10+"}, // No \b after a trailing "+"
+		pv(`hdr10`, "HDR10"),
+		pv(`hdr`, "HDR"),
+		pv(`dv|dovi|dolby ?vision`, "DV"),
+		pv(`hlg`, "HLG"),
+	}
+	audioFormats = []patternValue{
+		pv(`dts ?-?hd ?ma`, "DTS-HD MA"),
+		pv(`dts ?-?x`, "DTS:X"),
+		pv(`dts ?-?hd`, "DTS-HD"),
+		pv(`truehd`, "TrueHD"),
+		{regexp.MustCompile(`(?i)\b(?:dd\+|(?:ddp[1-9]?|e ?-?ac ?-?3|eac3)\b)`), "DDP"},
+		pv(`dts`, "DTS"),
+		pv(`dd[1-9]?|ac3|dolby digital`, "DD"),
+		pv(`aac[1-9]?`, "AAC"),
+		pv(`flac`, "FLAC"),
+		pv(`opus`, "Opus"),
+		pv(`mp3`, "MP3"),
+	}
+	atmosPattern = pv(`atmos`, "Atmos")
+	// Channel layouts follow the audio format, e.g. "DDP5.1" (normalised to "DDP5 1").
+	channelsPattern = regexp.MustCompile(`(?i)(?:\b|[a-z+])([1-8]) ([01])\b`)
+
+	// languageTags maps language tokens to RFC 5646 tags. MULTi and DUAL mark several audio
+	// languages without naming them.
+	languageTags = map[string]string{
+		"english": "en", "eng": "en",
+		"french": "fr", "fre": "fr", "vostfr": "fr", "truefrench": "fr", "vff": "fr",
+		"german": "de", "ger": "de",
+		"spanish": "es", "spa": "es", "castellano": "es", "latino": "es",
+		"italian": "it", "ita": "it",
+		"portuguese": "pt", "por": "pt",
+		"russian": "ru", "rus": "ru",
+		"japanese": "ja", "jap": "ja", "jpn": "ja",
+		"korean": "ko", "kor": "ko",
+		"chinese": "zh", "chi": "zh",
+		"hindi": "hi", "hin": "hi",
+		"dutch": "nl", "swedish": "sv", "norwegian": "no", "danish": "da",
+		"finnish": "fi", "polish": "pl", "turkish": "tr", "arabic": "ar",
+		"multi": "multi", "dual": "multi",
+	}
+)
+
+// Parse parses a release name or a file path; directories and a video extension are ignored.
+func Parse(name string) Info {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if ext := strings.ToLower(path.Ext(name)); videoExtensions[ext] {
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+
+	var info Info
+	fansub := false
+	if m := leadingGroupPattern.FindStringSubmatch(name); m != nil {
+		info.Group = strings.TrimSpace(m[1])
+		name = name[len(m[0]):]
+		fansub = true
+	}
+	if info.Group == "" {
+		// Only treat "-X" as a group if it follows other release tokens, so that hyphenated
+		// titles such as "Spider-Man" keep their name.
+		if m := trailingGroupPattern.FindStringSubmatchIndex(name); m != nil && m[0] > 0 && strings.ContainsAny(name[:m[0]], ". _") {
+			info.Group = name[m[2]:m[3]]
+			name = name[:m[0]]
+		}
+	}
+	norm := normalize(name)
+
+	// strong tracks where the first strong token starts; the title is what comes before it.
+	strong := len(norm)
+	markStrong := func(loc []int) {
+		if loc != nil && loc[0] < strong {
+			strong = loc[0]
+		}
+	}
+
+	if m := episodePattern.FindStringSubmatchIndex(norm); m != nil {
+		info.Season, _ = strconv.Atoi(norm[m[2]:m[3]])
+		info.Episode, _ = strconv.Atoi(norm[m[4]:m[5]])
+		if m[6] >= 0 {
+			info.EpisodeEnd, _ = strconv.Atoi(norm[m[6]:m[7]])
+		}
+		markStrong(m)
+	} else if m := crossEpPattern.FindStringSubmatchIndex(norm); m != nil {
+		info.Season, _ = strconv.Atoi(norm[m[2]:m[3]])
+		info.Episode, _ = strconv.Atoi(norm[m[4]:m[5]])
+		markStrong(m)
+	} else if m := seasonPattern.FindStringSubmatchIndex(norm); m != nil {
+		if m[2] >= 0 {
+			info.Season, _ = strconv.Atoi(norm[m[2]:m[3]])
+		} else {
+			info.Season, _ = strconv.Atoi(norm[m[4]:m[5]])
+		}
+		markStrong(m)
+	} else if m := absoluteEpisodePattern.FindStringSubmatchIndex(norm); m != nil && fansub {
+		info.Episode, _ = strconv.Atoi(norm[m[2]:m[3]])
+		markStrong(m)
+	}
+	if m := resolutionPattern.FindStringSubmatchIndex(norm); m != nil {
+		if m[2] >= 0 {
+			info.Resolution, _ = strconv.Atoi(norm[m[2]:m[3]])
+		} else {
+			info.Resolution = 2160
+		}
+		markStrong(m)
+	}
+	info.Source, _ = firstMatch(norm, strongSources, markStrong)
+	info.Codec, _ = firstMatch(norm, codecs, markStrong)
+	if loc := remuxPattern.FindStringIndex(norm); loc != nil {
+		info.Remux = true
+		markStrong(loc)
+	}
+
+	// The year is the last one before any strong token, so that "2001 A Space Odyssey 1968"
+	// keeps its title, and a title that is only a year ("1917") isn't mistaken for one.
+	titleEnd := strong
+	for _, loc := range yearPattern.FindAllStringIndex(norm[:strong], -1) {
+		if loc[0] == 0 {
+			continue
+		}
+		info.Year, _ = strconv.Atoi(norm[loc[0]:loc[1]])
+		titleEnd = loc[0]
+	}
+	if info.Year == 0 && strong < len(norm) {
+		// A year right after the first strong token, as in "Title S01 2019".
+		if loc := yearPattern.FindStringIndex(norm[strong:]); loc != nil && loc[0] < 12 {
+			info.Year, _ = strconv.Atoi(norm[strong+loc[0] : strong+loc[1]])
+		}
+	}
+
+	// Weak tokens are looked for after the title. Without a strong token or a year there is
+	// nothing to tell where the title ends, so the first weak token (past the first word) does.
+	tailStart := titleEnd
+	if tailStart == len(norm) {
+		tailStart = 0
+	}
+	weak := len(norm)
+	markWeak := func(loc []int) {
+		if loc != nil && (tailStart > 0 || loc[0] > 0) && tailStart+loc[0] < weak {
+			weak = tailStart + loc[0]
+		}
+	}
+	tail := norm[tailStart:]
+	if info.Source == "" {
+		info.Source, _ = firstMatch(tail, weakSources, markWeak)
+	}
+	if loc := properPattern.FindStringIndex(tail); loc != nil {
+		info.Proper = true
+		markWeak(loc)
+	}
+	info.HDR = allMatches(tail, hdrFormats, markWeak)
+	info.Audio = parseAudio(tail, markWeak)
+	info.Languages = parseLanguages(tail, markWeak)
+	if weak < titleEnd {
+		titleEnd = weak
+	}
+
+	info.Title = cleanTitle(norm[:titleEnd])
+	return info
+}
+
+// normalize turns separators and brackets into single spaces. Dots between digits, as in
+// "H.264" or "5.1", also become spaces; the patterns allow for that.
+func normalize(name string) string {
+	replaced := strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '_', '(', ')', '[', ']', '{', '}':
+			return ' '
+		}
+		return r
+	}, name)
+	return strings.Join(strings.Fields(replaced), " ")
+}
+
+// cleanTitle trims leftover separators from the title part of a name.
+func cleanTitle(s string) string {
+	return strings.Trim(strings.TrimSpace(s), " -–:")
+}
+
+// firstMatch returns the value of the first entry matching s, marking its location.
+func firstMatch(s string, table []patternValue, mark func([]int)) (string, bool) {
+	for _, e := range table {
+		if loc := e.pattern.FindStringIndex(s); loc != nil {
+			mark(loc)
+			return e.value, true
+		}
+	}
+	return "", false
+}
+
+// allMatches returns the values of every entry matching s, in table order. A match inside an
+// earlier entry's match ("HDR10" within "HDR10+") doesn't count again.
+func allMatches(s string, table []patternValue, mark func([]int)) []string {
+	var values []string
+	var taken [][]int
+	for _, e := range table {
+		loc := e.pattern.FindStringIndex(s)
+		if loc == nil || slices.ContainsFunc(taken, func(t []int) bool { return loc[0] < t[1] && t[0] < loc[1] }) {
+			continue
+		}
+		mark(loc)
+		taken = append(taken, loc)
+		values = append(values, e.value)
+	}
+	return values
+}
+
+// parseAudio returns the audio format with Atmos and the channel layout, e.g. "DDP Atmos 5.1".
+func parseAudio(s string, mark func([]int)) string {
+	var parts []string
+	format, ok := firstMatch(s, audioFormats, mark)
+	if ok {
+		parts = append(parts, format)
+	}
+	if loc := atmosPattern.pattern.FindStringIndex(s); loc != nil {
+		mark(loc)
+		parts = append(parts, atmosPattern.value)
+	}
+	if m := channelsPattern.FindStringSubmatchIndex(s); m != nil && ok {
+		parts = append(parts, s[m[2]:m[3]]+"."+s[m[4]:m[5]])
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseLanguages returns the language tags named in s, sorted, without duplicates.
+func parseLanguages(s string, mark func([]int)) []string {
+	seen := map[string]bool{}
+	offset := 0
+	for _, token := range strings.Split(s, " ") {
+		start := offset
+		offset += len(token) + 1
+		tag, ok := languageTags[strings.ToLower(token)]
+		if !ok {
+			continue
+		}
+		// Short codes such as "ita" are only trusted in upper case, where they're unlikely words.
+		if len(token) == 3 && token != strings.ToUpper(token) {
+			continue
+		}
+		seen[tag] = true
+		mark([]int{start, start + len(token)})
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	tags := make([]string, 0, len(seen))
+	for tag := range seen {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
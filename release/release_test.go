@@ -0,0 +1,161 @@
+package release
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		want Info
+	}{
+		// Titles and years
+		{
+			"The.Matrix.1999.1080p.BluRay.x264-SPARKS",
+			Info{Title: "The Matrix", Year: 1999, Resolution: 1080, Source: "BluRay", Codec: "H.264", Group: "SPARKS"},
+		},
+		{
+			"1917.2019.2160p.UHD.BluRay.x265.10bit.HDR.DTS-HD.MA.5.1-SWTYBLZ",
+			Info{Title: "1917", Year: 2019, Resolution: 2160, Source: "BluRay", Codec: "H.265", HDR: []string{"HDR"}, Audio: "DTS-HD MA 5.1", Group: "SWTYBLZ"},
+		},
+		{
+			"2001.A.Space.Odyssey.1968.1080p.BluRay.x264-AMIABLE",
+			Info{Title: "2001 A Space Odyssey", Year: 1968, Resolution: 1080, Source: "BluRay", Codec: "H.264", Group: "AMIABLE"},
+		},
+		{
+			"Blade Runner 2049 (2017)",
+			Info{Title: "Blade Runner 2049", Year: 2017},
+		},
+		{
+			"Blade Runner 2049 (2017) [2160p] [BluRay] [HDR10] [x265]",
+			Info{Title: "Blade Runner 2049", Year: 2017, Resolution: 2160, Source: "BluRay", Codec: "H.265", HDR: []string{"HDR10"}},
+		},
+		{
+			"Spider-Man.No.Way.Home.2021.1080p.WEB-DL.DDP5.1.H.264-SPARKS",
+			Info{Title: "Spider-Man No Way Home", Year: 2021, Resolution: 1080, Source: "WEB-DL", Codec: "H.264", Audio: "DDP 5.1", Group: "SPARKS"},
+		},
+		{
+			"Spider-Man",
+			Info{Title: "Spider-Man"},
+		},
+		{
+			"/downloads/The Movie (2019)/The.Movie.2019.720p.WEBRip.mkv",
+			Info{Title: "The Movie", Year: 2019, Resolution: 720, Source: "WEBRip"},
+		},
+		{
+			"Some.Movie.2019.PROPER.1080p.WEB.h264-GRP",
+			Info{Title: "Some Movie", Year: 2019, Resolution: 1080, Source: "WEB", Codec: "H.264", Proper: true, Group: "GRP"},
+		},
+
+		// Episodes, season packs and ranges
+		{
+			"Some.Show.S01E02.1080p.WEB-DL.DDP5.1.H.264-GROUP",
+			Info{Title: "Some Show", Season: 1, Episode: 2, Resolution: 1080, Source: "WEB-DL", Codec: "H.264", Audio: "DDP 5.1", Group: "GROUP"},
+		},
+		{
+			"Some Show 1x02 HDTV",
+			Info{Title: "Some Show", Season: 1, Episode: 2, Source: "HDTV"},
+		},
+		{
+			"Some.Show.S02.1080p.BluRay.x265-GRP",
+			Info{Title: "Some Show", Season: 2, Resolution: 1080, Source: "BluRay", Codec: "H.265", Group: "GRP"},
+		},
+		{
+			"Some Show Season 3 Complete 720p",
+			Info{Title: "Some Show", Season: 3, Resolution: 720},
+		},
+		{
+			"Some.Show.S01E01-E03.720p.HDTV.x264-GRP",
+			Info{Title: "Some Show", Season: 1, Episode: 1, EpisodeEnd: 3, Resolution: 720, Source: "HDTV", Codec: "H.264", Group: "GRP"},
+		},
+		{
+			"Some.Show.S01E01E02.720p.HDTV",
+			Info{Title: "Some Show", Season: 1, Episode: 1, EpisodeEnd: 2, Resolution: 720, Source: "HDTV"},
+		},
+		{
+			"Some.Show.2019.S01E05.1080p.WEB.H264-GRP",
+			Info{Title: "Some Show", Year: 2019, Season: 1, Episode: 5, Resolution: 1080, Source: "WEB", Codec: "H.264", Group: "GRP"},
+		},
+		{
+			"[SubsPlease] Some Anime - 05 (1080p) [ABCD1234].mkv",
+			Info{Title: "Some Anime", Episode: 5, Resolution: 1080, Group: "SubsPlease"},
+		},
+		{
+			"[Erai-raws] Some Anime - 112v2 [720p][Multiple Subtitle]",
+			Info{Title: "Some Anime", Episode: 112, Resolution: 720, Group: "Erai-raws"},
+		},
+
+		// Resolution, source, HDR, audio and languages
+		{
+			"Dune.Part.Two.2024.2160p.WEB-DL.DV.HDR10+.DDP5.1.Atmos.H.265-FLUX",
+			Info{Title: "Dune Part Two", Year: 2024, Resolution: 2160, Source: "WEB-DL", Codec: "H.265", HDR: []string{"HDR10+", "DV"}, Audio: "DDP Atmos 5.1", Group: "FLUX"},
+		},
+		{
+			"Movie.2020.4K.UHD.BluRay.REMUX.HEVC.TrueHD.Atmos.7.1-FGT",
+			Info{Title: "Movie", Year: 2020, Resolution: 2160, Source: "BluRay", Remux: true, Codec: "H.265", Audio: "TrueHD Atmos 7.1", Group: "FGT"},
+		},
+		{
+			"Movie.2020.1080p.AMZN.WEBRip.DDP2.0.x264-NTb",
+			Info{Title: "Movie", Year: 2020, Resolution: 1080, Source: "WEBRip", Codec: "H.264", Audio: "DDP 2.0", Group: "NTb"},
+		},
+		{
+			"Movie.2018.MULTi.1080p.BluRay.AVC.DTS-HD.MA.7.1-GRP",
+			Info{Title: "Movie", Year: 2018, Resolution: 1080, Source: "BluRay", Codec: "H.264", Audio: "DTS-HD MA 7.1", Languages: []string{"multi"}, Group: "GRP"},
+		},
+		{
+			"Movie.2018.FRENCH.720p.HDRip.XviD.AC3-GRP",
+			Info{Title: "Movie", Year: 2018, Resolution: 720, Source: "HDRip", Codec: "XviD", Audio: "DD", Languages: []string{"fr"}, Group: "GRP"},
+		},
+		{
+			"Movie 2022 1080p WEB-DL AAC2.0 AV1",
+			Info{Title: "Movie", Year: 2022, Resolution: 1080, Source: "WEB-DL", Codec: "AV1", Audio: "AAC 2.0"},
+		},
+		{
+			"Movie.2023.HDCAM.x264-GRP",
+			Info{Title: "Movie", Year: 2023, Source: "CAM", Codec: "H.264", Group: "GRP"},
+		},
+		{
+			"Movie.2021.1080p.HDR.HLG.WEB.VP9",
+			Info{Title: "Movie", Year: 2021, Resolution: 1080, Source: "WEB", Codec: "VP9", HDR: []string{"HDR", "HLG"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q)\n got %+v\nwant %+v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCodecs(t *testing.T) {
+	tests := map[string]string{
+		"x264": "H.264", "H.264": "H.264", "H264": "H.264", "h264": "H.264", "AVC": "H.264",
+		"x265": "H.265", "H.265": "H.265", "H265": "H.265", "HEVC": "H.265",
+		"AV1": "AV1", "VP9": "VP9", "XviD": "XviD", "DivX": "XviD",
+	}
+	for token, want := range tests {
+		name := "Movie.2020.1080p." + token + "-GRP"
+		if got := Parse(name).Codec; got != want {
+			t.Errorf("Parse(%q).Codec = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestEpisodeKey(t *testing.T) {
+	tests := []struct {
+		info Info
+		want string
+	}{
+		{Info{Season: 1, Episode: 2}, "S01E02"},
+		{Info{Season: 12}, "S12"},
+		{Info{Episode: 5}, ""},
+		{Info{}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.info.EpisodeKey(); got != tt.want {
+			t.Errorf("%+v.EpisodeKey() = %q, want %q", tt.info, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// audioDirName is the sub-directory of a stream's HLS directory holding alternate audio renditions.
+const audioDirName = "audio"
+
+// AudioTrack describes an audio stream of the source file and its HLS rendition.
+type AudioTrack struct {
+	ID       string `json:"id"`
+	Language string `json:"language,omitempty"` // RFC 5646 tag, e.g. "en"
+	Name     string `json:"name"`
+	Codec    string `json:"codec"` // Source codec as reported by ffprobe
+	Channels int    `json:"channels,omitempty"`
+	Default  bool   `json:"default"`
+
+	StreamIndex int  `json:"-"` // Absolute ffprobe stream index
+	Muxed       bool `json:"-"` // Carried in the main media playlist rather than its own
+}
+
+// PlaylistPath returns the track's media playlist path, relative to the HLS directory.
+// A muxed track has no playlist of its own.
+func (t AudioTrack) PlaylistPath() string {
+	if t.Muxed {
+		return ""
+	}
+	return audioDirName + "/" + t.ID + ".m3u8"
+}
+
+// audioTracksFromProbe returns a track for every audio stream in the probe. The default track is
+// the first one matching preferredLanguage (a language code or name), falling back to the stream
+// flagged as default in the container and then to the first stream.
+func audioTracksFromProbe(probe *MediaProbe, preferredLanguage string) []AudioTrack {
+	streams := probe.StreamsOfType("audio")
+	tracks := make([]AudioTrack, 0, len(streams))
+	seenNames := make(map[string]int)
+	for i, st := range streams {
+		lang, _ := lookupLanguage(st.Tags.Language)
+		// HLS requires NAME to be unique within the group.
+		name := audioTrackName(st, lang, i)
+		if seenNames[name]++; seenNames[name] > 1 {
+			name = fmt.Sprintf("%s (%d)", name, seenNames[name])
+		}
+		tracks = append(tracks, AudioTrack{
+			ID:          fmt.Sprintf("audio%d", st.Index),
+			Language:    lang.Tag,
+			Name:        name,
+			Codec:       st.CodecName,
+			Channels:    st.Channels,
+			StreamIndex: st.Index,
+		})
+	}
+	if len(tracks) == 0 {
+		return nil
+	}
+
+	defaultIdx := -1
+	if preferredLanguage != "" {
+		for i, track := range tracks {
+			if track.Language != "" && languageMatches(track.Language, preferredLanguage) {
+				defaultIdx = i
+				break
+			}
+		}
+	}
+	if defaultIdx < 0 {
+		for i, st := range streams {
+			if st.Disposition.Default != 0 {
+				defaultIdx = i
+				break
+			}
+		}
+	}
+	if defaultIdx < 0 {
+		defaultIdx = 0
+	}
+	tracks[defaultIdx].Default = true
+	return tracks
+}
+
+// muxedAudioTrack returns the track muxed into the main media playlist, if any.
+func muxedAudioTrack(tracks []AudioTrack) (AudioTrack, bool) {
+	for _, track := range tracks {
+		if track.Muxed {
+			return track, true
+		}
+	}
+	return AudioTrack{}, false
+}
+
+// audioTrackName picks a human readable NAME for an audio rendition,
+// e.g. "English 5.1" or the container's title tag.
+func audioTrackName(st ProbeStream, lang languageInfo, position int) string {
+	name := strings.TrimSpace(st.Tags.Title)
+	if name == "" {
+		name = lang.Name
+	}
+	if name == "" {
+		name = "Audio " + strconv.Itoa(position+1)
+	}
+	switch st.Channels {
+	case 0:
+	case 1:
+		name += " Mono"
+	case 2:
+		name += " Stereo"
+	case 6:
+		name += " 5.1"
+	case 8:
+		name += " 7.1"
+	default:
+		name += fmt.Sprintf(" %dch", st.Channels)
+	}
+	return name
+}
+
+// hasSeparateAudio reports whether any track has its own audio-only playlist.
+func hasSeparateAudio(tracks []AudioTrack) bool {
+	for _, track := range tracks {
+		if !track.Muxed {
+			return true
+		}
+	}
+	return false
+}
+
+// alternateAudioOutputArgs returns the ffmpeg output options that write an audio-only
+// HLS rendition for a track that isn't muxed into the main playlist.
+func alternateAudioOutputArgs(hlsDir string, track AudioTrack, profile TranscodeProfile, segmenting hlsSegmenting) []string {
+	args := []string{
+		"-map", fmt.Sprintf("0:%d", track.StreamIndex),
+		"-vn", "-sn",
+		"-c:a", "aac",
+	}
+	playlistPath := filepath.Join(hlsDir, filepath.FromSlash(track.PlaylistPath()))
+	return append(args, profile.hlsOutputArgs(playlistPath, track.ID+"_", track.ID+"_init.mp4", segmenting)...)
+}
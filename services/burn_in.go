@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+)
+
+// burnInFileName is the ASS file a text subtitle is rendered from when burned into the video.
+const burnInFileName = "burnin.ass"
+
+// burnInLabel is the filtergraph output label carrying the video with subtitles burned in.
+const burnInLabel = "[vburn]"
+
+// burnInSource is the subtitle chosen to be burned into the video.
+type burnInSource struct {
+	StreamIndex int           // Absolute ffprobe stream index of an embedded subtitle, or -1
+	File        *torrent.File // Sidecar file, when StreamIndex is -1
+	Image       bool          // Bitmap subtitle (PGS, VobSub, DVB) that can be overlaid directly
+	inputFormat string        // ffmpeg demuxer for sidecar files
+}
+
+// selectBurnInSubtitle resolves the burn-in selector from the add request. A number selects the
+// N-th (0-based) subtitle stream in the container, as ffmpeg's "0:s:N" would; anything else is
+// treated as a language and matched against embedded streams first, then sidecar files.
+func selectBurnInSubtitle(selector string, probe *MediaProbe, sidecars []SubtitleTrack) (*burnInSource, error) {
+	embedded := probe.StreamsOfType("subtitle")
+	fromStream := func(st ProbeStream) *burnInSource {
+		return &burnInSource{StreamIndex: st.Index, Image: !textSubtitleCodecs[st.CodecName]}
+	}
+
+	if n, err := strconv.Atoi(selector); err == nil {
+		if n < 0 || n >= len(embedded) {
+			return nil, fmt.Errorf("subtitle stream %d not found (file has %d)", n, len(embedded))
+		}
+		return fromStream(embedded[n]), nil
+	}
+
+	for _, st := range embedded {
+		if st.Tags.Language != "" && languageMatches(st.Tags.Language, selector) {
+			return fromStream(st), nil
+		}
+	}
+	for _, track := range sidecars {
+		if track.Language != "" && languageMatches(track.Language, selector) {
+			return &burnInSource{StreamIndex: -1, File: track.File, inputFormat: track.inputFormat}, nil
+		}
+	}
+	return nil, fmt.Errorf("no subtitle matching %q", selector)
+}
+
+// matchesTrack reports whether the burn-in source is the same subtitle as a WebVTT rendition,
+// which is then dropped from the master playlist so it isn't shown twice.
+func (b *burnInSource) matchesTrack(track SubtitleTrack) bool {
+	if b.File != nil {
+		return track.File == b.File
+	}
+	return track.Source == SubtitleEmbedded && track.StreamIndex == b.StreamIndex
+}
+
+// prepareBurnInFilter returns a filter_complex graph that burns the subtitle into the first
+// video stream and labels the result burnInLabel. Bitmap subtitles are scaled to the video's
+// size, since their canvas often doesn't match it (e.g. 1080p PGS in a 720p encode), and
+// overlaid straight from the input; text subtitles are first rendered to an ASS file for the
+// subtitles filter. For an
+// embedded text stream this reads the whole video, so transcoding only starts once the torrent
+// file has fully downloaded.
+func prepareBurnInFilter(streamID, hlsDir string, video *torrent.File, src *burnInSource) (string, error) {
+	if src.Image {
+		return fmt.Sprintf("[0:%d][0:v:0]scale2ref=w=rw:h=rh[burnsub][burnvideo];[burnvideo][burnsub]overlay=eof_action=pass%s",
+			src.StreamIndex, burnInLabel), nil
+	}
+
+	assPath := filepath.Join(hlsDir, burnInFileName)
+	var (
+		args   []string
+		reader torrent.Reader
+	)
+	if src.File != nil {
+		reader = src.File.NewReader()
+		args = []string{"-f", src.inputFormat, "-i", "pipe:0"}
+		log.Printf("[%s] Preparing sidecar subtitle %s for burn-in", streamID, src.File.Path())
+	} else {
+		reader = video.NewReader()
+		args = []string{"-i", "pipe:0", "-map", fmt.Sprintf("0:%d", src.StreamIndex)}
+		log.Printf("[%s] Extracting embedded subtitle stream %d for burn-in; this waits for the full download", streamID, src.StreamIndex)
+	}
+	defer reader.Close()
+	args = append(args, "-c:s", "ass", "-f", "ass", assPath)
+
+	cmd := exec.Command(FFmpegPath, args...)
+	cmd.Stdin = reader
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to extract subtitle for burn-in: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return fmt.Sprintf("[0:v:0]subtitles=%s%s", escapeFilterValue(assPath), burnInLabel), nil
+}
+
+// escapeFilterValue escapes a filter option value for use inside a filtergraph description:
+// once for the option parser and once more for the graph parser.
+func escapeFilterValue(v string) string {
+	optionLevel := strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(v)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(optionLevel)
+}
@@ -0,0 +1,28 @@
+package services
+
+import "testing"
+
+func TestPrepareBurnInFilterImage(t *testing.T) {
+	got, err := prepareBurnInFilter("s", t.TempDir(), nil, &burnInSource{StreamIndex: 3, Image: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The subtitle is scaled to the video before it is overlaid.
+	want := "[0:3][0:v:0]scale2ref=w=rw:h=rh[burnsub][burnvideo];[burnvideo][burnsub]overlay=eof_action=pass[vburn]"
+	if got != want {
+		t.Errorf("filter = %q, want %q", got, want)
+	}
+}
+
+func TestEscapeFilterValue(t *testing.T) {
+	tests := map[string]string{
+		"/tmp/hls/burnin.ass":   "/tmp/hls/burnin.ass",
+		`C:\hls\it's [1].ass`:   `C\\:\\\\hls\\\\it\\\'s \[1\].ass`,
+		"/tmp/a,b;c/burnin.ass": `/tmp/a\,b\;c/burnin.ass`,
+	}
+	for in, want := range tests {
+		if got := escapeFilterValue(in); got != want {
+			t.Errorf("escapeFilterValue(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
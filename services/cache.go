@@ -0,0 +1,388 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// maxCacheEntries bounds each cache; the entries closest to expiry are evicted first.
+const maxCacheEntries = 2000
+
+const (
+	// cacheFetchTimeout bounds a fetch, which outlives the callers waiting for it.
+	cacheFetchTimeout = time.Minute
+	// cacheSaveDelay batches the writes of a persisted cache: a miss schedules a save this
+	// long after it, and the misses in between are written together.
+	cacheSaveDelay = 5 * time.Second
+)
+
+// CacheStats counts how a cache has been used since the service started.
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+// CacheReporter is implemented by caching decorators to report their caches, by name.
+type CacheReporter interface {
+	CacheStats() map[string]CacheStats
+}
+
+type cacheEntry[V any] struct {
+	Value   V         `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// ttlCache is a TTL cache that coalesces concurrent misses for the same key into a single
+// fetch. Only successful fetches are cached. When path is set, entries are persisted to it as
+// JSON and reloaded on startup.
+type ttlCache[V any] struct {
+	ttl          time.Duration
+	path         string
+	fetchTimeout time.Duration
+	saveDelay    time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]cacheEntry[V]
+	saveTimer *time.Timer // Pending save, or nil
+	saveMu    sync.Mutex  // Serialises writes of the cache file
+	group     singleflight.Group
+
+	hits, misses atomic.Int64
+}
+
+func newTTLCache[V any](ttl time.Duration, path string) *ttlCache[V] {
+	c := &ttlCache[V]{
+		ttl:          ttl,
+		path:         path,
+		fetchTimeout: cacheFetchTimeout,
+		saveDelay:    cacheSaveDelay,
+		entries:      map[string]cacheEntry[V]{},
+	}
+	if path == "" {
+		return c
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Cache %s: failed to read: %v", path, err)
+		}
+		return c
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		log.Printf("Cache %s: ignoring unreadable file: %v", path, err)
+		c.entries = map[string]cacheEntry[V]{}
+	}
+	now := time.Now()
+	for key, e := range c.entries {
+		if now.After(e.Expires) {
+			delete(c.entries, key)
+		}
+	}
+	return c
+}
+
+// get returns the cached value for key, or calls fetch once for all concurrent callers
+// missing it. fetch runs detached from ctx so one caller giving up doesn't fail the others,
+// bounded by fetchTimeout instead; the callers' own deadlines still apply to their wait.
+func (c *ttlCache[V]) get(ctx context.Context, key string, fetch func(ctx context.Context) (V, error)) (V, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.Expires) {
+		c.hits.Add(1)
+		return e.Value, nil
+	}
+	c.misses.Add(1)
+
+	ch := c.group.DoChan(key, func() (any, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.fetchTimeout)
+		defer cancel()
+		v, err := fetch(fetchCtx)
+		if err == nil {
+			c.store(key, v)
+		}
+		return v, err
+	})
+	select {
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			var zero V
+			return zero, res.Err
+		}
+		return res.Val.(V), nil
+	}
+}
+
+func (c *ttlCache[V]) store(key string, v V) {
+	c.mu.Lock()
+	now := time.Now()
+	if len(c.entries) >= maxCacheEntries {
+		c.evictLocked(now)
+	}
+	c.entries[key] = cacheEntry[V]{Value: v, Expires: now.Add(c.ttl)}
+	if c.path != "" && c.saveTimer == nil {
+		c.saveTimer = time.AfterFunc(c.saveDelay, c.flush)
+	}
+	c.mu.Unlock()
+}
+
+// evictLocked drops expired entries, then those closest to expiry until a tenth of the
+// cache is free. The caller must hold c.mu.
+func (c *ttlCache[V]) evictLocked(now time.Time) {
+	keys := make([]string, 0, len(c.entries))
+	for key, e := range c.entries {
+		if now.After(e.Expires) {
+			delete(c.entries, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	excess := len(keys) - maxCacheEntries*9/10
+	if excess <= 0 {
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].Expires.Before(c.entries[keys[j]].Expires)
+	})
+	for _, key := range keys[:excess] {
+		delete(c.entries, key)
+	}
+}
+
+// flush writes the pending changes to the cache file, if it has one.
+func (c *ttlCache[V]) flush() {
+	if c.path == "" {
+		return
+	}
+	c.mu.Lock()
+	if c.saveTimer != nil {
+		c.saveTimer.Stop()
+		c.saveTimer = nil
+	}
+	c.mu.Unlock()
+	if err := c.save(); err != nil {
+		log.Printf("Cache %s: %v", c.path, err)
+	}
+}
+
+func (c *ttlCache[V]) save() error {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	c.mu.Lock()
+	data, err := json.Marshal(c.entries)
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0750); err != nil {
+		return fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	return writeFileAtomic(c.path, data)
+}
+
+func (c *ttlCache[V]) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: len(c.entries)}
+}
+
+// cacheFile returns the file a named cache persists to under dir, or "" when dir is empty.
+func cacheFile(dir, name string) string {
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, name+".json")
+}
+
+// cacheKey joins the parts of a request into a key, normalising the free-text query so that
+// "The  Matrix" and "the matrix" share an entry.
+func cacheKey(query string, params ...any) string {
+	parts := []string{strings.ToLower(strings.Join(strings.Fields(query), " "))}
+	for _, p := range params {
+		parts = append(parts, fmt.Sprint(p))
+	}
+	return strings.Join(parts, "|")
+}
+
+// CachingImdbSearcher is an ImdbSearcher decorator that caches successful responses.
+type CachingImdbSearcher struct {
+	Searcher ImdbSearcher
+
+	search  *ttlCache[*SearchPage]
+	lookup  *ttlCache[*SearchResult]
+	details *ttlCache[*TitleDetails]
+	season  *ttlCache[*SeasonDetails]
+}
+
+// NewCachingImdbSearcher caches searcher's responses for ttl. When dir is not empty the caches
+// are persisted there and survive restarts.
+func NewCachingImdbSearcher(searcher ImdbSearcher, ttl time.Duration, dir string) *CachingImdbSearcher {
+	return &CachingImdbSearcher{
+		Searcher: searcher,
+		search:   newTTLCache[*SearchPage](ttl, cacheFile(dir, "titles-search")),
+		lookup:   newTTLCache[*SearchResult](ttl, cacheFile(dir, "titles-lookup")),
+		details:  newTTLCache[*TitleDetails](ttl, cacheFile(dir, "titles-details")),
+		season:   newTTLCache[*SeasonDetails](ttl, cacheFile(dir, "titles-season")),
+	}
+}
+
+// Search returns a copy of the cached page, so callers may modify it.
+func (c *CachingImdbSearcher) Search(ctx context.Context, query SearchQuery) (*SearchPage, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	key := cacheKey(query.Query, query.Page, query.Type, query.Year)
+	page, err := c.search.get(ctx, key, func(ctx context.Context) (*SearchPage, error) {
+		return c.Searcher.Search(ctx, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cp := *page
+	cp.Results = append([]SearchResult(nil), page.Results...)
+	return &cp, nil
+}
+
+func (c *CachingImdbSearcher) LookupByID(ctx context.Context, imdbID string) (*SearchResult, error) {
+	result, err := c.lookup.get(ctx, cacheKey(imdbID), func(ctx context.Context) (*SearchResult, error) {
+		return c.Searcher.LookupByID(ctx, imdbID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cp := *result
+	return &cp, nil
+}
+
+// Details returns the cached details; callers must not modify their slices.
+func (c *CachingImdbSearcher) Details(ctx context.Context, imdbID string) (*TitleDetails, error) {
+	details, err := c.details.get(ctx, cacheKey(imdbID), func(ctx context.Context) (*TitleDetails, error) {
+		return c.Searcher.Details(ctx, imdbID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cp := *details
+	return &cp, nil
+}
+
+// Season returns the cached season; callers must not modify its episodes.
+func (c *CachingImdbSearcher) Season(ctx context.Context, imdbID string, season int) (*SeasonDetails, error) {
+	details, err := c.season.get(ctx, cacheKey(imdbID, season), func(ctx context.Context) (*SeasonDetails, error) {
+		return c.Searcher.Season(ctx, imdbID, season)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cp := *details
+	return &cp, nil
+}
+
+// Flush writes entries not yet persisted to the cache files; call it before exiting.
+func (c *CachingImdbSearcher) Flush() {
+	c.search.flush()
+	c.lookup.flush()
+	c.details.flush()
+	c.season.flush()
+}
+
+func (c *CachingImdbSearcher) CacheStats() map[string]CacheStats {
+	return map[string]CacheStats{
+		"titles.search":  c.search.stats(),
+		"titles.lookup":  c.lookup.stats(),
+		"titles.details": c.details.stats(),
+		"titles.season":  c.season.stats(),
+	}
+}
+
+// CachingTorrentSearcher is a TorrentSearcher decorator that caches complete result lists.
+// Partial results, where some providers failed, are passed through uncached so that a later
+// search can pick up the missing providers.
+type CachingTorrentSearcher struct {
+	Searcher TorrentSearcher
+
+	search *ttlCache[[]TorrentSearchResult]
+}
+
+// NewCachingTorrentSearcher caches searcher's results for ttl. When dir is not empty the cache
+// is persisted there and survives restarts.
+func NewCachingTorrentSearcher(searcher TorrentSearcher, ttl time.Duration, dir string) *CachingTorrentSearcher {
+	return &CachingTorrentSearcher{
+		Searcher: searcher,
+		search:   newTTLCache[[]TorrentSearchResult](ttl, cacheFile(dir, "torrents-search")),
+	}
+}
+
+// errPartialResults carries partial results out of a cache fetch without caching them.
+type errPartialResults struct {
+	results []TorrentSearchResult
+	err     *PartialSearchError
+}
+
+func (e *errPartialResults) Error() string { return e.err.Error() }
+
+// SearchTorrents returns a copy of the cached results, so callers may reorder them.
+func (c *CachingTorrentSearcher) SearchTorrents(ctx context.Context, query string, page int, orderBy TorrentSortOrder) ([]TorrentSearchResult, error) {
+	return c.cached(ctx, cacheKey(query, page, orderBy), func(ctx context.Context) ([]TorrentSearchResult, error) {
+		return c.Searcher.SearchTorrents(ctx, query, page, orderBy)
+	})
+}
+
+// SearchTitleTorrents searches by ID when the wrapped searcher supports it; otherwise it is
+// SearchTorrents with the query's text, sharing its cache entries.
+func (c *CachingTorrentSearcher) SearchTitleTorrents(ctx context.Context, q TitleTorrentQuery) ([]TorrentSearchResult, error) {
+	if _, ok := c.Searcher.(TitleTorrentSearcher); !ok {
+		return c.SearchTorrents(ctx, q.String(), 0, SortBySeeders)
+	}
+	key := cacheKey("title", q.ImdbID, q.Title, q.Year, q.Season, q.Episode)
+	return c.cached(ctx, key, func(ctx context.Context) ([]TorrentSearchResult, error) {
+		return searchTitleTorrents(ctx, c.Searcher, q)
+	})
+}
+
+// cached returns a copy of the results cached under key, fetching them on a miss. Partial
+// results are returned with their *PartialSearchError but not cached.
+func (c *CachingTorrentSearcher) cached(ctx context.Context, key string, fetch func(context.Context) ([]TorrentSearchResult, error)) ([]TorrentSearchResult, error) {
+	results, err := c.search.get(ctx, key, func(ctx context.Context) ([]TorrentSearchResult, error) {
+		results, err := fetch(ctx)
+		var partial *PartialSearchError
+		if errors.As(err, &partial) {
+			return nil, &errPartialResults{results: results, err: partial}
+		}
+		return results, err
+	})
+	var partial *errPartialResults
+	if errors.As(err, &partial) {
+		return append([]TorrentSearchResult(nil), partial.results...), partial.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append([]TorrentSearchResult(nil), results...), nil
+}
+
+// Flush writes entries not yet persisted to the cache file; call it before exiting.
+func (c *CachingTorrentSearcher) Flush() {
+	c.search.flush()
+}
+
+func (c *CachingTorrentSearcher) CacheStats() map[string]CacheStats {
+	return map[string]CacheStats{"torrents.search": c.search.stats()}
+}
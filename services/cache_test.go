@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTTLCacheHitsAndMisses(t *testing.T) {
+	c := newTTLCache[string](time.Minute, "")
+	var calls int
+	fetch := func(ctx context.Context) (string, error) {
+		calls++
+		return fmt.Sprint("value ", calls), nil
+	}
+	for i := 0; i < 3; i++ {
+		v, err := c.get(context.Background(), "k", fetch)
+		if err != nil || v != "value 1" {
+			t.Fatalf("get = %q, %v; want the first fetch's value", v, err)
+		}
+	}
+	if stats := c.stats(); stats != (CacheStats{Hits: 2, Misses: 1, Entries: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// Expired entries are fetched again.
+	c.mu.Lock()
+	c.entries["k"] = cacheEntry[string]{Value: "old", Expires: time.Now().Add(-time.Second)}
+	c.mu.Unlock()
+	if v, _ := c.get(context.Background(), "k", fetch); v != "value 2" {
+		t.Errorf("get after expiry = %q, want a new fetch", v)
+	}
+}
+
+func TestTTLCacheDoesNotCacheErrors(t *testing.T) {
+	c := newTTLCache[string](time.Minute, "")
+	failure := errors.New("upstream down")
+	if _, err := c.get(context.Background(), "k", func(ctx context.Context) (string, error) { return "", failure }); !errors.Is(err, failure) {
+		t.Fatalf("got %v, want the fetch error", err)
+	}
+	v, err := c.get(context.Background(), "k", func(ctx context.Context) (string, error) { return "ok", nil })
+	if err != nil || v != "ok" {
+		t.Errorf("get after a failure = %q, %v; want a new fetch", v, err)
+	}
+}
+
+func TestTTLCacheCoalescesMisses(t *testing.T) {
+	c := newTTLCache[string](time.Minute, "")
+	release := make(chan struct{})
+	var calls atomic.Int32
+	fetch := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		<-release
+		return "v", nil
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.get(context.Background(), "k", fetch); err != nil || v != "v" {
+				errs <- fmt.Errorf("get = %q, %v", v, err)
+			}
+		}()
+	}
+	// Let every caller join the fetch before it completes.
+	for c.misses.Load() < callers {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fetched %d times, want once", n)
+	}
+}
+
+func TestTTLCacheFetchOutlivesCallerWithinTimeout(t *testing.T) {
+	c := newTTLCache[string](time.Minute, "")
+	c.fetchTimeout = 50 * time.Millisecond
+
+	// The caller gives up, but the fetch carries on until its own timeout.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fetchErr := make(chan error, 1)
+	_, err := c.get(ctx, "k", func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		fetchErr <- ctx.Err()
+		return "", ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("caller got %v, want its own cancellation", err)
+	}
+	select {
+	case err := <-fetchErr:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("fetch ended with %v, want its timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the fetch ran past its timeout")
+	}
+}
+
+func TestTTLCachePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "test.json")
+	c := newTTLCache[[]string](time.Hour, path)
+	c.saveDelay = time.Hour // Only the explicit flush writes
+	for _, key := range []string{"a", "b"} {
+		if _, err := c.get(context.Background(), key, func(ctx context.Context) ([]string, error) {
+			return []string{key, key}, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reloaded := newTTLCache[[]string](time.Hour, path); len(reloaded.entries) != 0 {
+		t.Errorf("saved before the delay: %v", reloaded.entries)
+	}
+
+	c.flush()
+	reloaded := newTTLCache[[]string](time.Hour, path)
+	v, err := reloaded.get(context.Background(), "b", func(ctx context.Context) ([]string, error) {
+		return nil, errors.New("fetched despite the persisted entry")
+	})
+	if err != nil || !reflect.DeepEqual(v, []string{"b", "b"}) {
+		t.Errorf("reloaded get = %v, %v", v, err)
+	}
+
+	// Expired entries aren't reloaded.
+	expiredPath := filepath.Join(t.TempDir(), "expired.json")
+	expired := newTTLCache[[]string](-time.Second, expiredPath)
+	expired.get(context.Background(), "c", func(ctx context.Context) ([]string, error) { return []string{"c"}, nil })
+	expired.flush()
+	if entries := newTTLCache[[]string](time.Hour, expiredPath).entries; len(entries) != 0 {
+		t.Errorf("reloaded expired entries: %v", entries)
+	}
+}
+
+func TestTTLCacheEvicts(t *testing.T) {
+	c := newTTLCache[int](time.Hour, "")
+	now := time.Now()
+	for i := 0; i < maxCacheEntries; i++ {
+		c.entries[fmt.Sprint(i)] = cacheEntry[int]{Value: i, Expires: now.Add(time.Duration(i+1) * time.Second)}
+	}
+	c.entries["expired"] = cacheEntry[int]{Expires: now.Add(-time.Second)}
+	c.store("new", -1)
+
+	if n := len(c.entries); n != maxCacheEntries*9/10+1 {
+		t.Errorf("%d entries after eviction, want %d", n, maxCacheEntries*9/10+1)
+	}
+	for _, key := range []string{"expired", "0", fmt.Sprint(maxCacheEntries/10 - 1)} {
+		if _, ok := c.entries[key]; ok {
+			t.Errorf("entry %s survived eviction", key)
+		}
+	}
+	for _, key := range []string{fmt.Sprint(maxCacheEntries / 10), fmt.Sprint(maxCacheEntries - 1), "new"} {
+		if _, ok := c.entries[key]; !ok {
+			t.Errorf("entry %s was evicted", key)
+		}
+	}
+}
+
+// countingSearcher is a TorrentSearcher returning partial results until told otherwise.
+type countingSearcher struct {
+	calls   int
+	partial bool
+}
+
+func (s *countingSearcher) SearchTorrents(ctx context.Context, query string, page int, orderBy TorrentSortOrder) ([]TorrentSearchResult, error) {
+	s.calls++
+	results := []TorrentSearchResult{{Title: query, InfoHash: "aa"}}
+	if s.partial {
+		return results, &PartialSearchError{Failures: []ProviderError{{Provider: "torznab", Message: "timed out"}}}
+	}
+	return results, nil
+}
+
+func TestCachingTorrentSearcherSkipsPartialResults(t *testing.T) {
+	searcher := &countingSearcher{partial: true}
+	c := NewCachingTorrentSearcher(searcher, time.Minute, "")
+
+	results, err := c.SearchTorrents(context.Background(), "movie", 0, SortBySeeders)
+	var partial *PartialSearchError
+	if !errors.As(err, &partial) || len(results) != 1 {
+		t.Fatalf("got %v, %v; want the partial results and their error", results, err)
+	}
+
+	// Partial results weren't cached: the next search asks again, and caches a full answer.
+	searcher.partial = false
+	for i := 0; i < 2; i++ {
+		if _, err := c.SearchTorrents(context.Background(), "Movie", 0, SortBySeeders); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if searcher.calls != 2 {
+		t.Errorf("searched %d times, want 2", searcher.calls)
+	}
+
+	// Callers get copies they may modify.
+	results, _ = c.SearchTorrents(context.Background(), "movie", 0, SortBySeeders)
+	results[0].Title = "changed"
+	if again, _ := c.SearchTorrents(context.Background(), "movie", 0, SortBySeeders); again[0].Title != "Movie" {
+		t.Errorf("cached results were modified: %+v", again)
+	}
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dashManifestName is the DASH manifest written next to the HLS playlists of fMP4 streams.
+const dashManifestName = "manifest.mpd"
+
+// mpdManifest is the root of a DASH manifest, limited to what this service emits: one period whose
+// representations reference the fMP4 segments ffmpeg wrote for HLS, via SegmentList.
+type mpdManifest struct {
+	XMLName                   xml.Name  `xml:"MPD"`
+	XMLNS                     string    `xml:"xmlns,attr"`
+	Profiles                  string    `xml:"profiles,attr"`
+	Type                      string    `xml:"type,attr"`
+	MinBufferTime             string    `xml:"minBufferTime,attr"`
+	MediaPresentationDuration string    `xml:"mediaPresentationDuration,attr,omitempty"`
+	AvailabilityStartTime     string    `xml:"availabilityStartTime,attr,omitempty"`
+	PublishTime               string    `xml:"publishTime,attr,omitempty"`
+	MinimumUpdatePeriod       string    `xml:"minimumUpdatePeriod,attr,omitempty"`
+	TimeShiftBufferDepth      string    `xml:"timeShiftBufferDepth,attr,omitempty"`
+	Period                    mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	ID             string             `xml:"id,attr"`
+	Start          string             `xml:"start,attr"`
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	ID               int                 `xml:"id,attr"`
+	ContentType      string              `xml:"contentType,attr,omitempty"`
+	MimeType         string              `xml:"mimeType,attr"`
+	Lang             string              `xml:"lang,attr,omitempty"`
+	SegmentAlignment bool                `xml:"segmentAlignment,attr"`
+	Role             *mpdDescriptor      `xml:"Role,omitempty"`
+	Label            string              `xml:"Label,omitempty"`
+	Representations  []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdDescriptor struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type mpdRepresentation struct {
+	ID                string         `xml:"id,attr"`
+	Bandwidth         int64          `xml:"bandwidth,attr"`
+	Codecs            string         `xml:"codecs,attr,omitempty"`
+	Width             int            `xml:"width,attr,omitempty"`
+	Height            int            `xml:"height,attr,omitempty"`
+	AudioChannelCount *mpdDescriptor `xml:"AudioChannelConfiguration,omitempty"`
+	SegmentList       mpdSegmentList `xml:"SegmentList"`
+}
+
+type mpdSegmentList struct {
+	Timescale      int                `xml:"timescale,attr"`
+	Initialization *mpdInitialization `xml:"Initialization,omitempty"`
+	Timeline       []mpdTimelineEntry `xml:"SegmentTimeline>S"`
+	SegmentURLs    []mpdSegmentURL    `xml:"SegmentURL"`
+}
+
+type mpdInitialization struct {
+	SourceURL string `xml:"sourceURL,attr"`
+}
+
+type mpdTimelineEntry struct {
+	D int64 `xml:"d,attr"`
+}
+
+type mpdSegmentURL struct {
+	Media string `xml:"media,attr"`
+}
+
+// dashTimescale is the SegmentList timescale, in ticks per second.
+const dashTimescale = 1000
+
+// writeDASHManifest builds manifest.mpd from the stream's current fMP4 HLS playlists. While
+// ffmpeg is still writing segments the manifest is dynamic, with every segment written so far
+// inside the time-shift window so playback can start from the beginning; once all renditions
+// have ended it becomes static. Subtitles are not included: DASH players expect WebVTT as a
+// single file or wrapped in fMP4, not as the plain segments written for HLS.
+func (s *HlsService) writeDASHManifest(streamID string) error {
+	s.mu.RLock()
+	info, ok := s.streams[streamID]
+	if !ok {
+		s.mu.RUnlock()
+		return ErrStreamNotFound
+	}
+	hlsDir := info.HlsDir
+	probe := info.Probe
+	audioTracks := append([]AudioTrack(nil), info.AudioTracks...)
+	profile, _ := LookupTranscodeProfile(info.Options.Profile)
+	s.mu.RUnlock()
+
+	if profile.SegmentType != SegmentFMP4 {
+		return fmt.Errorf("stream %s uses %s segments; DASH needs an fMP4 profile", streamID, profile.SegmentType)
+	}
+	if _, muxed := muxedAudioTrack(audioTracks); muxed {
+		return fmt.Errorf("stream %s carries its audio in the video segments; DASH needs separate renditions", streamID)
+	}
+	if hlsDir == "" {
+		return fmt.Errorf("stream %s has not started transcoding yet", streamID)
+	}
+
+	video, err := readMediaPlaylist(filepath.Join(hlsDir, mediaPlaylistName))
+	if err != nil {
+		return fmt.Errorf("video playlist not available yet: %w", err)
+	}
+
+	ended := video.Ended
+	duration := video.TotalDuration()
+	videoRep := dashRepresentation("video", hlsDir, "", video)
+	if videos := probe.StreamsOfType("video"); len(videos) > 0 {
+		videoRep.Width, videoRep.Height = videos[0].Width, videos[0].Height
+	}
+	sets := []mpdAdaptationSet{{
+		ID:               0,
+		ContentType:      "video",
+		MimeType:         "video/mp4",
+		SegmentAlignment: true,
+		Representations:  []mpdRepresentation{videoRep},
+	}}
+
+	for _, track := range audioTracks {
+		playlistPath := track.PlaylistPath()
+		if playlistPath == "" {
+			continue
+		}
+		audio, err := readMediaPlaylist(filepath.Join(hlsDir, filepath.FromSlash(playlistPath)))
+		if err != nil {
+			// ffmpeg may not have written this rendition's first segment yet.
+			ended = false
+			continue
+		}
+		ended = ended && audio.Ended
+		rep := dashRepresentation(track.ID, hlsDir, path.Dir(playlistPath), audio)
+		if track.Channels > 0 {
+			rep.AudioChannelCount = &mpdDescriptor{
+				SchemeIDURI: "urn:mpeg:dash:23003:3:audio_channel_configuration:2011",
+				Value:       fmt.Sprint(track.Channels),
+			}
+		}
+		set := mpdAdaptationSet{
+			ID:               len(sets),
+			ContentType:      "audio",
+			MimeType:         "audio/mp4",
+			Lang:             track.Language,
+			SegmentAlignment: true,
+			Label:            track.Name,
+			Representations:  []mpdRepresentation{rep},
+		}
+		if track.Default {
+			set.Role = &mpdDescriptor{SchemeIDURI: "urn:mpeg:dash:role:2011", Value: "main"}
+		}
+		sets = append(sets, set)
+	}
+
+	mpd := mpdManifest{
+		XMLNS:         "urn:mpeg:dash:schema:mpd:2011",
+		Profiles:      "urn:mpeg:dash:profile:isoff-live:2011",
+		MinBufferTime: dashDuration(2 * time.Second),
+		Period:        mpdPeriod{ID: "0", Start: "PT0S", AdaptationSets: sets},
+	}
+	total := time.Duration(duration * float64(time.Second))
+	if ended {
+		mpd.Type = "static"
+		mpd.MediaPresentationDuration = dashDuration(total)
+	} else {
+		now := time.Now().UTC()
+		mpd.Type = "dynamic"
+		mpd.AvailabilityStartTime = now.Add(-total).Format(time.RFC3339)
+		mpd.PublishTime = now.Format(time.RFC3339)
+		mpd.MinimumUpdatePeriod = dashDuration(hlsSegmentSeconds * time.Second)
+		mpd.TimeShiftBufferDepth = dashDuration(total)
+	}
+
+	out, err := xml.MarshalIndent(mpd, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode DASH manifest: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(hlsDir, dashManifestName), append([]byte(xml.Header), out...))
+}
+
+// dashRepresentation converts a media playlist into a Representation. URIs in the playlist are
+// relative to its own directory (dir, relative to the HLS directory), while the manifest sits at
+// the top of the HLS directory.
+func dashRepresentation(id, hlsDir, dir string, playlist *mediaPlaylist) mpdRepresentation {
+	resolve := func(uri string) string {
+		if dir == "" || dir == "." {
+			return uri
+		}
+		return dir + "/" + uri
+	}
+
+	rep := mpdRepresentation{ID: id, SegmentList: mpdSegmentList{Timescale: dashTimescale}}
+	if playlist.InitURI != "" {
+		rep.SegmentList.Initialization = &mpdInitialization{SourceURL: resolve(playlist.InitURI)}
+		rep.Codecs = codecStringFromInitSegment(filepath.Join(hlsDir, filepath.FromSlash(resolve(playlist.InitURI))))
+	}
+
+	// The first S element's t defaults to 0 and each following one starts where the previous ended.
+	var totalTicks, totalBytes int64
+	for _, seg := range playlist.Segments {
+		d := int64(seg.Duration * dashTimescale)
+		rep.SegmentList.Timeline = append(rep.SegmentList.Timeline, mpdTimelineEntry{D: d})
+		rep.SegmentList.SegmentURLs = append(rep.SegmentList.SegmentURLs, mpdSegmentURL{Media: resolve(seg.URI)})
+		totalTicks += d
+		if fi, err := os.Stat(filepath.Join(hlsDir, filepath.FromSlash(resolve(seg.URI)))); err == nil {
+			totalBytes += fi.Size()
+		}
+	}
+	// Advertise the measured bit rate; players only use it to choose between representations.
+	if totalTicks > 0 {
+		rep.Bandwidth = totalBytes * 8 * dashTimescale / totalTicks
+	}
+	if rep.Bandwidth <= 0 {
+		rep.Bandwidth = defaultVariantBandwidth
+	}
+	return rep
+}
+
+// dashDuration formats d as an xs:duration, e.g. "PT12.5S".
+func dashDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%sS", strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.3f", d.Seconds()), "0"), "."))
+}
+
+// ServeDASH serves DASH manifests and segments under /dash/{streamID}/. The segments are the
+// same fMP4 files served under /hls/; manifest.mpd is regenerated on request while transcoding.
+func (s *HlsService) ServeDASH(w http.ResponseWriter, r *http.Request) {
+	streamID, fileName, ok := splitStreamPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	stream, ok := s.GetStreamInfo(streamID)
+	if !ok {
+		log.Printf("Stream not found or not ready: %s", streamID)
+		http.NotFound(w, r)
+		return
+	}
+
+	if fileName == dashManifestName && r.Method != http.MethodOptions {
+		s.mu.RLock()
+		done := stream.State == StateReady
+		s.mu.RUnlock()
+		_, statErr := os.Stat(filepath.Join(stream.HlsDir, dashManifestName))
+		if !done || statErr != nil {
+			if err := s.writeDASHManifest(streamID); err != nil {
+				log.Printf("[%s] DASH manifest unavailable: %v", streamID, err)
+				http.NotFound(w, r)
+				return
+			}
+		}
+	}
+
+	s.serveStreamFile(w, r, stream, fileName)
+}
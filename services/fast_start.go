@@ -0,0 +1,166 @@
+package services
+
+import (
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hlsSegmenting controls how the hls muxer cuts and publishes segments.
+type hlsSegmenting struct {
+	SegmentSeconds int    // -hls_time
+	PlaylistType   string // -hls_playlist_type, or empty for ffmpeg's default
+}
+
+// defaultSegmenting is used for regular streams.
+var defaultSegmenting = hlsSegmenting{SegmentSeconds: hlsSegmentSeconds}
+
+// fastStartSegmenting is used for fast-start streams. The hls muxer cuts at the first keyframe
+// past each multiple of SegmentSeconds, so with keyframes forced only at fastStartBoundaries
+// every forced keyframe starts a new segment.
+var fastStartSegmenting = hlsSegmenting{SegmentSeconds: fastStartRamp[0], PlaylistType: "event"}
+
+// fastStartRamp lists the durations of the first segments of a fast-start stream, after
+// which segments are hlsSegmentSeconds long. The first segment is playable after ~2s of video.
+// The default audio track is muxed into those segments; the ramp adds up to
+// hlsSegmentSeconds, so every multiple of it, where other audio renditions are cut, is also a
+// video boundary.
+var fastStartRamp = []int{2, 3, 5}
+
+// fastStartFallbackDuration bounds the keyframe list when the source duration is unknown.
+const fastStartFallbackDuration = 4 * 60 * 60
+
+// alternateAudioSegmenting returns the segmenting for audio-only renditions of a stream
+// segmented as video. Every audio frame is a keyframe, so the muxer cuts audio at each multiple
+// of SegmentSeconds and can't follow the ramp; audio keeps hlsSegmentSeconds instead. This is
+// why fast-start streams mux their default audio with the video.
+func alternateAudioSegmenting(video hlsSegmenting) hlsSegmenting {
+	return hlsSegmenting{SegmentSeconds: hlsSegmentSeconds, PlaylistType: video.PlaylistType}
+}
+
+// fastStartBoundaries returns the segment start times, in seconds, for a source of the given
+// duration: the ramp, then one every hlsSegmentSeconds.
+func fastStartBoundaries(duration float64) []int {
+	if duration <= 0 {
+		duration = fastStartFallbackDuration
+	}
+	boundaries := []int{0}
+	t := 0
+	for _, d := range fastStartRamp {
+		t += d
+		boundaries = append(boundaries, t)
+	}
+	for t += hlsSegmentSeconds; float64(t) < duration; t += hlsSegmentSeconds {
+		boundaries = append(boundaries, t)
+	}
+	return boundaries
+}
+
+// fastStartKeyframeArgs returns encoder options that place keyframes only at the fast-start
+// segment boundaries, so the first segments are short and later ones have the normal length.
+func fastStartKeyframeArgs(duration float64) []string {
+	boundaries := fastStartBoundaries(duration)
+	times := make([]string, len(boundaries))
+	for i, b := range boundaries {
+		times[i] = strconv.Itoa(b)
+	}
+	return []string{
+		"-force_key_frames", strings.Join(times, ","),
+		"-g", "100000", // No periodic keyframes in between...
+		"-sc_threshold", "0", // ...nor scene-cut ones
+	}
+}
+
+// firstSegmentPollInterval is how often the HLS directory is checked for the first segment.
+const firstSegmentPollInterval = 200 * time.Millisecond
+
+// firstSegmentPlaylists returns the media playlists, relative to the HLS directory, that
+// must list a segment before a player can start: the main one and, when the default audio
+// track has its own rendition, that one too.
+func firstSegmentPlaylists(audioTracks []AudioTrack) []string {
+	playlists := []string{mediaPlaylistName}
+	for _, track := range audioTracks {
+		if track.Default && !track.Muxed {
+			playlists = append(playlists, track.PlaylistPath())
+		}
+	}
+	return playlists
+}
+
+// hasFirstSegments reports whether every playlist lists at least one segment.
+func hasFirstSegments(hlsDir string, playlists []string) bool {
+	for _, name := range playlists {
+		playlist, err := readMediaPlaylist(filepath.Join(hlsDir, filepath.FromSlash(name)))
+		if err != nil || len(playlist.Segments) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// watchFirstSegment polls the playlists until each lists a segment, then records the stream's
+// codecs and time to first segment. It gives up when done is closed.
+func (s *HlsService) watchFirstSegment(streamID, hlsDir string, playlists []string, done <-chan struct{}) {
+	ticker := time.NewTicker(firstSegmentPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if !hasFirstSegments(hlsDir, playlists) {
+			continue
+		}
+
+		s.setVariantCodecs(streamID, hlsDir)
+
+		now := time.Now()
+		s.mu.Lock()
+		info, ok := s.streams[streamID]
+		var ttfs time.Duration
+		if ok {
+			info.FirstSegmentAt = now
+			ttfs = now.Sub(info.AddedAt)
+			s.metrics.recordFirstSegment(ttfs)
+		}
+		s.mu.Unlock()
+		if ok {
+			log.Printf("[%s] First segment ready after %s; stream is playable", streamID, ttfs.Round(time.Millisecond))
+		}
+		return
+	}
+}
+
+// setVariantCodecs records the codecs of an fMP4 stream, whose init segment now exists, and
+// rewrites its master playlist with them before the stream is reported playable.
+func (s *HlsService) setVariantCodecs(streamID, hlsDir string) {
+	s.mu.RLock()
+	info, ok := s.streams[streamID]
+	var fmp4, hasAudio bool
+	if ok {
+		profile, _ := LookupTranscodeProfile(info.Options.Profile)
+		fmp4, hasAudio = profile.SegmentType == SegmentFMP4, len(info.AudioTracks) > 0
+	}
+	s.mu.RUnlock()
+	if !fmp4 {
+		return
+	}
+
+	codecs := variantCodecs(hlsDir, hasAudio)
+	if codecs == "" {
+		log.Printf("[%s] Could not determine the video codec from the init segment; the master playlist lists no CODECS", streamID)
+		return
+	}
+	s.mu.Lock()
+	if info, ok := s.streams[streamID]; ok {
+		info.Codecs = codecs
+	}
+	s.mu.Unlock()
+	if err := s.writeMasterPlaylist(streamID); err != nil {
+		log.Printf("[%s] Failed to add CODECS to the master playlist: %v", streamID, err)
+	}
+}
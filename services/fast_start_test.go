@@ -0,0 +1,91 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFastStartBoundaries(t *testing.T) {
+	if got, want := fastStartBoundaries(45), []int{0, 2, 5, 10, 20, 30, 40}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fastStartBoundaries(45) = %v, want %v", got, want)
+	}
+}
+
+func TestFastStartAudioAlignsWithVideo(t *testing.T) {
+	audio := alternateAudioSegmenting(fastStartSegmenting)
+	if audio.PlaylistType != fastStartSegmenting.PlaylistType {
+		t.Errorf("audio playlist type = %q, want %q", audio.PlaylistType, fastStartSegmenting.PlaylistType)
+	}
+	// Audio is cut at every multiple of its segment length; each cut must start a video segment.
+	video := map[int]bool{}
+	for _, b := range fastStartBoundaries(3600) {
+		video[b] = true
+	}
+	for t0 := 0; t0 < 3600; t0 += audio.SegmentSeconds {
+		if !video[t0] {
+			t.Errorf("audio segment at %ds has no matching video boundary", t0)
+		}
+	}
+}
+
+func TestFirstSegmentPlaylists(t *testing.T) {
+	tests := []struct {
+		name   string
+		tracks []AudioTrack
+		want   []string
+	}{
+		{"no audio", nil, []string{"playlist.m3u8"}},
+		{"muxed default", []AudioTrack{{ID: "audio1", Default: true, Muxed: true}, {ID: "audio2"}}, []string{"playlist.m3u8"}},
+		{"separate default", []AudioTrack{{ID: "audio1"}, {ID: "audio2", Default: true}}, []string{"playlist.m3u8", "audio/audio2.m3u8"}},
+	}
+	for _, tt := range tests {
+		if got := firstSegmentPlaylists(tt.tracks); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: firstSegmentPlaylists = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHasFirstSegments(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, audioDirName), 0750); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	playlists := []string{mediaPlaylistName, "audio/audio1.m3u8"}
+
+	write(mediaPlaylistName, "#EXTM3U\n#EXTINF:2.000,\nsegment0.m4s\n")
+	if hasFirstSegments(dir, playlists) {
+		t.Error("ready without the audio playlist")
+	}
+	write("audio/audio1.m3u8", "#EXTM3U\n#EXT-X-TARGETDURATION:10\n")
+	if hasFirstSegments(dir, playlists) {
+		t.Error("ready with an empty audio playlist")
+	}
+	write("audio/audio1.m3u8", "#EXTM3U\n#EXTINF:10.000,\naudio1_0.m4s\n")
+	if !hasFirstSegments(dir, playlists) {
+		t.Error("not ready with a segment in every playlist")
+	}
+}
+
+func TestSupportsDASH(t *testing.T) {
+	tests := []struct {
+		opts StreamOptions
+		want bool
+	}{
+		{StreamOptions{Profile: "cmaf"}, true},
+		{StreamOptions{Profile: "cmaf", FastStart: true}, false}, // Default audio is muxed
+		{StreamOptions{Profile: "ts"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.SupportsDASH(); got != tt.want {
+			t.Errorf("%+v.SupportsDASH() = %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,9 +12,13 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"torrent-play/release"
+
 	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
 )
 
 type StreamState string
@@ -27,26 +32,109 @@ const (
 	StateError        StreamState = "error"
 )
 
+// StreamOptions holds the per-stream choices made when a stream is added.
+type StreamOptions struct {
+	// Audio is the language (code or name) of the audio track to play by default.
+	// Empty means the container's default track.
+	Audio string
+	// BurnSubtitle selects a subtitle to burn into the video, by language or by subtitle
+	// stream index within the container. Empty means no burn-in.
+	BurnSubtitle string
+	// Profile names the TranscodeProfile to package the stream with. Empty means the default.
+	Profile string
+	// FastStart cuts short first segments that ramp up to the normal duration and publishes
+	// an EVENT playlist, so playback can begin a few seconds after the video starts arriving.
+	FastStart bool
+}
+
+// SupportsDASH reports whether a stream with these options gets a DASH manifest: it needs an
+// fMP4 profile, and fast-start streams carry their default audio in the video segments, which
+// DASH players can't split into their own buffers.
+func (o StreamOptions) SupportsDASH() bool {
+	profile, _ := LookupTranscodeProfile(o.Profile)
+	return profile.SegmentType == SegmentFMP4 && !o.FastStart
+}
+
+// cacheKey identifies the output a set of options produces for a torrent, so that adding
+// the same torrent again with the same options reuses the existing stream.
+func (o StreamOptions) cacheKey(magnetURI string) string {
+	source := magnetURI
+	if m, err := metainfo.ParseMagnetUri(magnetURI); err == nil {
+		source = m.InfoHash.HexString()
+	}
+	profile, _ := LookupTranscodeProfile(o.Profile)
+	return fmt.Sprintf("%s|audio=%s|burn=%s|profile=%s|fast=%t", source, normalizeLanguageKey(o.Audio), normalizeLanguageKey(o.BurnSubtitle), profile.Name, o.FastStart)
+}
+
+// normalizeLanguageKey maps equivalent language spellings ("eng", "en", "English") to one value.
+func normalizeLanguageKey(v string) string {
+	if info, ok := lookupLanguage(v); ok {
+		return info.Tag
+	}
+	return strings.ToLower(strings.TrimSpace(v))
+}
+
 type StreamInfo struct {
-	ID        string
-	MagnetURI string
-	State     StreamState
-	HlsDir    string
-	Error     error
-	Torrent   *torrent.Torrent
-	File      *torrent.File
+	ID          string
+	MagnetURI   string
+	Options     StreamOptions
+	CacheKey    string
+	State       StreamState
+	HlsDir      string
+	Error       error
+	Torrent     *torrent.Torrent
+	File        *torrent.File
+	Release     *release.Info // Parsed from the selected file's path, or the torrent name
+	Probe       *MediaProbe
+	AudioTracks []AudioTrack
+	Subtitles   []SubtitleTrack
+	Thumbnails  bool // Whether trickplay sprites and a poster are being written under thumbs/
+	// Codecs is the variant's RFC 6381 codecs list for the master playlist, read from the
+	// fMP4 init segment once it exists. Empty for MPEG-TS streams or when it can't be read.
+	Codecs string
+
+	// FastStartIgnored is set when fast start was requested but the video is copied, which
+	// can only be cut at the source's keyframes.
+	FastStartIgnored bool
+
+	AddedAt        time.Time
+	FirstSegmentAt time.Time // Zero until the main media playlist lists its first segment
 }
 
+// hlsSegmentSeconds is the target duration of HLS media and subtitle segments.
+const hlsSegmentSeconds = 10
+
+// ErrStreamNotFound is returned for operations on an unknown stream ID.
+var ErrStreamNotFound = errors.New("stream not found")
+
+// FFmpegPath and FFprobePath are the executables run to transcode and probe streams; bare
+// names are looked up in PATH.
+var (
+	FFmpegPath  = "ffmpeg"
+	FFprobePath = "ffprobe"
+)
+
 type HlsService struct {
 	client      *torrent.Client
 	streams     map[string]*StreamInfo
+	streamKeys  map[string]string // Cache key -> stream ID
 	mu          sync.RWMutex
 	baseTempDir string
 	listenAddr  string
+
+	attachedSubtitles atomic.Int64 // Sequence for IDs of externally attached subtitle tracks
+	metrics           streamMetrics
 }
 
-func NewHlsService(client *torrent.Client, listenAddr string) (*HlsService, error) {
-	tempDir, err := os.MkdirTemp("", "torrent-hls-service")
+// NewHlsService creates the service, writing stream output to a new directory under workDir;
+// an empty workDir means the system temp dir.
+func NewHlsService(client *torrent.Client, listenAddr, workDir string) (*HlsService, error) {
+	if workDir != "" {
+		if err := os.MkdirAll(workDir, 0750); err != nil {
+			return nil, fmt.Errorf("failed to create work dir: %w", err)
+		}
+	}
+	tempDir, err := os.MkdirTemp(workDir, "torrent-hls-service")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create base temp dir: %w", err)
 	}
@@ -55,6 +143,7 @@ func NewHlsService(client *torrent.Client, listenAddr string) (*HlsService, erro
 	return &HlsService{
 		client:      client,
 		streams:     make(map[string]*StreamInfo),
+		streamKeys:  make(map[string]string),
 		baseTempDir: tempDir,
 		listenAddr:  listenAddr,
 	}, nil
@@ -66,16 +155,34 @@ func (s *HlsService) Cleanup() {
 }
 
 // PrepareStream adds a torrent and starts the process to make it streamable via HLS.
-func (s *HlsService) PrepareStream(ctx context.Context, magnetURI string) (*StreamInfo, error) {
+// If a stream for the same torrent and options already exists and hasn't failed, it is returned instead.
+func (s *HlsService) PrepareStream(ctx context.Context, magnetURI string, opts StreamOptions) (*StreamInfo, error) {
+	if _, ok := LookupTranscodeProfile(opts.Profile); !ok {
+		return nil, fmt.Errorf("unknown transcode profile %q", opts.Profile)
+	}
+	cacheKey := opts.cacheKey(magnetURI)
+
 	s.mu.Lock()
+	if existingID, ok := s.streamKeys[cacheKey]; ok {
+		if existing, ok := s.streams[existingID]; ok && existing.State != StateError {
+			s.mu.Unlock()
+			log.Printf("[%s] Reusing existing stream for %s", existingID, cacheKey)
+			return existing, nil
+		}
+	}
 	// Simple ID generation for example purposes. Use something more robust in production.
 	streamID := fmt.Sprintf("%d", time.Now().UnixNano())
 	info := &StreamInfo{
 		ID:        streamID,
 		MagnetURI: magnetURI,
+		Options:   opts,
+		CacheKey:  cacheKey,
 		State:     StateInitializing,
+		AddedAt:   time.Now(),
 	}
 	s.streams[streamID] = info
+	s.streamKeys[cacheKey] = streamID
+	s.metrics.added++
 	s.mu.Unlock()
 
 	log.Printf("[%s] Adding magnet: %s", streamID, magnetURI)
@@ -133,8 +240,14 @@ func (s *HlsService) manageStream(ctx context.Context, streamID string, t *torre
 	}
 	log.Printf("[%s] Selected largest file: %s (%d bytes)", streamID, largestFile.Path(), largestFile.Length())
 
+	info := release.Parse(largestFile.Path())
+	if info.Title == "" {
+		info = release.Parse(t.Name())
+	}
+
 	s.mu.Lock()
 	s.streams[streamID].File = largestFile
+	s.streams[streamID].Release = &info
 	s.mu.Unlock()
 
 	s.updateStreamState(streamID, StateDownloading, nil)
@@ -152,12 +265,127 @@ func (s *HlsService) manageStream(ctx context.Context, streamID string, t *torre
 
 	s.mu.Lock()
 	s.streams[streamID].HlsDir = hlsDir
+	opts := s.streams[streamID].Options
 	s.mu.Unlock()
 
+	// Probe the container so audio and subtitle streams can be mapped. Probing is best effort:
+	// without it we still transcode the default video and audio streams.
+	probeReader := largestFile.NewReader()
+	probe, err := probeMedia(probeReader)
+	probeReader.Close()
+	if err != nil {
+		log.Printf("[%s] Could not probe media streams: %v", streamID, err)
+	}
+
+	profile, _ := LookupTranscodeProfile(opts.Profile)
+
+	audioTracks := audioTracksFromProbe(probe, opts.Audio)
+	if profile.SegmentType == SegmentMPEGTS || opts.FastStart {
+		// MPEG-TS variants carry the default audio alongside the video; CMAF keeps one track per
+		// playlist, except for fast start, where audio must be cut on the video's ramp.
+		for i := range audioTracks {
+			audioTracks[i].Muxed = audioTracks[i].Default
+		}
+	}
+	if hasSeparateAudio(audioTracks) {
+		if err := os.MkdirAll(filepath.Join(hlsDir, audioDirName), 0750); err != nil {
+			s.updateStreamState(streamID, StateError, fmt.Errorf("failed to create audio dir: %w", err))
+			return
+		}
+		log.Printf("[%s] Found %d audio track(s)", streamID, len(audioTracks))
+	}
+
+	sidecars := findSidecarSubtitles(largestFile, t.Files())
+	subtitles := append(embeddedSubtitleTracks(probe), sidecars...)
+
+	var burnIn *burnInSource
+	if opts.BurnSubtitle != "" {
+		burnIn, err = selectBurnInSubtitle(opts.BurnSubtitle, probe, sidecars)
+		if err != nil {
+			s.updateStreamState(streamID, StateError, fmt.Errorf("cannot burn in subtitle: %w", err))
+			return
+		}
+		// The burned-in subtitle is always visible, so don't also offer it as a rendition.
+		kept := subtitles[:0]
+		for _, track := range subtitles {
+			if !burnIn.matchesTrack(track) {
+				kept = append(kept, track)
+			}
+		}
+		subtitles = kept
+	}
+
+	if len(subtitles) > 0 {
+		if err := ensureSubtitlesDir(hlsDir); err != nil {
+			s.updateStreamState(streamID, StateError, fmt.Errorf("failed to create subtitles dir: %w", err))
+			return
+		}
+		log.Printf("[%s] Found %d subtitle track(s)", streamID, len(subtitles))
+	}
+
+	thumbs, hasThumbs := thumbnailGeometryFor(probe)
+	if hasThumbs {
+		if err := os.MkdirAll(filepath.Join(hlsDir, thumbsDirName), 0750); err != nil {
+			s.updateStreamState(streamID, StateError, fmt.Errorf("failed to create thumbnails dir: %w", err))
+			return
+		}
+		if duration := probe.DurationSeconds(); duration > 0 {
+			if err := writeThumbnailsVTT(hlsDir, thumbs, duration); err != nil {
+				log.Printf("[%s] Failed to write thumbnail track: %v", streamID, err)
+			}
+		}
+	}
+
+	s.setProbedTracks(streamID, probe, audioTracks, subtitles, hasThumbs)
+
+	if err := s.writeMasterPlaylist(streamID); err != nil {
+		s.updateStreamState(streamID, StateError, fmt.Errorf("failed to write master playlist: %w", err))
+		return
+	}
+
+	// Sidecar files are small and independent of the video, so convert them alongside the transcode.
+	for _, track := range subtitles {
+		if track.Source != SubtitleSidecar {
+			continue
+		}
+		go func(track SubtitleTrack) {
+			if err := convertSidecarSubtitle(streamID, hlsDir, track); err != nil {
+				log.Printf("[%s] Subtitle %s unavailable: %v", streamID, track.ID, err)
+			}
+		}(track)
+	}
+
+	job := transcodeJob{
+		streamID:    streamID,
+		file:        largestFile,
+		hlsDir:      hlsDir,
+		profile:     profile,
+		segmenting:  defaultSegmenting,
+		duration:    probe.DurationSeconds(),
+		audioTracks: audioTracks,
+		subtitles:   subtitles,
+	}
+	if videos := probe.StreamsOfType("video"); len(videos) > 0 {
+		job.videoCodec = videos[0].CodecName
+	}
+	if opts.FastStart {
+		job.segmenting = fastStartSegmenting
+	}
+	if hasThumbs {
+		job.thumbnails = &thumbs
+	}
+	if burnIn != nil {
+		job.videoFilter, err = prepareBurnInFilter(streamID, hlsDir, largestFile, burnIn)
+		if err != nil {
+			s.updateStreamState(streamID, StateError, err)
+			return
+		}
+	}
+
 	s.updateStreamState(streamID, StateTranscoding, nil)
 
 	// Start transcoding (simplified error handling)
-	err = s.transcodeToHLS(ctx, streamID, largestFile, hlsDir)
+	err = s.transcodeToHLS(ctx, job)
 	if err != nil {
 		s.updateStreamState(streamID, StateError, fmt.Errorf("transcoding failed: %w", err))
 		os.RemoveAll(hlsDir) // Clean up failed transcoding attempt
@@ -166,6 +394,13 @@ func (s *HlsService) manageStream(ctx context.Context, streamID string, t *torre
 
 	s.updateStreamState(streamID, StateReady, nil)
 
+	if opts.SupportsDASH() {
+		// Write the final, static manifest now that every rendition has ended.
+		if err := s.writeDASHManifest(streamID); err != nil {
+			log.Printf("[%s] Failed to write DASH manifest: %v", streamID, err)
+		}
+	}
+
 	// Schedule cleanup (optional)
 	// go func() {
 	// 	time.Sleep(30 * time.Minute)
@@ -180,14 +415,13 @@ func (s *HlsService) manageStream(ctx context.Context, streamID string, t *torre
 
 // ServeHTTP makes HlsService serve the HLS files.
 func (s *HlsService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Expecting paths like /hls/{streamID}/playlist.m3u8 or /hls/{streamID}/segmentXX.ts
-	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
-	if len(parts) != 3 {
+	// Expecting paths like /hls/{streamID}/master.m3u8, /hls/{streamID}/segmentXX.ts
+	// or /hls/{streamID}/subs/{trackID}_XXX.vtt, /hls/{streamID}/thumbs/thumbs.vtt
+	streamID, fileName, ok := splitStreamPath(r.URL.Path)
+	if !ok {
 		http.NotFound(w, r)
 		return
 	}
-	streamID := parts[1]
-	fileName := parts[2]
 
 	s.mu.RLock()
 	stream, ok := s.streams[streamID]
@@ -199,6 +433,20 @@ func (s *HlsService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.serveStreamFile(w, r, stream, fileName)
+}
+
+// splitStreamPath splits a request path of the form /{prefix}/{streamID}/{fileName}.
+func splitStreamPath(urlPath string) (streamID, fileName string, ok bool) {
+	parts := strings.SplitN(strings.TrimPrefix(urlPath, "/"), "/", 3)
+	if len(parts) != 3 {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// serveStreamFile serves a file from the stream's output directory with CORS and MIME headers.
+func (s *HlsService) serveStreamFile(w http.ResponseWriter, r *http.Request, stream *StreamInfo, fileName string) {
 	// Security: Ensure fileName doesn't contain path traversal elements.
 	if strings.Contains(fileName, "..") {
 		http.Error(w, "Invalid path", http.StatusBadRequest)
@@ -218,27 +466,130 @@ func (s *HlsService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The stdlib MIME table doesn't know the HLS extensions, and players are picky about them.
+	if contentType, ok := hlsContentTypes[strings.ToLower(filepath.Ext(fileName))]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+
 	http.ServeFile(w, r, filePath)
 }
 
-func (s *HlsService) transcodeToHLS(ctx context.Context, streamID string, file *torrent.File, hlsDir string) error {
-	fileReader := file.NewReader()
-	defer fileReader.Close() // Ensure reader is closed eventually
+// hlsContentTypes maps the extensions of files written into an HLS directory to their MIME types.
+var hlsContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".m4s":  "video/iso.segment",
+	".mp4":  "video/mp4", // fMP4 init segments
+	".vtt":  "text/vtt; charset=utf-8",
+	".mpd":  "application/dash+xml",
+	".jpg":  "image/jpeg", // Thumbnail sprites and posters
+}
 
-	playlistPath := filepath.Join(hlsDir, "playlist.m3u8")
-	segmentPattern := filepath.Join(hlsDir, "segment%03d.ts")
+// setProbedTracks records what probing found for a stream. Subtitles may already have been
+// attached while the stream was being probed, so they are kept after the probed ones.
+func (s *HlsService) setProbedTracks(streamID string, probe *MediaProbe, audioTracks []AudioTrack, subtitles []SubtitleTrack, thumbnails bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.streams[streamID]
+	if !ok {
+		return
+	}
+	info.Probe = probe
+	info.AudioTracks = audioTracks
+	merged := append([]SubtitleTrack(nil), subtitles...)
+	for _, track := range info.Subtitles {
+		track.Name = uniqueSubtitleName(track.Name, merged)
+		merged = append(merged, track)
+	}
+	info.Subtitles = merged
+	info.Thumbnails = thumbnails
+}
 
-	// Ensure ffmpeg is in PATH or provide the full path
-	cmd := exec.Command("ffmpeg",
-		"-i", "pipe:0", // Read from stdin
-		"-c:v", "libx264", // Example codec, adjust as needed
+// transcodeJob describes the outputs of a single ffmpeg run for a stream.
+type transcodeJob struct {
+	streamID    string
+	file        *torrent.File
+	hlsDir      string
+	profile     TranscodeProfile
+	segmenting  hlsSegmenting
+	duration    float64 // Source duration in seconds, or 0 if unknown
+	videoCodec  string  // Source codec of the first video stream, if probed
+	audioTracks []AudioTrack
+	subtitles   []SubtitleTrack
+	videoFilter string             // filter_complex graph whose output is burnInLabel, or empty
+	thumbnails  *thumbnailGeometry // Sprite size, or nil to skip thumbnails and the poster
+}
+
+// transcodeToHLS pipes the torrent file through a single ffmpeg process that writes the
+// main HLS media playlist (video, plus the default audio track for MPEG-TS profiles), an
+// audio-only rendition for every other audio track and a segmented WebVTT rendition for
+// every embedded subtitle track, plus thumbnail sprites and a poster frame when requested.
+func (s *HlsService) transcodeToHLS(ctx context.Context, job transcodeJob) error {
+	streamID, hlsDir := job.streamID, job.hlsDir
+
+	fileReader := job.file.NewReader()
+	defer fileReader.Close() // Ensure reader is closed eventually
+
+	playlistPath := filepath.Join(hlsDir, mediaPlaylistName)
+
+	args := []string{"-i", "pipe:0"} // Read from stdin
+	muxedAudio, hasMuxedAudio := muxedAudioTrack(job.audioTracks)
+	switch {
+	case job.videoFilter != "":
+		args = append(args, "-filter_complex", job.videoFilter, "-map", burnInLabel)
+	case len(job.audioTracks) > 0:
+		args = append(args, "-map", "0:v:0")
+	default:
+		// Without a probe, leave stream selection to ffmpeg (best video and audio).
+	}
+	switch {
+	case hasMuxedAudio:
+		args = append(args, "-map", fmt.Sprintf("0:%d", muxedAudio.StreamIndex))
+	case job.videoFilter != "" && len(job.audioTracks) == 0:
+		args = append(args, "-map", "0:a:0?")
+	}
+	videoArgs := job.profile.videoCodecArgs(job.videoCodec, job.videoFilter != "")
+	args = append(args, videoArgs...)
+	segmenting := job.segmenting
+	if segmenting.SegmentSeconds != hlsSegmentSeconds {
+		if videoArgs[1] == "copy" {
+			// Copied video can only be cut at the source's keyframes, so the ramp can't be
+			// forced; keep normal segments but still publish an EVENT playlist.
+			segmenting.SegmentSeconds = hlsSegmentSeconds
+			log.Printf("[%s] Fast start has no effect: profile %s copies the video", streamID, job.profile.Name)
+			s.mu.Lock()
+			if info, ok := s.streams[streamID]; ok {
+				info.FastStartIgnored = true
+			}
+			s.mu.Unlock()
+		} else {
+			args = append(args, fastStartKeyframeArgs(job.duration)...)
+		}
+	}
+	args = append(args,
 		"-c:a", "aac", // Example codec, adjust as needed
-		"-f", "hls",
-		"-hls_time", "10", // 10-second segments
-		"-hls_list_size", "0", // Keep all segments in the playlist
-		"-hls_segment_filename", segmentPattern,
-		playlistPath,
+		"-sn", // Subtitles are written as separate WebVTT renditions below
 	)
+	args = append(args, job.profile.hlsOutputArgs(playlistPath, "segment", "init.mp4", segmenting)...)
+	audioSegmenting := alternateAudioSegmenting(segmenting)
+	for _, track := range job.audioTracks {
+		if !track.Muxed {
+			args = append(args, alternateAudioOutputArgs(hlsDir, track, job.profile, audioSegmenting)...)
+		}
+	}
+	for _, track := range job.subtitles {
+		if track.Source != SubtitleEmbedded {
+			continue
+		}
+		args = append(args, "-map", fmt.Sprintf("0:%d", track.StreamIndex))
+		args = append(args, webvttSegmentOutputArgs(hlsDir, track)...)
+	}
+	if job.thumbnails != nil {
+		args = append(args, thumbnailOutputArgs(hlsDir, *job.thumbnails)...)
+		args = append(args, posterOutputArgs(hlsDir, posterOffset(job.duration))...)
+	}
+
+	cmd := exec.Command(FFmpegPath, args...)
 
 	cmd.Stdin = fileReader // Pipe the torrent file reader to ffmpeg's stdin
 
@@ -269,6 +620,10 @@ func (s *HlsService) transcodeToHLS(ctx context.Context, streamID string, file *
 		}
 	}()
 
+	ffmpegDone := make(chan struct{})
+	defer close(ffmpegDone)
+	go s.watchFirstSegment(streamID, hlsDir, firstSegmentPlaylists(job.audioTracks), ffmpegDone)
+
 	log.Printf("[%s] Waiting for ffmpeg to finish...", streamID)
 	err = cmd.Wait()
 	if err != nil {
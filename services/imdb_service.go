@@ -3,9 +3,12 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,11 +20,105 @@ type SearchResult struct {
 	ImdbID string `json:"imdbId"`
 	Type   string `json:"type"`   // e.g., "movie", "series", "episode"
 	Poster string `json:"poster"` // URL to the poster image
+	// Backdrop is the URL of a wide background image, when the provider has one.
+	Backdrop string `json:"backdrop,omitempty"`
+}
+
+// TitleType restricts a title search to one kind of title.
+type TitleType string
+
+const (
+	TitleTypeMovie   TitleType = "movie"
+	TitleTypeSeries  TitleType = "series"
+	TitleTypeEpisode TitleType = "episode"
+)
+
+// TitleTypes lists the supported title types.
+var TitleTypes = []TitleType{TitleTypeMovie, TitleTypeSeries, TitleTypeEpisode}
+
+// ParseTitleType parses a title type name; an empty name means any type and gives "".
+func ParseTitleType(name string) (TitleType, error) {
+	if name == "" {
+		return "", nil
+	}
+	for _, t := range TitleTypes {
+		if strings.EqualFold(name, string(t)) {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unknown title type %q", name)
+}
+
+// SearchQuery describes a title search. Type and Year are ignored when zero.
+type SearchQuery struct {
+	Query string
+	Page  int // 1-indexed; zero means the first page
+	Type  TitleType
+	Year  int
+}
+
+// SearchPage is one page of title search results.
+type SearchPage struct {
+	Results      []SearchResult `json:"results"`
+	Page         int            `json:"page"`
+	TotalResults int            `json:"totalResults"`
+	NextPage     int            `json:"nextPage,omitempty"` // Zero on the last page
 }
 
 // ImdbSearcher defines the interface for an IMDB search service.
 type ImdbSearcher interface {
-	Search(ctx context.Context, query string) ([]SearchResult, error)
+	Search(ctx context.Context, query SearchQuery) (*SearchPage, error)
+	// LookupByID returns the title with the given IMDb ID, or ErrTitleNotFound.
+	LookupByID(ctx context.Context, imdbID string) (*SearchResult, error)
+	// Details returns the full details of a title, or ErrTitleNotFound.
+	Details(ctx context.Context, imdbID string) (*TitleDetails, error)
+	// Season returns the episodes of one season of a series, or ErrTitleNotFound.
+	Season(ctx context.Context, imdbID string, season int) (*SeasonDetails, error)
+}
+
+// ErrTitleNotFound is returned when no title (or season) has the requested IMDb ID.
+var ErrTitleNotFound = errors.New("title not found")
+
+// TitleRating is a rating from one source, e.g. {"Rotten Tomatoes", "91%"}.
+type TitleRating struct {
+	Source string `json:"source"`
+	Value  string `json:"value"`
+}
+
+// TitleDetails is everything known about a title, for a detail page. Unknown fields are empty.
+type TitleDetails struct {
+	SearchResult
+	Rated          string        `json:"rated,omitempty"`    // e.g. "PG-13"
+	Released       string        `json:"released,omitempty"` // e.g. "14 Oct 1994"
+	RuntimeMinutes int           `json:"runtimeMinutes,omitempty"`
+	Genres         []string      `json:"genres"`
+	Plot           string        `json:"plot,omitempty"`
+	Directors      []string      `json:"directors"`
+	Writers        []string      `json:"writers"`
+	Cast           []string      `json:"cast"`
+	Languages      []string      `json:"languages"`
+	Ratings        []TitleRating `json:"ratings"`
+	ImdbRating     string        `json:"imdbRating,omitempty"` // e.g. "9.3"
+	ImdbVotes      int           `json:"imdbVotes,omitempty"`
+	TotalSeasons   int           `json:"totalSeasons,omitempty"` // Series only
+}
+
+// EpisodeSummary is one episode in a season listing.
+type EpisodeSummary struct {
+	Episode    int    `json:"episode"`
+	Title      string `json:"title"`
+	Released   string `json:"released,omitempty"` // YYYY-MM-DD
+	ImdbID     string `json:"imdbId,omitempty"`
+	ImdbRating string `json:"imdbRating,omitempty"`
+}
+
+// SeasonDetails lists the episodes of one season of a series.
+type SeasonDetails struct {
+	ImdbID       string           `json:"imdbId"` // The series
+	Title        string           `json:"title"`  // The series title
+	Season       int              `json:"season"`
+	TotalSeasons int              `json:"totalSeasons,omitempty"`
+	Episodes     []EpisodeSummary `json:"episodes"`
 }
 
 const (
@@ -71,59 +168,279 @@ func NewConcreteImdbService(apiKey string) *ConcreteImdbService {
 	}
 }
 
+// omdbPageSize is the fixed number of results per OMDb search page.
+const omdbPageSize = 10
+
 // Search performs a search query against the OMDb API.
-func (s *ConcreteImdbService) Search(ctx context.Context, query string) ([]SearchResult, error) {
+func (s *ConcreteImdbService) Search(ctx context.Context, query SearchQuery) (*SearchPage, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	params := url.Values{}
+	params.Add("s", query.Query) // 's' is for search by title
+	params.Add("page", strconv.Itoa(query.Page))
+	if query.Type != "" {
+		params.Add("type", string(query.Type))
+	}
+	if query.Year > 0 {
+		params.Add("y", strconv.Itoa(query.Year))
+	}
+
+	var apiResp OMDbAPIResponse
+	if err := s.get(ctx, params, &apiResp); err != nil {
+		return nil, err
+	}
+
+	page := &SearchPage{Results: []SearchResult{}, Page: query.Page}
+	if apiResp.Response == "False" {
+		if apiResp.Error == "Movie not found!" || apiResp.Error == "Series not found!" || apiResp.Error == "Incorrect IMDb ID." { // OMDb can return "Incorrect IMDb ID." for empty search.
+			return page, nil // No results found is not an error, return an empty page
+		}
+		return nil, omdbAPIError(apiResp.Error)
+	}
+
+	for _, item := range apiResp.Search {
+		page.Results = append(page.Results, SearchResult{
+			Title:  item.Title,
+			Year:   item.Year,
+			ImdbID: item.ImdbID,
+			Type:   item.Type,
+			Poster: item.Poster,
+		})
+	}
+	page.TotalResults = omdbInt(apiResp.TotalResults)
+	if query.Page*omdbPageSize < page.TotalResults {
+		page.NextPage = query.Page + 1
+	}
+	return page, nil
+}
+
+// OMDbTitleResponse defines the structure of OMDb's response to a lookup by IMDb ID.
+type OMDbTitleResponse struct {
+	OMDbSearchResult
+	Response string `json:"Response"`
+	Error    string `json:"Error"`
+}
+
+// LookupByID fetches a single title from the OMDb API by its IMDb ID.
+func (s *ConcreteImdbService) LookupByID(ctx context.Context, imdbID string) (*SearchResult, error) {
+	params := url.Values{}
+	params.Add("i", imdbID) // 'i' is for lookup by IMDb ID
+
+	var apiResp OMDbTitleResponse
+	if err := s.get(ctx, params, &apiResp); err != nil {
+		return nil, err
+	}
+	if apiResp.Response == "False" {
+		return nil, omdbLookupError(apiResp.Error)
+	}
+
+	return &SearchResult{
+		Title:  apiResp.Title,
+		Year:   apiResp.Year,
+		ImdbID: apiResp.ImdbID,
+		Type:   apiResp.Type,
+		Poster: apiResp.Poster,
+	}, nil
+}
+
+// omdbLookupError maps the error message of a failed lookup by IMDb ID to an error.
+func omdbLookupError(message string) error {
+	switch message {
+	case "Incorrect IMDb ID.", "Error getting data.", "Series or season not found!":
+		return ErrTitleNotFound
+	}
+	return omdbAPIError(message)
+}
+
+// omdbRequestLimitMessage is OMDb's error once an API key's daily quota is used up.
+const omdbRequestLimitMessage = "Request limit reached!"
+
+// omdbAPIError maps an OMDb error message to an error, wrapping ErrQuotaExceeded when the
+// API key's quota is used up.
+func omdbAPIError(message string) error {
+	if message == omdbRequestLimitMessage {
+		return fmt.Errorf("%w: OMDb API error: %s", ErrQuotaExceeded, message)
+	}
+	return fmt.Errorf("OMDb API error: %s", message)
+}
+
+// OMDbDetailsResponse defines the structure of OMDb's full response to a lookup by IMDb ID.
+// OMDb reports missing values as "N/A".
+type OMDbDetailsResponse struct {
+	OMDbTitleResponse
+	Rated      string `json:"Rated"`
+	Released   string `json:"Released"`
+	Runtime    string `json:"Runtime"` // e.g. "142 min"
+	Genre      string `json:"Genre"`   // Comma-separated, as are Director, Writer, Actors and Language
+	Director   string `json:"Director"`
+	Writer     string `json:"Writer"`
+	Actors     string `json:"Actors"`
+	Plot       string `json:"Plot"`
+	Language   string `json:"Language"`
+	ImdbRating string `json:"imdbRating"`
+	ImdbVotes  string `json:"imdbVotes"` // e.g. "2,912,345"
+	Ratings    []struct {
+		Source string `json:"Source"`
+		Value  string `json:"Value"`
+	} `json:"Ratings"`
+	TotalSeasons string `json:"totalSeasons"`
+}
+
+// Details fetches the full details of a title from the OMDb API, with the full plot.
+func (s *ConcreteImdbService) Details(ctx context.Context, imdbID string) (*TitleDetails, error) {
+	params := url.Values{}
+	params.Add("i", imdbID)
+	params.Add("plot", "full")
+
+	var apiResp OMDbDetailsResponse
+	if err := s.get(ctx, params, &apiResp); err != nil {
+		return nil, err
+	}
+	if apiResp.Response == "False" {
+		return nil, omdbLookupError(apiResp.Error)
+	}
+
+	details := &TitleDetails{
+		SearchResult: SearchResult{
+			Title:  apiResp.Title,
+			Year:   apiResp.Year,
+			ImdbID: apiResp.ImdbID,
+			Type:   apiResp.Type,
+			Poster: omdbValue(apiResp.Poster),
+		},
+		Rated:        omdbValue(apiResp.Rated),
+		Released:     omdbValue(apiResp.Released),
+		Genres:       omdbList(apiResp.Genre),
+		Plot:         omdbValue(apiResp.Plot),
+		Directors:    omdbList(apiResp.Director),
+		Writers:      omdbList(apiResp.Writer),
+		Cast:         omdbList(apiResp.Actors),
+		Languages:    omdbList(apiResp.Language),
+		Ratings:      make([]TitleRating, 0, len(apiResp.Ratings)),
+		ImdbRating:   omdbValue(apiResp.ImdbRating),
+		ImdbVotes:    omdbInt(strings.ReplaceAll(apiResp.ImdbVotes, ",", "")),
+		TotalSeasons: omdbInt(apiResp.TotalSeasons),
+	}
+	if minutes, ok := strings.CutSuffix(apiResp.Runtime, " min"); ok {
+		details.RuntimeMinutes = omdbInt(minutes)
+	}
+	for _, r := range apiResp.Ratings {
+		details.Ratings = append(details.Ratings, TitleRating{Source: r.Source, Value: r.Value})
+	}
+	return details, nil
+}
+
+// OMDbSeasonResponse defines the structure of OMDb's response to a season lookup.
+type OMDbSeasonResponse struct {
+	Title        string `json:"Title"`
+	Season       string `json:"Season"`
+	TotalSeasons string `json:"totalSeasons"`
+	Episodes     []struct {
+		Title      string `json:"Title"`
+		Released   string `json:"Released"`
+		Episode    string `json:"Episode"`
+		ImdbRating string `json:"imdbRating"`
+		ImdbID     string `json:"imdbID"`
+	} `json:"Episodes"`
+	Response string `json:"Response"`
+	Error    string `json:"Error"`
+}
+
+// Season fetches the episode list of one season of a series from the OMDb API.
+func (s *ConcreteImdbService) Season(ctx context.Context, imdbID string, season int) (*SeasonDetails, error) {
+	params := url.Values{}
+	params.Add("i", imdbID)
+	params.Add("Season", strconv.Itoa(season))
+
+	var apiResp OMDbSeasonResponse
+	if err := s.get(ctx, params, &apiResp); err != nil {
+		return nil, err
+	}
+	if apiResp.Response == "False" {
+		return nil, omdbLookupError(apiResp.Error)
+	}
+
+	details := &SeasonDetails{
+		ImdbID:       imdbID,
+		Title:        apiResp.Title,
+		Season:       season,
+		TotalSeasons: omdbInt(apiResp.TotalSeasons),
+		Episodes:     make([]EpisodeSummary, 0, len(apiResp.Episodes)),
+	}
+	for _, ep := range apiResp.Episodes {
+		details.Episodes = append(details.Episodes, EpisodeSummary{
+			Episode:    omdbInt(ep.Episode),
+			Title:      ep.Title,
+			Released:   omdbValue(ep.Released),
+			ImdbID:     ep.ImdbID,
+			ImdbRating: omdbValue(ep.ImdbRating),
+		})
+	}
+	return details, nil
+}
+
+// omdbValue returns v, or "" for OMDb's "N/A".
+func omdbValue(v string) string {
+	if v == "N/A" {
+		return ""
+	}
+	return v
+}
+
+// omdbList splits a comma-separated OMDb value; "N/A" gives an empty list.
+func omdbList(v string) []string {
+	list := []string{}
+	for _, item := range strings.Split(omdbValue(v), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// omdbInt parses an OMDb number; "N/A" and other non-numbers give 0.
+func omdbInt(v string) int {
+	n, _ := strconv.Atoi(v)
+	return n
+}
+
+// get performs an OMDb API request with the given parameters and decodes the JSON response into out.
+func (s *ConcreteImdbService) get(ctx context.Context, params url.Values, out any) error {
 	if s.APIKey == "" || s.APIKey == "YOUR_OMDB_API_KEY" {
-		return nil, fmt.Errorf("OMDb API key is not configured")
+		return fmt.Errorf("OMDb API key is not configured")
 	}
 
 	// Construct the request URL
 	reqURL, err := url.Parse(s.BaseURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse base URL: %w", err)
+		return fmt.Errorf("failed to parse base URL: %w", err)
 	}
-	params := url.Values{}
-	params.Add("s", query) // 's' is for search by title
-	params.Add("apikey", s.APIKey)
+	params.Set("apikey", s.APIKey)
 	reqURL.RawQuery = params.Encode()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+		return fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
 	resp, err := s.Client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute HTTP request to OMDb: %w", err)
+		return fmt.Errorf("failed to execute HTTP request to OMDb: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("OMDb API request failed with status: %s", resp.Status)
-	}
-
-	var apiResp OMDbAPIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-		return nil, fmt.Errorf("failed to decode OMDb API response: %w", err)
-	}
-
-	if apiResp.Response == "False" {
-		if apiResp.Error == "Movie not found!" || apiResp.Error == "Series not found!" || apiResp.Error == "Incorrect IMDb ID." { // OMDb can return "Incorrect IMDb ID." for empty search.
-			return []SearchResult{}, nil // No results found is not an error, return empty slice
+		// OMDb answers an exhausted quota with a 401 and a JSON error.
+		var apiErr OMDbTitleResponse
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error == omdbRequestLimitMessage {
+			return omdbAPIError(apiErr.Error)
 		}
-		return nil, fmt.Errorf("OMDb API error: %s", apiResp.Error)
+		return upstreamStatusError("OMDb API", resp, apiErr.Error)
 	}
 
-	results := make([]SearchResult, 0, len(apiResp.Search))
-	for _, item := range apiResp.Search {
-		results = append(results, SearchResult{
-			Title:  item.Title,
-			Year:   item.Year,
-			ImdbID: item.ImdbID,
-			Type:   item.Type,
-			Poster: item.Poster,
-		})
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode OMDb API response: %w", err)
 	}
-
-	return results, nil
+	return nil
 }
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testOMDbKey = "0123abcd"
+
+// omdbResponses are the fake OMDb API's responses by query, without the API key. OMDb answers
+// unknown titles with a 200 and an error, which queries not listed get too.
+var omdbResponses = map[string]string{
+	"i=tt0111161&plot=full": `{"Title": "The Shawshank Redemption", "Year": "1994", "Rated": "R", "Released": "14 Oct 1994",
+		"Runtime": "142 min", "Genre": "Drama", "Director": "Frank Darabont", "Writer": "Stephen King, Frank Darabont",
+		"Actors": "Tim Robbins, Morgan Freeman, Bob Gunton", "Plot": "Two imprisoned men bond.", "Language": "English",
+		"Poster": "https://img.test/shawshank.jpg",
+		"Ratings": [{"Source": "Internet Movie Database", "Value": "9.3/10"}, {"Source": "Rotten Tomatoes", "Value": "91%"}],
+		"imdbRating": "9.3", "imdbVotes": "2,912,345", "imdbID": "tt0111161", "Type": "movie", "Response": "True"}`,
+	"i=tt0903747&plot=full": `{"Title": "Breaking Bad", "Year": "2008–2013", "Rated": "TV-MA", "Released": "20 Jan 2008",
+		"Runtime": "49 min", "Genre": "Crime, Drama, Thriller", "Director": "N/A", "Writer": "Vince Gilligan",
+		"Actors": "Bryan Cranston, Aaron Paul", "Plot": "A teacher turns to crime.", "Language": "English, Spanish",
+		"Poster": "https://img.test/bb.jpg", "Ratings": [{"Source": "Internet Movie Database", "Value": "9.5/10"}],
+		"imdbRating": "9.5", "imdbVotes": "2,100,000", "imdbID": "tt0903747", "Type": "series", "totalSeasons": "5", "Response": "True"}`,
+	"i=tt9999998&plot=full": `{"Title": "Obscure Short", "Year": "2021", "Rated": "N/A", "Released": "N/A", "Runtime": "N/A",
+		"Genre": "N/A", "Director": "N/A", "Writer": "N/A", "Actors": "N/A", "Plot": "N/A", "Language": "N/A",
+		"Poster": "N/A", "Ratings": [], "imdbRating": "N/A", "imdbVotes": "N/A", "imdbID": "tt9999998", "Type": "movie", "Response": "True"}`,
+
+	"Season=1&i=tt0903747": `{"Title": "Breaking Bad", "Season": "1", "totalSeasons": "5", "Episodes": [
+		{"Title": "Pilot", "Released": "2008-01-20", "Episode": "1", "imdbRating": "9.0", "imdbID": "tt0959621"},
+		{"Title": "Cat's in the Bag...", "Released": "N/A", "Episode": "2", "imdbRating": "N/A", "imdbID": "tt1054724"}
+	], "Response": "True"}`,
+	"Season=9&i=tt0903747":  `{"Response": "False", "Error": "Series or season not found!"}`,
+	"i=tt0000000&plot=full": `{"Response": "False", "Error": "Incorrect IMDb ID."}`,
+
+	"page=1&s=matrix": `{"Search": [
+		{"Title": "The Matrix", "Year": "1999", "imdbID": "tt0133093", "Type": "movie", "Poster": "https://img.test/matrix.jpg"},
+		{"Title": "The Matrix Reloaded", "Year": "2003", "imdbID": "tt0234215", "Type": "movie", "Poster": "N/A"}
+	], "totalResults": "21", "Response": "True"}`,
+	"page=3&s=matrix": `{"Search": [
+		{"Title": "Matrix Recut", "Year": "2010", "imdbID": "tt9000001", "Type": "movie", "Poster": "N/A"}
+	], "totalResults": "21", "Response": "True"}`,
+	"page=2&s=breaking&type=series&y=2008": `{"Search": [
+		{"Title": "Breaking Bad", "Year": "2008–2013", "imdbID": "tt0903747", "Type": "series", "Poster": "https://img.test/bb.jpg"}
+	], "totalResults": "11", "Response": "True"}`,
+	"page=1&s=zzzz":             `{"Response": "False", "Error": "Movie not found!"}`,
+	"page=1&s=zzzz&type=series": `{"Response": "False", "Error": "Series not found!"}`,
+	"page=1&s=x":                `{"Response": "False", "Error": "Too many results."}`,
+}
+
+// fakeOMDb serves omdbResponses, accepting only testOMDbKey. An exhausted key is answered
+// with a 401 and OMDb's quota message.
+type fakeOMDb struct {
+	exhausted bool
+}
+
+func (f *fakeOMDb) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case query.Get("apikey") != testOMDbKey:
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"Response": "False", "Error": "Invalid API key!"}`))
+		return
+	case f.exhausted:
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"Response": "False", "Error": "Request limit reached!"}`))
+		return
+	}
+	query.Del("apikey")
+	body, ok := omdbResponses[query.Encode()]
+	if !ok {
+		body = `{"Response": "False", "Error": "Error getting data."}`
+	}
+	w.Write([]byte(body))
+}
+
+func newTestOMDb(t *testing.T, apiKey string) (*ConcreteImdbService, *fakeOMDb) {
+	t.Helper()
+	fake := &fakeOMDb{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	s := NewConcreteImdbService(apiKey)
+	s.BaseURL = server.URL + "/"
+	return s, fake
+}
+
+func TestOMDbDetails(t *testing.T) {
+	tests := []struct {
+		imdbID string
+		want   TitleDetails
+	}{
+		{
+			imdbID: "tt0111161",
+			want: TitleDetails{
+				SearchResult:   SearchResult{Title: "The Shawshank Redemption", Year: "1994", ImdbID: "tt0111161", Type: "movie", Poster: "https://img.test/shawshank.jpg"},
+				Rated:          "R",
+				Released:       "14 Oct 1994",
+				RuntimeMinutes: 142,
+				Genres:         []string{"Drama"},
+				Plot:           "Two imprisoned men bond.",
+				Directors:      []string{"Frank Darabont"},
+				Writers:        []string{"Stephen King", "Frank Darabont"},
+				Cast:           []string{"Tim Robbins", "Morgan Freeman", "Bob Gunton"},
+				Languages:      []string{"English"},
+				Ratings:        []TitleRating{{Source: "Internet Movie Database", Value: "9.3/10"}, {Source: "Rotten Tomatoes", Value: "91%"}},
+				ImdbRating:     "9.3",
+				ImdbVotes:      2912345,
+			},
+		},
+		{
+			imdbID: "tt0903747",
+			want: TitleDetails{
+				SearchResult:   SearchResult{Title: "Breaking Bad", Year: "2008–2013", ImdbID: "tt0903747", Type: "series", Poster: "https://img.test/bb.jpg"},
+				Rated:          "TV-MA",
+				Released:       "20 Jan 2008",
+				RuntimeMinutes: 49,
+				Genres:         []string{"Crime", "Drama", "Thriller"},
+				Plot:           "A teacher turns to crime.",
+				Directors:      []string{},
+				Writers:        []string{"Vince Gilligan"},
+				Cast:           []string{"Bryan Cranston", "Aaron Paul"},
+				Languages:      []string{"English", "Spanish"},
+				Ratings:        []TitleRating{{Source: "Internet Movie Database", Value: "9.5/10"}},
+				ImdbRating:     "9.5",
+				ImdbVotes:      2100000,
+				TotalSeasons:   5,
+			},
+		},
+		{
+			// Every "N/A" is left empty.
+			imdbID: "tt9999998",
+			want: TitleDetails{
+				SearchResult: SearchResult{Title: "Obscure Short", Year: "2021", ImdbID: "tt9999998", Type: "movie"},
+				Genres:       []string{},
+				Directors:    []string{},
+				Writers:      []string{},
+				Cast:         []string{},
+				Languages:    []string{},
+				Ratings:      []TitleRating{},
+			},
+		},
+	}
+	s, _ := newTestOMDb(t, testOMDbKey)
+	for _, tt := range tests {
+		got, err := s.Details(context.Background(), tt.imdbID)
+		if err != nil {
+			t.Errorf("Details(%s): %v", tt.imdbID, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("Details(%s)\n got %+v\nwant %+v", tt.imdbID, *got, tt.want)
+		}
+	}
+}
+
+func TestOMDbSeason(t *testing.T) {
+	s, _ := newTestOMDb(t, testOMDbKey)
+	got, err := s.Season(context.Background(), "tt0903747", 1)
+	if err != nil {
+		t.Fatalf("Season: %v", err)
+	}
+	want := &SeasonDetails{
+		ImdbID:       "tt0903747",
+		Title:        "Breaking Bad",
+		Season:       1,
+		TotalSeasons: 5,
+		Episodes: []EpisodeSummary{
+			{Episode: 1, Title: "Pilot", Released: "2008-01-20", ImdbID: "tt0959621", ImdbRating: "9.0"},
+			{Episode: 2, Title: "Cat's in the Bag...", ImdbID: "tt1054724"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Season\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestOMDbSearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  *SearchPage
+	}{
+		{
+			name:  "first page",
+			query: SearchQuery{Query: "matrix"},
+			want: &SearchPage{
+				Results: []SearchResult{
+					{Title: "The Matrix", Year: "1999", ImdbID: "tt0133093", Type: "movie", Poster: "https://img.test/matrix.jpg"},
+					// The page shows missing search posters itself.
+					{Title: "The Matrix Reloaded", Year: "2003", ImdbID: "tt0234215", Type: "movie", Poster: "N/A"},
+				},
+				Page:         1,
+				TotalResults: 21,
+				NextPage:     2,
+			},
+		},
+		{
+			name:  "last page",
+			query: SearchQuery{Query: "matrix", Page: 3},
+			want: &SearchPage{
+				Results:      []SearchResult{{Title: "Matrix Recut", Year: "2010", ImdbID: "tt9000001", Type: "movie", Poster: "N/A"}},
+				Page:         3,
+				TotalResults: 21,
+			},
+		},
+		{
+			name:  "filters",
+			query: SearchQuery{Query: "breaking", Page: 2, Type: TitleTypeSeries, Year: 2008},
+			want: &SearchPage{
+				Results:      []SearchResult{{Title: "Breaking Bad", Year: "2008–2013", ImdbID: "tt0903747", Type: "series", Poster: "https://img.test/bb.jpg"}},
+				Page:         2,
+				TotalResults: 11,
+			},
+		},
+		{
+			name:  "no movies",
+			query: SearchQuery{Query: "zzzz"},
+			want:  &SearchPage{Results: []SearchResult{}, Page: 1},
+		},
+		{
+			name:  "no series",
+			query: SearchQuery{Query: "zzzz", Type: TitleTypeSeries},
+			want:  &SearchPage{Results: []SearchResult{}, Page: 1},
+		},
+	}
+	s, _ := newTestOMDb(t, testOMDbKey)
+	for _, tt := range tests {
+		got, err := s.Search(context.Background(), tt.query)
+		if err != nil {
+			t.Errorf("%s: Search: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Search\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// Other OMDb errors are reported.
+	if _, err := s.Search(context.Background(), SearchQuery{Query: "x"}); err == nil || !strings.Contains(err.Error(), "Too many results.") {
+		t.Errorf("Search with too many results: got %v, want the API's message", err)
+	}
+}
+
+func TestOMDbNotFound(t *testing.T) {
+	s, _ := newTestOMDb(t, testOMDbKey)
+	ctx := context.Background()
+	if _, err := s.Details(ctx, "tt0000000"); !errors.Is(err, ErrTitleNotFound) {
+		t.Errorf("Details of an invalid ID: got %v, want ErrTitleNotFound", err)
+	}
+	if _, err := s.Details(ctx, "tt0000001"); !errors.Is(err, ErrTitleNotFound) {
+		t.Errorf("Details of an unknown ID: got %v, want ErrTitleNotFound", err)
+	}
+	if _, err := s.Season(ctx, "tt0903747", 9); !errors.Is(err, ErrTitleNotFound) {
+		t.Errorf("Season of a missing season: got %v, want ErrTitleNotFound", err)
+	}
+}
+
+func TestOMDbErrors(t *testing.T) {
+	s, fake := newTestOMDb(t, testOMDbKey)
+	fake.exhausted = true
+	if _, err := s.Details(context.Background(), "tt0111161"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Details with an exhausted key: got %v, want ErrQuotaExceeded", err)
+	}
+	if _, err := s.Search(context.Background(), SearchQuery{Query: "matrix"}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Search with an exhausted key: got %v, want ErrQuotaExceeded", err)
+	}
+
+	s, _ = newTestOMDb(t, "wrong")
+	_, err := s.Details(context.Background(), "tt0111161")
+	if err == nil || errors.Is(err, ErrTitleNotFound) || errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Details with a wrong key: got %v, want a plain error", err)
+	}
+
+	s, _ = newTestOMDb(t, "")
+	if _, err := s.Details(context.Background(), "tt0111161"); err == nil {
+		t.Error("Details without a key succeeded")
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import "strings"
+
+// languageInfo pairs an RFC 5646 tag (as HLS expects in LANGUAGE) with a display name.
+type languageInfo struct {
+	Tag  string
+	Name string
+}
+
+// knownLanguages maps ISO 639-2 codes (both bibliographic and terminology forms),
+// ISO 639-1 codes and lower-cased English names to a languageInfo. It only covers
+// languages commonly found in release subtitles and dubs; anything else is passed through.
+var knownLanguages = map[string]languageInfo{}
+
+func init() {
+	for _, l := range []struct {
+		tag, name string
+		aliases   []string
+	}{
+		{"en", "English", []string{"eng"}},
+		{"fr", "French", []string{"fre", "fra"}},
+		{"de", "German", []string{"ger", "deu"}},
+		{"es", "Spanish", []string{"spa", "esp"}},
+		{"it", "Italian", []string{"ita"}},
+		{"pt", "Portuguese", []string{"por"}},
+		{"pt-BR", "Portuguese (Brazil)", []string{"pob", "pb", "brazilian"}},
+		{"nl", "Dutch", []string{"dut", "nld"}},
+		{"sv", "Swedish", []string{"swe"}},
+		{"no", "Norwegian", []string{"nor", "nob"}},
+		{"da", "Danish", []string{"dan"}},
+		{"fi", "Finnish", []string{"fin"}},
+		{"pl", "Polish", []string{"pol"}},
+		{"cs", "Czech", []string{"cze", "ces"}},
+		{"hu", "Hungarian", []string{"hun"}},
+		{"ro", "Romanian", []string{"rum", "ron"}},
+		{"el", "Greek", []string{"gre", "ell"}},
+		{"tr", "Turkish", []string{"tur"}},
+		{"ru", "Russian", []string{"rus"}},
+		{"uk", "Ukrainian", []string{"ukr"}},
+		{"ar", "Arabic", []string{"ara"}},
+		{"he", "Hebrew", []string{"heb"}},
+		{"hi", "Hindi", []string{"hin"}},
+		{"ja", "Japanese", []string{"jpn"}},
+		{"ko", "Korean", []string{"kor"}},
+		{"zh", "Chinese", []string{"chi", "zho"}},
+		{"th", "Thai", []string{"tha"}},
+		{"vi", "Vietnamese", []string{"vie"}},
+		{"id", "Indonesian", []string{"ind"}},
+	} {
+		info := languageInfo{Tag: l.tag, Name: l.name}
+		knownLanguages[strings.ToLower(l.tag)] = info
+		knownLanguages[strings.ToLower(l.name)] = info
+		for _, alias := range l.aliases {
+			knownLanguages[alias] = info
+		}
+	}
+}
+
+// lookupLanguage resolves a language code or English name. ok is false when the
+// value is not a recognised language, in which case it is returned unchanged as the tag.
+func lookupLanguage(code string) (info languageInfo, ok bool) {
+	code = strings.TrimSpace(code)
+	if code == "" || strings.EqualFold(code, "und") {
+		return languageInfo{}, false
+	}
+	if info, ok := knownLanguages[strings.ToLower(code)]; ok {
+		return info, true
+	}
+	return languageInfo{Tag: code, Name: code}, false
+}
+
+// languageMatches reports whether two language codes or names refer to the same language.
+func languageMatches(a, b string) bool {
+	la, okA := lookupLanguage(a)
+	lb, okB := lookupLanguage(b)
+	if okA && okB {
+		return la.Tag == lb.Tag
+	}
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
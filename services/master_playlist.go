@@ -0,0 +1,166 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	masterPlaylistName = "master.m3u8"   // Multivariant playlist listing all renditions
+	mediaPlaylistName  = "playlist.m3u8" // Main video media playlist written by ffmpeg
+
+	audioGroupID    = "audio"
+	subtitleGroupID = "subs"
+
+	// defaultVariantBandwidth is advertised when the source bit rate can't be probed.
+	defaultVariantBandwidth = 5000000
+)
+
+// writeMasterPlaylist (re)writes the stream's master playlist from its current renditions.
+// It is safe to call repeatedly, e.g. whenever a rendition is added.
+func (s *HlsService) writeMasterPlaylist(streamID string) error {
+	s.mu.RLock()
+	info, ok := s.streams[streamID]
+	if !ok {
+		s.mu.RUnlock()
+		return fmt.Errorf("stream %s not found", streamID)
+	}
+	hlsDir := info.HlsDir
+	content := buildMasterPlaylist(info)
+	s.mu.RUnlock()
+
+	if hlsDir == "" {
+		return fmt.Errorf("stream %s has no HLS directory yet", streamID)
+	}
+	return writeFileAtomic(filepath.Join(hlsDir, masterPlaylistName), []byte(content))
+}
+
+// buildMasterPlaylist renders the master playlist for a stream. The caller must hold the service lock.
+func buildMasterPlaylist(info *StreamInfo) string {
+	var b strings.Builder
+	profile, _ := LookupTranscodeProfile(info.Options.Profile)
+	version := 3
+	if profile.SegmentType == SegmentFMP4 {
+		version = 7 // Required by the EXT-X-MAP init segments in the media playlists
+	}
+	b.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", version)
+
+	// A single muxed audio track needs no group: it is simply part of the variant.
+	hasAudioGroup := len(info.AudioTracks) > 1 || hasSeparateAudio(info.AudioTracks)
+	if hasAudioGroup {
+		for _, track := range info.AudioTracks {
+			attrs := []string{
+				"TYPE=AUDIO",
+				"GROUP-ID=" + hlsQuote(audioGroupID),
+				"NAME=" + hlsQuote(track.Name),
+			}
+			if track.Language != "" {
+				attrs = append(attrs, "LANGUAGE="+hlsQuote(track.Language))
+			}
+			attrs = append(attrs, "DEFAULT="+hlsBool(track.Default), "AUTOSELECT=YES")
+			if track.Channels > 0 {
+				attrs = append(attrs, "CHANNELS="+hlsQuote(strconv.Itoa(track.Channels)))
+			}
+			// A muxed track has no URI: its audio is carried in the variant stream itself.
+			if uri := track.PlaylistPath(); uri != "" {
+				attrs = append(attrs, "URI="+hlsQuote(uri))
+			}
+			b.WriteString("#EXT-X-MEDIA:" + strings.Join(attrs, ",") + "\n")
+		}
+	}
+
+	for _, sub := range info.Subtitles {
+		attrs := []string{
+			"TYPE=SUBTITLES",
+			"GROUP-ID=" + hlsQuote(subtitleGroupID),
+			"NAME=" + hlsQuote(sub.Name),
+		}
+		if sub.Language != "" {
+			attrs = append(attrs, "LANGUAGE="+hlsQuote(sub.Language))
+		}
+		attrs = append(attrs,
+			"DEFAULT="+hlsBool(sub.Default),
+			"AUTOSELECT=YES",
+			"FORCED="+hlsBool(sub.Forced),
+			"URI="+hlsQuote(sub.PlaylistPath()),
+		)
+		b.WriteString("#EXT-X-MEDIA:" + strings.Join(attrs, ",") + "\n")
+	}
+
+	bandwidth := info.Probe.BitRate()
+	if bandwidth <= 0 {
+		bandwidth = defaultVariantBandwidth
+	}
+	attrs := []string{fmt.Sprintf("BANDWIDTH=%d", bandwidth)}
+	if info.Codecs != "" {
+		attrs = append(attrs, "CODECS="+hlsQuote(info.Codecs))
+	}
+	if videos := info.Probe.StreamsOfType("video"); len(videos) > 0 && videos[0].Width > 0 && videos[0].Height > 0 {
+		attrs = append(attrs, fmt.Sprintf("RESOLUTION=%dx%d", videos[0].Width, videos[0].Height))
+	}
+	if hasAudioGroup {
+		attrs = append(attrs, "AUDIO="+hlsQuote(audioGroupID))
+	}
+	if len(info.Subtitles) > 0 {
+		attrs = append(attrs, "SUBTITLES="+hlsQuote(subtitleGroupID))
+	}
+	b.WriteString("#EXT-X-STREAM-INF:" + strings.Join(attrs, ",") + "\n")
+	b.WriteString(mediaPlaylistName + "\n")
+
+	return b.String()
+}
+
+// variantCodecs returns the CODECS attribute for an fMP4 stream's variant: the video codec read
+// from its init segment, followed by AAC when the stream has audio, e.g. "hvc1.1.6.L120.90,mp4a.40.2".
+// Players need it to tell whether they can decode HEVC or AV1 before fetching any segment. It
+// returns "" when the video codec can't be determined, since an incomplete list is worse than none.
+func variantCodecs(hlsDir string, hasAudio bool) string {
+	video := codecStringFromInitSegment(filepath.Join(hlsDir, "init.mp4"))
+	if video == "" {
+		return ""
+	}
+	if hasAudio {
+		return video + ",mp4a.40.2" // Audio renditions are always encoded to AAC-LC
+	}
+	return video
+}
+
+// hlsQuote renders an HLS quoted-string attribute value. Quoted strings may not contain
+// double quotes or line breaks, so those are replaced rather than escaped.
+func hlsQuote(s string) string {
+	return `"` + strings.NewReplacer(`"`, "'", "\r", " ", "\n", " ").Replace(s) + `"`
+}
+
+func hlsBool(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into place,
+// so clients polling the file never observe a partial write.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for %s: %w", path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to move %s into place: %w", path, err)
+	}
+	return nil
+}
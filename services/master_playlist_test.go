@@ -0,0 +1,96 @@
+package services
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mp4Box encodes an ISO BMFF box.
+func mp4Box(boxType string, payload ...[]byte) []byte {
+	body := []byte{}
+	for _, p := range payload {
+		body = append(body, p...)
+	}
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(box, boxType...), body...)
+}
+
+// writeInitSegment writes an init.mp4 whose only track has the given sample entry, holding
+// the decoder configuration box config.
+func writeInitSegment(t *testing.T, dir, entryType string, config []byte) {
+	t.Helper()
+	entry := mp4Box(entryType, make([]byte, visualSampleEntryHeaderSize), config)
+	stsd := mp4Box("stsd", []byte{0, 0, 0, 0, 0, 0, 0, 1}, entry)
+	moov := mp4Box("moov", mp4Box("trak", mp4Box("mdia", mp4Box("minf", mp4Box("stbl", stsd)))))
+	if err := os.WriteFile(filepath.Join(dir, "init.mp4"), append(mp4Box("ftyp", []byte("iso6")), moov...), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVariantCodecs(t *testing.T) {
+	tests := []struct {
+		name      string
+		entryType string
+		config    []byte
+		hasAudio  bool
+		want      string
+	}{
+		{
+			name:      "HEVC Main 10",
+			entryType: "hvc1",
+			// Main 10 profile, compatible with Main 10 only, progressive source, level 5.1.
+			config:   mp4Box("hvcC", []byte{1, 0x02, 0x20, 0, 0, 0, 0x90, 0, 0, 0, 0, 0, 153}),
+			hasAudio: true,
+			want:     "hvc1.2.4.L153.90,mp4a.40.2",
+		},
+		{
+			name:      "AV1 10-bit",
+			entryType: "av01",
+			config:    mp4Box("av1C", []byte{0x81, 0x08, 0x4c}),
+			hasAudio:  true,
+			want:      "av01.0.08M.10,mp4a.40.2",
+		},
+		{
+			name:      "H.264 without audio",
+			entryType: "avc1",
+			config:    mp4Box("avcC", []byte{1, 0x64, 0x00, 0x29}),
+			want:      "avc1.640029",
+		},
+		{
+			name:      "unknown codec",
+			entryType: "vp09",
+			config:    mp4Box("vpcC", []byte{1, 0, 0, 0}),
+			hasAudio:  true,
+			want:      "",
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeInitSegment(t, dir, tt.entryType, tt.config)
+		if got := variantCodecs(dir, tt.hasAudio); got != tt.want {
+			t.Errorf("%s: variantCodecs = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := variantCodecs(t.TempDir(), true); got != "" {
+		t.Errorf("variantCodecs without an init segment = %q, want none", got)
+	}
+}
+
+func TestBuildMasterPlaylistCodecs(t *testing.T) {
+	info := &StreamInfo{
+		Options:     StreamOptions{Profile: "hevc"},
+		AudioTracks: []AudioTrack{{ID: "a0", Name: "English", Default: true}},
+	}
+	if playlist := buildMasterPlaylist(info); strings.Contains(playlist, "CODECS=") {
+		t.Errorf("listed CODECS before they were known:\n%s", playlist)
+	}
+
+	info.Codecs = "hvc1.2.4.L153.90,mp4a.40.2"
+	playlist := buildMasterPlaylist(info)
+	if !strings.Contains(playlist, `#EXT-X-STREAM-INF:BANDWIDTH=5000000,CODECS="hvc1.2.4.L153.90,mp4a.40.2"`) {
+		t.Errorf("variant lacks CODECS:\n%s", playlist)
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mediaPlaylist is the parsed content of an HLS media playlist written by ffmpeg.
+type mediaPlaylist struct {
+	InitURI  string // EXT-X-MAP URI, for fMP4 playlists
+	Segments []playlistSegment
+	Ended    bool // EXT-X-ENDLIST seen: ffmpeg has finished writing this rendition
+}
+
+// playlistSegment is a single media segment of a media playlist.
+type playlistSegment struct {
+	URI      string
+	Duration float64 // Seconds
+}
+
+// TotalDuration returns the sum of all segment durations, in seconds.
+func (p *mediaPlaylist) TotalDuration() float64 {
+	var total float64
+	for _, seg := range p.Segments {
+		total += seg.Duration
+	}
+	return total
+}
+
+// readMediaPlaylist parses the subset of the HLS media playlist format that ffmpeg emits.
+func readMediaPlaylist(path string) (*mediaPlaylist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	playlist := &mediaPlaylist{}
+	pendingDuration := -1.0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			playlist.InitURI = playlistAttr(strings.TrimPrefix(line, "#EXT-X-MAP:"), "URI")
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			d, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid EXTINF in %s: %q", path, line)
+			}
+			pendingDuration = d
+		case line == "#EXT-X-ENDLIST":
+			playlist.Ended = true
+		case strings.HasPrefix(line, "#"):
+			// Other tags aren't needed.
+		default:
+			if pendingDuration < 0 {
+				return nil, fmt.Errorf("segment without EXTINF in %s: %q", path, line)
+			}
+			playlist.Segments = append(playlist.Segments, playlistSegment{URI: line, Duration: pendingDuration})
+			pendingDuration = -1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return playlist, nil
+}
+
+// playlistAttr returns the value of a (possibly quoted) attribute in an HLS attribute list.
+func playlistAttr(list, name string) string {
+	for len(list) > 0 {
+		key, rest, ok := strings.Cut(list, "=")
+		if !ok {
+			return ""
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return ""
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if strings.TrimSpace(key) == name {
+			return value
+		}
+		list = strings.TrimPrefix(rest, ",")
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// MediaProbe holds the subset of ffprobe output needed to plan a transcode.
+type MediaProbe struct {
+	Format  ProbeFormat   `json:"format"`
+	Streams []ProbeStream `json:"streams"`
+}
+
+// ProbeFormat describes the container as reported by ffprobe.
+type ProbeFormat struct {
+	FormatName string `json:"format_name"`
+	Duration   string `json:"duration"` // Seconds, as a decimal string
+	BitRate    string `json:"bit_rate"` // Bits per second, as a decimal string
+}
+
+// ProbeStream describes a single elementary stream as reported by ffprobe.
+type ProbeStream struct {
+	Index     int    `json:"index"`      // Absolute stream index, usable as "-map 0:<index>"
+	CodecType string `json:"codec_type"` // "video", "audio", "subtitle", ...
+	CodecName string `json:"codec_name"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Channels  int    `json:"channels,omitempty"`
+	Tags      struct {
+		Language string `json:"language"`
+		Title    string `json:"title"`
+	} `json:"tags"`
+	Disposition struct {
+		Default int `json:"default"`
+		Forced  int `json:"forced"`
+	} `json:"disposition"`
+}
+
+// DurationSeconds returns the container duration, or 0 if it is unknown.
+func (p *MediaProbe) DurationSeconds() float64 {
+	if p == nil {
+		return 0
+	}
+	d, err := strconv.ParseFloat(p.Format.Duration, 64)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// BitRate returns the overall container bit rate, or 0 if it is unknown.
+func (p *MediaProbe) BitRate() int64 {
+	if p == nil {
+		return 0
+	}
+	b, err := strconv.ParseInt(p.Format.BitRate, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return b
+}
+
+// StreamsOfType returns the streams of the given codec type in container order.
+func (p *MediaProbe) StreamsOfType(codecType string) []ProbeStream {
+	if p == nil {
+		return nil
+	}
+	var streams []ProbeStream
+	for _, st := range p.Streams {
+		if st.CodecType == codecType {
+			streams = append(streams, st)
+		}
+	}
+	return streams
+}
+
+// probeMedia runs ffprobe over the given reader and returns the parsed stream list.
+// ffprobe only reads as much of the input as it needs to identify the streams.
+func probeMedia(r io.Reader) (*MediaProbe, error) {
+	cmd := exec.Command(FFprobePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		"-i", "pipe:0",
+	)
+	cmd.Stdin = r
+	// ffprobe exits long before the torrent reader is exhausted; don't wait for the
+	// stdin copy to notice once the process is gone.
+	cmd.WaitDelay = 5 * time.Second
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil && stdout.Len() == 0 {
+		return nil, fmt.Errorf("ffprobe failed: %w: %s", err, stderr.String())
+	}
+
+	var probe MediaProbe
+	if err := json.Unmarshal(stdout.Bytes(), &probe); err != nil {
+		return nil, fmt.Errorf("failed to decode ffprobe output: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return nil, fmt.Errorf("ffprobe found no streams")
+	}
+	return &probe, nil
+}
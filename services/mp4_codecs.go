@@ -0,0 +1,148 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"os"
+	"strings"
+)
+
+// visualSampleEntryHeaderSize is the size of the fixed VisualSampleEntry fields (ISO/IEC 14496-12)
+// that precede its child boxes, such as avcC.
+const visualSampleEntryHeaderSize = 78
+
+// codecStringFromInitSegment reads an fMP4 init segment and returns the RFC 6381 codecs string
+// of its first track, e.g. "avc1.640029", as needed by DASH manifests. Audio written by this
+// service is always AAC-LC. It returns "" if the codec can't be determined.
+func codecStringFromInitSegment(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	stsd := findBox(data, "moov", "trak", "mdia", "minf", "stbl", "stsd")
+	if len(stsd) < 8 {
+		return ""
+	}
+	// stsd is a full box (version + flags) followed by an entry count.
+	entryType, entry, ok := nextBox(stsd[8:])
+	if !ok {
+		return ""
+	}
+
+	switch entryType {
+	case "mp4a":
+		return "mp4a.40.2"
+	case "avc1", "avc3":
+		if len(entry) < visualSampleEntryHeaderSize {
+			return ""
+		}
+		if avcC := findBox(entry[visualSampleEntryHeaderSize:], "avcC"); len(avcC) >= 4 {
+			return fmt.Sprintf("%s.%02x%02x%02x", entryType, avcC[1], avcC[2], avcC[3])
+		}
+	case "hvc1", "hev1":
+		if len(entry) < visualSampleEntryHeaderSize {
+			return ""
+		}
+		if hvcC := findBox(entry[visualSampleEntryHeaderSize:], "hvcC"); len(hvcC) >= 13 {
+			return hevcCodecString(entryType, hvcC)
+		}
+	case "av01":
+		if len(entry) < visualSampleEntryHeaderSize {
+			return ""
+		}
+		if av1C := findBox(entry[visualSampleEntryHeaderSize:], "av1C"); len(av1C) >= 3 {
+			return av1CodecString(av1C)
+		}
+	}
+	return ""
+}
+
+// hevcCodecString formats an HEVCDecoderConfigurationRecord as per ISO/IEC 14496-15 Annex E,
+// e.g. "hvc1.2.4.L153.B0".
+func hevcCodecString(entryType string, hvcC []byte) string {
+	profileSpace := hvcC[1] >> 6
+	tier := "L"
+	if hvcC[1]&0x20 != 0 {
+		tier = "H"
+	}
+	profileIdc := hvcC[1] & 0x1f
+	compat := bits.Reverse32(binary.BigEndian.Uint32(hvcC[2:6]))
+	level := hvcC[12]
+
+	var b strings.Builder
+	b.WriteString(entryType + ".")
+	if profileSpace > 0 {
+		b.WriteByte('A' + profileSpace - 1)
+	}
+	fmt.Fprintf(&b, "%d.%x.%s%d", profileIdc, compat, tier, level)
+
+	// Constraint flags, with trailing zero bytes omitted.
+	constraints := hvcC[6:12]
+	last := len(constraints)
+	for last > 0 && constraints[last-1] == 0 {
+		last--
+	}
+	for _, c := range constraints[:last] {
+		fmt.Fprintf(&b, ".%X", c)
+	}
+	return b.String()
+}
+
+// av1CodecString formats an AV1CodecConfigurationRecord as per the AV1 ISOBMFF binding,
+// e.g. "av01.0.08M.10".
+func av1CodecString(av1C []byte) string {
+	profile := av1C[1] >> 5
+	level := av1C[1] & 0x1f
+	tier := "M"
+	if av1C[2]&0x80 != 0 {
+		tier = "H"
+	}
+	depth := 8
+	if av1C[2]&0x40 != 0 {
+		depth = 10
+		if profile == 2 && av1C[2]&0x20 != 0 {
+			depth = 12
+		}
+	}
+	return fmt.Sprintf("av01.%d.%02d%s.%02d", profile, level, tier, depth)
+}
+
+// findBox descends through nested ISO BMFF boxes by type and returns the payload of the last one.
+func findBox(data []byte, path ...string) []byte {
+	for _, want := range path {
+		found := false
+		for len(data) > 0 {
+			boxType, payload, ok := nextBox(data)
+			if !ok {
+				return nil
+			}
+			size := len(payload) + 8
+			if boxType == want {
+				data, found = payload, true
+				break
+			}
+			data = data[size:]
+		}
+		if !found {
+			return nil
+		}
+	}
+	return data
+}
+
+// nextBox returns the type and payload of the first box in data. 64-bit box sizes aren't
+// supported; init segments never need them.
+func nextBox(data []byte) (boxType string, payload []byte, ok bool) {
+	if len(data) < 8 {
+		return "", nil, false
+	}
+	size := int(binary.BigEndian.Uint32(data[:4]))
+	if size == 0 {
+		size = len(data) // Box extends to the end of the data
+	}
+	if size < 8 || size > len(data) {
+		return "", nil, false
+	}
+	return string(data[4:8]), data[8:size], true
+}
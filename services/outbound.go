@@ -0,0 +1,206 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrQuotaExceeded is returned when a provider rejects a request for exceeding its rate
+	// limit or API quota.
+	ErrQuotaExceeded = errors.New("provider quota exceeded")
+	// ErrUpstreamUnavailable is returned when a provider can't be reached or fails with a
+	// server error, even after retrying.
+	ErrUpstreamUnavailable = errors.New("provider unavailable")
+)
+
+// UpstreamErrorCode returns the API error code for provider errors: "quota_exceeded",
+// "upstream_unavailable", "blocked", or "" for any other error.
+func UpstreamErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrScraperBlocked):
+		return "blocked"
+	case errors.Is(err, ErrQuotaExceeded):
+		return "quota_exceeded"
+	case errors.Is(err, ErrUpstreamUnavailable):
+		return "upstream_unavailable"
+	}
+	return ""
+}
+
+// upstreamStatusError describes a failed provider response, wrapping ErrQuotaExceeded for
+// 429s and ErrUpstreamUnavailable for 5xx statuses. detail may be empty.
+func upstreamStatusError(provider string, resp *http.Response, detail string) error {
+	msg := fmt.Sprintf("%s request failed with status %s", provider, resp.Status)
+	if detail != "" {
+		msg += ": " + detail
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s", ErrQuotaExceeded, msg)
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%w: %s", ErrUpstreamUnavailable, msg)
+	}
+	return errors.New(msg)
+}
+
+// OutboundLimits configures the outbound HTTP layer shared by the metadata, torrent search
+// and subtitle providers.
+type OutboundLimits struct {
+	// Rate is the sustained request rate allowed per host, in requests per second, with bursts
+	// of up to Burst requests. Zero disables rate limiting.
+	Rate  float64
+	Burst int
+	// HostRates overrides Rate for specific hosts, e.g. {"www.omdbapi.com": 1}.
+	HostRates map[string]float64
+
+	// MaxRetries bounds the retries of idempotent requests that failed with a network error,
+	// a 429 or a 502/503/504.
+	MaxRetries int
+	// BaseDelay is the first retry delay; each retry doubles it, up to MaxDelay, with jitter.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxRetryAfter is the longest Retry-After a provider may ask for before the response is
+	// returned instead of waited out.
+	MaxRetryAfter time.Duration
+}
+
+// DefaultOutboundLimits allows 5 requests per second per host and retries twice. The TMDB API
+// allows around 50 requests per second, and a title search page costs up to 21 requests, so
+// its host gets 20.
+var DefaultOutboundLimits = OutboundLimits{
+	Rate:          5,
+	Burst:         5,
+	HostRates:     map[string]float64{"api.themoviedb.org": 20},
+	MaxRetries:    2,
+	BaseDelay:     500 * time.Millisecond,
+	MaxDelay:      10 * time.Second,
+	MaxRetryAfter: 30 * time.Second,
+}
+
+// OutboundTransport is an http.RoundTripper that rate-limits requests per host and retries
+// idempotent requests on transient failures, honouring Retry-After. Install it as the
+// Transport of every provider's http.Client so that they share its limits.
+type OutboundTransport struct {
+	Base   http.RoundTripper // nil means http.DefaultTransport
+	Limits OutboundLimits
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// NewOutboundTransport creates an OutboundTransport over base.
+func NewOutboundTransport(base http.RoundTripper, limits OutboundLimits) *OutboundTransport {
+	return &OutboundTransport{Base: base, Limits: limits, limiters: map[string]*rate.Limiter{}}
+}
+
+func (t *OutboundTransport) limiter(host string) *rate.Limiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.limiters == nil {
+		t.limiters = map[string]*rate.Limiter{}
+	}
+	l, ok := t.limiters[host]
+	if !ok {
+		r, ok := t.Limits.HostRates[host]
+		if !ok {
+			r = t.Limits.Rate
+		}
+		if r <= 0 {
+			l = rate.NewLimiter(rate.Inf, 0)
+		} else {
+			l = rate.NewLimiter(rate.Limit(r), max(t.Limits.Burst, 1))
+		}
+		t.limiters[host] = l
+	}
+	return l
+}
+
+// RoundTrip sends the request, waiting for the host's rate limit and retrying transient failures.
+// Network errors that outlast the retries wrap ErrUpstreamUnavailable.
+func (t *OutboundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx := req.Context()
+	limiter := t.limiter(req.URL.Hostname())
+	idempotent := (req.Method == http.MethodGet || req.Method == http.MethodHead) && req.Body == nil
+
+	for attempt := 0; ; attempt++ {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		resp, err := base.RoundTrip(req)
+		if !idempotent || attempt >= t.Limits.MaxRetries || ctx.Err() != nil {
+			if err != nil && ctx.Err() == nil {
+				err = fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+			}
+			return resp, err
+		}
+
+		var delay time.Duration
+		switch {
+		case err != nil:
+			delay = t.backoff(attempt)
+		case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusBadGateway,
+			resp.StatusCode == http.StatusServiceUnavailable, resp.StatusCode == http.StatusGatewayTimeout:
+			var ok bool
+			if delay, ok = retryAfter(resp.Header.Get("Retry-After"), time.Now()); !ok {
+				delay = t.backoff(attempt)
+			} else if delay > t.Limits.MaxRetryAfter {
+				return resp, nil // Not worth waiting for; let the caller report it
+			}
+			// Drain a little so the connection can be reused.
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		default:
+			return resp, nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the jittered delay before retry number attempt+1: a random duration
+// between half and all of BaseDelay*2^attempt, capped at MaxDelay.
+func (t *OutboundTransport) backoff(attempt int) time.Duration {
+	d := t.Limits.BaseDelay << attempt
+	if d <= 0 || (t.Limits.MaxDelay > 0 && d > t.Limits.MaxDelay) {
+		d = t.Limits.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testLimits retries without waiting or rate limiting.
+var testLimits = OutboundLimits{MaxRetries: 2, MaxRetryAfter: 30 * time.Second}
+
+// newTestUpstream serves the given statuses in turn, repeating the last one, with the optional
+// Retry-After header on each failure. It returns the server and its request count.
+func newTestUpstream(t *testing.T, retryAfter string, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		status := statuses[min(n, len(statuses))-1]
+		if status != http.StatusOK && retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte("attempt " + http.StatusText(status)))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestOutboundTransportRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		retryAfter string
+		statuses   []int
+		wantStatus int
+		wantTries  int32
+	}{
+		{"succeeds first time", http.MethodGet, "", "", []int{200}, 200, 1},
+		{"retries a 503", http.MethodGet, "", "", []int{503, 200}, 200, 2},
+		{"retries 429s, 502s and 504s", http.MethodHead, "", "", []int{429, 502, 200}, 200, 3},
+		{"gives up after MaxRetries", http.MethodGet, "", "", []int{503}, 503, 3},
+		{"does not retry other errors", http.MethodGet, "", "", []int{500, 200}, 500, 1},
+		{"does not retry client errors", http.MethodGet, "", "", []int{404, 200}, 404, 1},
+		{"Retry-After in seconds", http.MethodGet, "", "0", []int{429, 200}, 200, 2},
+		{"Retry-After as a past date", http.MethodGet, "", "Mon, 02 Jan 2006 15:04:05 GMT", []int{429, 200}, 200, 2},
+		{"Retry-After beyond MaxRetryAfter", http.MethodGet, "", "3600", []int{429, 200}, 429, 1},
+		{"invalid Retry-After", http.MethodGet, "", "soon", []int{503, 200}, 200, 2},
+		{"POST is not retried", http.MethodPost, "", "", []int{503, 200}, 503, 1},
+		{"GET with a body is not retried", http.MethodGet, "q", "", []int{503, 200}, 503, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newTestUpstream(t, tt.retryAfter, tt.statuses...)
+			client := &http.Client{Transport: NewOutboundTransport(nil, testLimits)}
+
+			req, err := http.NewRequest(tt.method, server.URL, nil)
+			if tt.body != "" {
+				req, err = http.NewRequest(tt.method, server.URL, strings.NewReader(tt.body))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if n := requests.Load(); n != tt.wantTries {
+				t.Errorf("sent %d requests, want %d", n, tt.wantTries)
+			}
+		})
+	}
+}
+
+func TestOutboundTransportNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close() // Connections are now refused
+
+	client := &http.Client{Transport: NewOutboundTransport(nil, testLimits)}
+	_, err := client.Get(url)
+	if !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("got %v, want an ErrUpstreamUnavailable", err)
+	}
+}
+
+func TestUpstreamStatusError(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+		code   string
+	}{
+		{http.StatusTooManyRequests, ErrQuotaExceeded, "quota_exceeded"},
+		{http.StatusServiceUnavailable, ErrUpstreamUnavailable, "upstream_unavailable"},
+		{http.StatusInternalServerError, ErrUpstreamUnavailable, "upstream_unavailable"},
+		{http.StatusNotFound, nil, ""},
+	}
+	for _, tt := range tests {
+		server, _ := newTestUpstream(t, "", tt.status)
+		client := &http.Client{Transport: NewOutboundTransport(nil, OutboundLimits{})}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		err = upstreamStatusError("test", resp, "detail")
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%d: got %v, want %v", tt.status, err, tt.want)
+		}
+		if code := UpstreamErrorCode(err); code != tt.code {
+			t.Errorf("%d: code = %q, want %q", tt.status, code, tt.code)
+		}
+		if !strings.Contains(err.Error(), "test request failed with status") || !strings.HasSuffix(err.Error(), ": detail") {
+			t.Errorf("%d: message = %q", tt.status, err)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.June, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 0 ", 0, true},
+		{"Mon, 10 Jun 2024 12:00:30 GMT", 30 * time.Second, true},
+		{"Mon, 10 Jun 2024 11:00:00 GMT", 0, true}, // Already past
+		{"", 0, false},
+		{"-5", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := retryAfter(tt.header, now); got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tr := NewOutboundTransport(nil, OutboundLimits{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+	for attempt, ceiling := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for i := 0; i < 20; i++ {
+			if d := tr.backoff(attempt); d < ceiling/2 || d > ceiling {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", attempt, d, ceiling/2, ceiling)
+			}
+		}
+	}
+	// A shift past the int64 range is capped too.
+	if d := tr.backoff(70); d < 500*time.Millisecond || d > time.Second {
+		t.Errorf("backoff(70) = %v, want it capped at MaxDelay", d)
+	}
+	if d := NewOutboundTransport(nil, OutboundLimits{}).backoff(3); d != 0 {
+		t.Errorf("backoff without delays = %v, want 0", d)
+	}
+}
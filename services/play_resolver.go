@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"torrent-play/release"
+)
+
+// ErrNoSuitableTorrent is returned when a title's torrent search finds nothing worth playing.
+var ErrNoSuitableTorrent = errors.New("no suitable torrent found")
+
+// PlayPreferences is the policy used to pick a torrent for a title.
+type PlayPreferences struct {
+	// Resolutions lists acceptable vertical resolutions, most preferred first. Torrents of
+	// other known resolutions are rejected; torrents of unknown resolution rank last.
+	Resolutions []int
+	MinSeeders  int
+	MaxSize     int64 // Bytes; zero means no limit
+}
+
+// DefaultPlayPreferences favours 1080p, then 720p, then 2160p, then 480p, with at least one seeder.
+var DefaultPlayPreferences = PlayPreferences{
+	Resolutions: []int{1080, 720, 2160, 480},
+	MinSeeders:  1,
+}
+
+// PlayCandidate is a torrent considered for playback, with how it scored.
+type PlayCandidate struct {
+	TorrentSearchResult
+	Resolution int     `json:"resolution,omitempty"` // 0 if unknown
+	Score      float64 `json:"score"`
+}
+
+// PlayResolver turns an IMDb ID into a ranked list of torrents to stream.
+type PlayResolver struct {
+	Titles      ImdbSearcher
+	Torrents    TorrentSearcher
+	Preferences PlayPreferences
+}
+
+// NewPlayResolver creates a PlayResolver with the given preferences.
+func NewPlayResolver(titles ImdbSearcher, torrents TorrentSearcher, prefs PlayPreferences) *PlayResolver {
+	return &PlayResolver{Titles: titles, Torrents: torrents, Preferences: prefs}
+}
+
+// Resolve looks up the title, searches for its torrents and returns the acceptable ones, best
+// first. season and episode select an episode of a series; zero means none (or a whole season
+// when only episode is zero).
+func (r *PlayResolver) Resolve(ctx context.Context, imdbID string, season, episode int) (*SearchResult, []PlayCandidate, error) {
+	title, err := r.Titles.LookupByID(ctx, imdbID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Searchers that support it, such as Torznab indexers, search by IMDb ID or episode.
+	query := titleTorrentQuery(imdbID, title, season, episode)
+	results, err := searchTitleTorrents(ctx, r.Torrents, query)
+	var partial *PartialSearchError
+	if err != nil && !errors.As(err, &partial) {
+		return title, nil, fmt.Errorf("torrent search for %q failed: %w", query, err)
+	}
+
+	// Sizes are judged against a movie's; episodes are expected at a third of that, and
+	// season packs, whose episode count is unknown, aren't judged.
+	sizeScale := 1.0
+	switch {
+	case season > 0 && episode > 0:
+		sizeScale = 1.0 / 3
+	case season > 0:
+		sizeScale = 0
+	}
+
+	var candidates []PlayCandidate
+	for _, result := range results {
+		info := releaseInfo(result)
+		// Text searches also find other titles; only the looked-up one is worth streaming.
+		if !matchesTitle(info, query) {
+			continue
+		}
+		if season > 0 && !matchesEpisode(info, season, episode) {
+			continue
+		}
+		if c, ok := r.score(result, sizeScale); ok {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return title, nil, fmt.Errorf("%w for %q", ErrNoSuitableTorrent, query)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return title, candidates, nil
+}
+
+// score rates a torrent against the preferences. Seeders count logarithmically, so a well-seeded
+// 1080p release beats a slightly better-seeded 720p one, but a dead 1080p release doesn't win.
+// Sizes far outside what the resolution calls for lose points; see sizePenalty.
+func (r *PlayResolver) score(result TorrentSearchResult, sizeScale float64) (PlayCandidate, bool) {
+	prefs := r.Preferences
+	c := PlayCandidate{TorrentSearchResult: result, Resolution: releaseInfo(result).Resolution}
+	if result.Seeders < prefs.MinSeeders {
+		return c, false
+	}
+	if prefs.MaxSize > 0 && result.Size > prefs.MaxSize {
+		return c, false
+	}
+
+	c.Score = 10 * math.Log10(float64(result.Seeders)+1)
+	if c.Resolution > 0 && len(prefs.Resolutions) > 0 {
+		rank := -1
+		for i, res := range prefs.Resolutions {
+			if res == c.Resolution {
+				rank = i
+				break
+			}
+		}
+		if rank < 0 {
+			return c, false
+		}
+		c.Score += float64(len(prefs.Resolutions)-rank) * 10
+	}
+	c.Score -= sizePenalty(result.Size, c.Resolution, sizeScale)
+	return c, true
+}
+
+// playSizeRanges are the sizes, in GiB, expected of a feature-length movie at each resolution.
+// Much smaller releases are usually poor re-encodes or fakes; much larger ones, such as
+// remuxes, are slow to buffer.
+var playSizeRanges = map[int][2]float64{
+	360:  {0.2, 1},
+	480:  {0.3, 2},
+	540:  {0.4, 2.5},
+	576:  {0.4, 3},
+	720:  {0.6, 5},
+	1080: {1.2, 16},
+	1440: {2, 25},
+	2160: {4, 40},
+}
+
+// sizePenalty returns how far size lies outside the expected range for the resolution, scaled
+// by sizeScale: 10 points per doubling, up to 30. Unknown sizes and resolutions, and a zero
+// scale, cost nothing.
+func sizePenalty(size int64, resolution int, sizeScale float64) float64 {
+	expected, ok := playSizeRanges[resolution]
+	if !ok || size <= 0 || sizeScale <= 0 {
+		return 0
+	}
+	gib := float64(size) / (1 << 30) / sizeScale
+	var ratio float64
+	switch {
+	case gib < expected[0]:
+		ratio = expected[0] / gib
+	case gib > expected[1]:
+		ratio = gib / expected[1]
+	default:
+		return 0
+	}
+	return min(10*math.Log2(ratio), 30)
+}
+
+// titleTorrentQuery builds the torrent search query for a title.
+func titleTorrentQuery(imdbID string, title *SearchResult, season, episode int) TitleTorrentQuery {
+	q := TitleTorrentQuery{ImdbID: imdbID, Season: season, Episode: episode}
+	// Release names drop apostrophes and colons: "Schindler's List" is "Schindlers List".
+	q.Title = strings.Join(strings.Fields(strings.NewReplacer("'", "", ":", " ").Replace(title.Title)), " ")
+	if season == 0 {
+		// Series years look like "2008–2013"; only the start year helps a movie query.
+		q.Year, _, _ = strings.Cut(title.Year, "–")
+	}
+	return q
+}
+
+// matchesTitle reports whether a release is of the queried title: its parsed title must match
+// and, when both are known, its year must be within one of the query's, since release years
+// sometimes follow a festival premiere or a later local release.
+func matchesTitle(info release.Info, q TitleTorrentQuery) bool {
+	if normalizeReleaseTitle(info.Title) != normalizeReleaseTitle(q.Title) {
+		return false
+	}
+	year, err := strconv.Atoi(q.Year)
+	if err != nil || info.Year == 0 {
+		return true
+	}
+	return info.Year >= year-1 && info.Year <= year+1
+}
+
+// normalizeReleaseTitle reduces a title to lower-case words, so that "The Lord of the Rings:
+// The Two Towers" and "Lord.of.the.Rings.The.Two.Towers" compare equal.
+func normalizeReleaseTitle(title string) string {
+	title = strings.NewReplacer("'", "", "’", "", "&", " and ").Replace(strings.ToLower(title))
+	words := strings.FieldsFunc(title, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// matchesEpisode reports whether a release is for the given episode, or for the whole season
+// when episode is zero. Multi-episode releases and season packs are rejected for a single
+// episode: streams play the largest file of a torrent, which needn't be the one asked for.
+func matchesEpisode(info release.Info, season, episode int) bool {
+	if info.Season != season {
+		return false
+	}
+	if episode == 0 {
+		return info.Episode == 0 // A season pack, not a single episode
+	}
+	return info.Episode == episode && (info.EpisodeEnd == 0 || info.EpisodeEnd == episode)
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"torrent-play/release"
+)
+
+const gib = 1 << 30
+
+func TestSizePenalty(t *testing.T) {
+	tests := []struct {
+		size       int64
+		resolution int
+		scale      float64
+		want       float64
+	}{
+		{8 * gib, 1080, 1, 0},       // Within range
+		{16 * gib, 1080, 1, 0},      // At the upper bound
+		{32 * gib, 1080, 1, 10},     // One doubling over
+		{gib * 6 / 10, 1080, 1, 10}, // One doubling under 1.2 GiB
+		{2 * gib, 1080, 1.0 / 3, 0}, // A reasonable 1080p episode
+		{64 * gib, 720, 1, 30},      // Capped
+		{0, 1080, 1, 0},             // Unknown size
+		{100 * gib, 0, 1, 0},        // Unknown resolution
+		{100 * gib, 1080, 0, 0},     // Not judged
+	}
+	for _, tt := range tests {
+		if got := sizePenalty(tt.size, tt.resolution, tt.scale); math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("sizePenalty(%d, %d, %.2f) = %.2f, want %.2f", tt.size, tt.resolution, tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestPlayResolverPrefersSensibleSizes(t *testing.T) {
+	torrents := &textOnlySearcher{results: []TorrentSearchResult{
+		{Title: "Movie 2020 1080p BluRay REMUX", MagnetURL: "magnet:?xt=urn:btih:1", Seeders: 60, Size: 70 * gib},
+		{Title: "Movie 2020 1080p BluRay x264", MagnetURL: "magnet:?xt=urn:btih:2", Seeders: 40, Size: 10 * gib},
+		{Title: "Movie 2020 1080p WEB", MagnetURL: "magnet:?xt=urn:btih:3", Seeders: 50, Size: 200 << 20},
+		{Title: "Movie 2020 720p WEB", MagnetURL: "magnet:?xt=urn:btih:4", Seeders: 40, Size: 2 * gib},
+	}}
+	titles := fixedTitles{SearchResult{Title: "Movie", Year: "2020", ImdbID: "tt1", Type: "movie"}}
+	resolver := NewPlayResolver(titles, torrents, DefaultPlayPreferences)
+
+	_, candidates, err := resolver.Resolve(context.Background(), "tt1", 0, 0)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	var order []string
+	for _, c := range candidates {
+		order = append(order, c.MagnetURL[len("magnet:?xt=urn:btih:"):])
+	}
+	// The sensibly sized 1080p release first; the remux and the tiny 1080p one fall behind
+	// the 720p release despite more seeders.
+	if want := []string{"2", "4", "1", "3"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
+
+func TestMatchesTitle(t *testing.T) {
+	tests := []struct {
+		release string
+		title   string
+		year    string
+		want    bool
+	}{
+		{"The.Lord.of.the.Rings.The.Two.Towers.2002.1080p.BluRay.x264", "The Lord of the Rings The Two Towers", "2002", true},
+		{"Schindler's List (1993) 720p", "Schindlers List", "1993", true},
+		{"Fast & Furious 2009 720p", "Fast and Furious", "2009", true},
+		{"Matrix 1999 1080p", "The Matrix", "1999", true},
+		{"The Matrix 2000 1080p", "The Matrix", "1999", true}, // A year out is tolerated
+		{"The Matrix Reloaded 2003 1080p", "The Matrix", "1999", false},
+		{"The Matrix 1080p", "The Matrix", "1999", true}, // No year in the release name
+		{"Dune 1984 1080p", "Dune", "2021", false},
+		{"Dune Part Two 2024 2160p", "Dune", "2021", false},
+		{"Breaking.Bad.S01E02.720p", "Breaking Bad", "", true},
+		{"Better.Call.Saul.S01E02.720p", "Breaking Bad", "", false},
+	}
+	for _, tt := range tests {
+		info := release.Parse(tt.release)
+		if got := matchesTitle(info, TitleTorrentQuery{Title: tt.title, Year: tt.year}); got != tt.want {
+			t.Errorf("matchesTitle(%q, %q %s) = %v, want %v", tt.release, tt.title, tt.year, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesEpisode(t *testing.T) {
+	tests := []struct {
+		release         string
+		season, episode int
+		want            bool
+	}{
+		{"Show.S01E02.720p", 1, 2, true},
+		{"Show.S01E02.720p", 1, 3, false},
+		{"Show.S02E02.720p", 1, 2, false},
+		{"Show.S01E01-E03.720p", 1, 2, false}, // The largest file needn't be episode 2
+		{"Show.S01.1080p", 1, 2, false},
+		{"Show.S01.1080p", 1, 0, true},
+		{"Show.S01E02.720p", 1, 0, false},
+	}
+	for _, tt := range tests {
+		if got := matchesEpisode(release.Parse(tt.release), tt.season, tt.episode); got != tt.want {
+			t.Errorf("matchesEpisode(%q, %d, %d) = %v, want %v", tt.release, tt.season, tt.episode, got, tt.want)
+		}
+	}
+}
+
+func TestPlayResolverSkipsOtherTitles(t *testing.T) {
+	torrents := &textOnlySearcher{results: []TorrentSearchResult{
+		{Title: "Alien Resurrection 1997 1080p BluRay x264", MagnetURL: "magnet:?xt=urn:btih:1", Seeders: 900, Size: 8 * gib},
+		{Title: "Aliens 1986 1080p BluRay x264", MagnetURL: "magnet:?xt=urn:btih:2", Seeders: 800, Size: 8 * gib},
+		{Title: "Alien 1979 1080p BluRay x264", MagnetURL: "magnet:?xt=urn:btih:3", Seeders: 20, Size: 8 * gib},
+	}}
+	titles := fixedTitles{SearchResult{Title: "Alien", Year: "1979", ImdbID: "tt0078748", Type: "movie"}}
+	resolver := NewPlayResolver(titles, torrents, DefaultPlayPreferences)
+
+	_, candidates, err := resolver.Resolve(context.Background(), "tt0078748", 0, 0)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].MagnetURL != "magnet:?xt=urn:btih:3" {
+		t.Errorf("candidates = %+v, want only Alien (1979)", candidates)
+	}
+}
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRSSPollInterval is used when the rules file doesn't set an interval.
+const DefaultRSSPollInterval = 15 * time.Minute
+
+// rssInfoTimeout bounds how long a torrent grabbed in download mode may take to fetch its
+// metadata; magnets nobody seeds are dropped after it.
+const rssInfoTimeout = 10 * time.Minute
+
+// RSSGrabMode says what happens to a torrent matched by an RSS rule.
+type RSSGrabMode string
+
+const (
+	RSSModeStream   RSSGrabMode = "stream"   // Start a stream with the rule's options, ready to play
+	RSSModeDownload RSSGrabMode = "download" // Only download the torrent
+)
+
+// RSSFeed is a feed to poll. Any RSS feed works, including Torznab feeds; items need a magnet
+// link or an infohash.
+type RSSFeed struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+// RSSRule decides which feed items are grabbed and how.
+type RSSRule struct {
+	Name string `yaml:"name"`
+	// Title is a regular expression matched against the item title.
+	Title string `yaml:"title"`
+	// Quality lists acceptable quality tags such as "1080p"; the title must contain one of
+	// them. Empty accepts any quality.
+	Quality []string `yaml:"quality"`
+	// MinSize and MaxSize bound the torrent size, e.g. "500MB" or "4 GiB". Items whose size
+	// is unknown pass.
+	MinSize string `yaml:"minSize"`
+	MaxSize string `yaml:"maxSize"`
+	// Episodes grabs each season/episode only once, whichever release comes first.
+	Episodes bool `yaml:"episodes"`
+	// Feeds restricts the rule to the named feeds; empty means every feed.
+	Feeds []string `yaml:"feeds"`
+
+	Mode    RSSGrabMode `yaml:"mode"` // Defaults to RSSModeStream
+	Profile string      `yaml:"profile"`
+	Audio   string      `yaml:"audio"`
+
+	titleRE          *regexp.Regexp
+	minSize, maxSize int64
+}
+
+// RSSConfig is the rules file: feeds to poll, how often, and rules to match against.
+type RSSConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	Feeds    []RSSFeed     `yaml:"feeds"`
+	Rules    []RSSRule     `yaml:"rules"`
+}
+
+// LoadRSSConfig reads and validates a YAML rules file.
+func LoadRSSConfig(path string) (*RSSConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RSS rules: %w", err)
+	}
+	var cfg RSSConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse RSS rules %s: %w", path, err)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultRSSPollInterval
+	}
+	for i, f := range cfg.Feeds {
+		if f.URL == "" {
+			return nil, fmt.Errorf("feed %d has no url", i+1)
+		}
+		if f.Name == "" {
+			cfg.Feeds[i].Name = f.URL
+			if u, err := url.Parse(f.URL); err == nil && u.Host != "" {
+				cfg.Feeds[i].Name = u.Host
+			}
+		}
+	}
+	for i := range cfg.Rules {
+		if err := cfg.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", cfg.Rules[i].Name, err)
+		}
+	}
+	return &cfg, nil
+}
+
+func (r *RSSRule) compile() error {
+	if r.Title == "" {
+		return errors.New("title pattern is required")
+	}
+	re, err := regexp.Compile(r.Title)
+	if err != nil {
+		return fmt.Errorf("invalid title pattern: %w", err)
+	}
+	r.titleRE = re
+	if r.Name == "" {
+		r.Name = r.Title
+	}
+	for _, bound := range []struct {
+		value string
+		out   *int64
+	}{{r.MinSize, &r.minSize}, {r.MaxSize, &r.maxSize}} {
+		if bound.value == "" {
+			continue
+		}
+		n, ok := parseSize(bound.value)
+		if !ok {
+			return fmt.Errorf("invalid size %q", bound.value)
+		}
+		*bound.out = n
+	}
+	switch r.Mode {
+	case "":
+		r.Mode = RSSModeStream
+	case RSSModeStream, RSSModeDownload:
+	default:
+		return fmt.Errorf("unknown mode %q (expected stream or download)", r.Mode)
+	}
+	if _, ok := LookupTranscodeProfile(r.Profile); !ok {
+		return fmt.Errorf("unknown transcode profile %q", r.Profile)
+	}
+	return nil
+}
+
+// matches reports whether an item from the named feed satisfies the rule, ignoring history.
+func (r *RSSRule) matches(feed string, item TorrentSearchResult) bool {
+	if len(r.Feeds) > 0 && !containsFold(r.Feeds, feed) {
+		return false
+	}
+	if !r.titleRE.MatchString(item.Title) {
+		return false
+	}
+	if len(r.Quality) > 0 {
+		title := strings.ToLower(item.Title)
+		found := false
+		for _, q := range r.Quality {
+			if strings.Contains(title, strings.ToLower(q)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if item.Size > 0 {
+		if r.minSize > 0 && item.Size < r.minSize {
+			return false
+		}
+		if r.maxSize > 0 && item.Size > r.maxSize {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// rssState is what the watcher persists between runs.
+type rssState struct {
+	// Grabbed maps the infohashes of grabbed torrents to when they were grabbed.
+	Grabbed map[string]time.Time `json:"grabbed"`
+	// Episodes lists the episode keys ("S01E02", or "S01" for season packs) grabbed per rule name.
+	Episodes map[string][]string `json:"episodes"`
+}
+
+// RSSWatcher polls feeds and grabs items matching the rules.
+type RSSWatcher struct {
+	config    *RSSConfig
+	client    *torrent.Client
+	hls       *HlsService
+	http      *http.Client
+	statePath string
+
+	// grabber starts a matched item; it is w.grab outside tests.
+	grabber func(ctx context.Context, rule *RSSRule, item TorrentSearchResult) error
+
+	mu       sync.Mutex
+	state    rssState
+	grabbing map[string]bool // Keys of items being grabbed, so they aren't grabbed twice
+}
+
+// NewRSSWatcher creates a watcher that fetches feeds through transport (nil means
+// http.DefaultTransport). Grab history is persisted to statePath.
+func NewRSSWatcher(config *RSSConfig, client *torrent.Client, hls *HlsService, transport http.RoundTripper, statePath string) (*RSSWatcher, error) {
+	w := &RSSWatcher{
+		config:    config,
+		client:    client,
+		hls:       hls,
+		http:      &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		statePath: statePath,
+		state:     rssState{Grabbed: map[string]time.Time{}, Episodes: map[string][]string{}},
+		grabbing:  map[string]bool{},
+	}
+	w.grabber = w.grab
+	data, err := os.ReadFile(statePath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read RSS state: %w", err)
+	default:
+		if err := json.Unmarshal(data, &w.state); err != nil {
+			return nil, fmt.Errorf("failed to parse RSS state %s: %w", statePath, err)
+		}
+		if w.state.Grabbed == nil {
+			w.state.Grabbed = map[string]time.Time{}
+		}
+		if w.state.Episodes == nil {
+			w.state.Episodes = map[string][]string{}
+		}
+	}
+	return w, nil
+}
+
+// Run polls every feed immediately and then at the configured interval until ctx is done.
+func (w *RSSWatcher) Run(ctx context.Context) {
+	log.Printf("RSS watcher started: %d feed(s), %d rule(s), every %s", len(w.config.Feeds), len(w.config.Rules), w.config.Interval)
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+	for {
+		w.Poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll checks every feed once.
+func (w *RSSWatcher) Poll(ctx context.Context) {
+	for _, feed := range w.config.Feeds {
+		items, err := w.fetchFeed(ctx, feed)
+		if err != nil {
+			log.Printf("RSS feed %s: %v", feed.Name, err)
+			continue
+		}
+		for _, item := range items {
+			w.consider(ctx, feed, item)
+		}
+	}
+}
+
+func (w *RSSWatcher) fetchFeed(ctx context.Context, feed RSSFeed) ([]TorrentSearchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feed.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/xml, text/xml")
+	resp, err := w.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed request failed with status %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed: %w", err)
+	}
+	// Plain RSS feeds parse the same way as Torznab ones; they just lack the torznab attributes.
+	return parseTorznabFeed(data)
+}
+
+// consider grabs the item with the first rule that matches it, unless it was grabbed before.
+// The lock isn't held while grabbing, which can wait on the network; the item and its
+// episode are reserved instead.
+func (w *RSSWatcher) consider(ctx context.Context, feed RSSFeed, item TorrentSearchResult) {
+	key := item.InfoHash
+	if key == "" {
+		key = item.MagnetURL
+	}
+
+	w.mu.Lock()
+	if _, done := w.state.Grabbed[key]; done || w.grabbing[key] {
+		w.mu.Unlock()
+		return
+	}
+	var rule *RSSRule
+	var episode, episodeKey string
+	for i := range w.config.Rules {
+		r := &w.config.Rules[i]
+		if !r.matches(feed.Name, item) {
+			continue
+		}
+		if r.Episodes {
+			if episode = releaseInfo(item).EpisodeKey(); episode != "" {
+				episodeKey = r.Name + "\x00" + episode
+				if containsFold(w.state.Episodes[r.Name], episode) || w.grabbing[episodeKey] {
+					episode, episodeKey = "", ""
+					continue
+				}
+			}
+		}
+		rule = r
+		break
+	}
+	if rule == nil {
+		w.mu.Unlock()
+		return
+	}
+	w.grabbing[key] = true
+	if episode != "" {
+		w.grabbing[episodeKey] = true
+	}
+	w.mu.Unlock()
+
+	err := w.grabber(ctx, rule, item)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.grabbing, key)
+	delete(w.grabbing, episodeKey)
+	if err != nil {
+		log.Printf("RSS rule %q: failed to grab %s: %v", rule.Name, item.Title, err)
+		return
+	}
+	log.Printf("RSS rule %q grabbed %s (%s)", rule.Name, item.Title, rule.Mode)
+	w.state.Grabbed[key] = time.Now().UTC()
+	if episode != "" {
+		w.state.Episodes[rule.Name] = append(w.state.Episodes[rule.Name], episode)
+	}
+	if err := w.saveState(); err != nil {
+		log.Printf("RSS watcher: %v", err)
+	}
+}
+
+func (w *RSSWatcher) grab(ctx context.Context, rule *RSSRule, item TorrentSearchResult) error {
+	if rule.Mode == RSSModeDownload {
+		t, err := w.client.AddMagnet(item.MagnetURL)
+		if err != nil {
+			return fmt.Errorf("error adding magnet: %w", err)
+		}
+		go func() {
+			select {
+			case <-t.GotInfo():
+				t.DownloadAll()
+			case <-time.After(rssInfoTimeout):
+				log.Printf("RSS rule %q: no metadata for %s after %s; dropping it", rule.Name, item.Title, rssInfoTimeout)
+				t.Drop()
+			case <-ctx.Done():
+				t.Drop()
+			}
+		}()
+		return nil
+	}
+	_, err := w.hls.PrepareStream(ctx, item.MagnetURL, StreamOptions{
+		Audio:   rule.Audio,
+		Profile: rule.Profile,
+	})
+	return err
+}
+
+// saveState persists the grab history. The caller must hold w.mu.
+func (w *RSSWatcher) saveState() error {
+	data, err := json.MarshalIndent(w.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode RSS state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(w.statePath), 0750); err != nil {
+		return fmt.Errorf("failed to create RSS state dir: %w", err)
+	}
+	return writeFileAtomic(w.statePath, data)
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func compiledRule(t *testing.T, r RSSRule) RSSRule {
+	t.Helper()
+	if err := r.compile(); err != nil {
+		t.Fatalf("compile %+v: %v", r, err)
+	}
+	return r
+}
+
+func TestRSSRuleMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		rule RSSRule
+		feed string
+		item TorrentSearchResult
+		want bool
+	}{
+		{"title", RSSRule{Title: `(?i)^some\.show\.`}, "f", TorrentSearchResult{Title: "Some.Show.S01E01.720p"}, true},
+		{"other title", RSSRule{Title: `(?i)^some\.show\.`}, "f", TorrentSearchResult{Title: "Other.Show.S01E01.720p"}, false},
+		{"quality", RSSRule{Title: "Show", Quality: []string{"1080p", "2160P"}}, "f", TorrentSearchResult{Title: "Show 2160p"}, true},
+		{"other quality", RSSRule{Title: "Show", Quality: []string{"1080p"}}, "f", TorrentSearchResult{Title: "Show 720p"}, false},
+		{"within size", RSSRule{Title: "Show", MinSize: "500MB", MaxSize: "2 GiB"}, "f", TorrentSearchResult{Title: "Show", Size: 1 << 30}, true},
+		{"too small", RSSRule{Title: "Show", MinSize: "500MB"}, "f", TorrentSearchResult{Title: "Show", Size: 100 << 20}, false},
+		{"too large", RSSRule{Title: "Show", MaxSize: "2 GiB"}, "f", TorrentSearchResult{Title: "Show", Size: 3 << 30}, false},
+		{"unknown size", RSSRule{Title: "Show", MinSize: "500MB", MaxSize: "2 GiB"}, "f", TorrentSearchResult{Title: "Show"}, true},
+		{"feed", RSSRule{Title: "Show", Feeds: []string{"TV"}}, "tv", TorrentSearchResult{Title: "Show"}, true},
+		{"other feed", RSSRule{Title: "Show", Feeds: []string{"tv"}}, "movies", TorrentSearchResult{Title: "Show"}, false},
+	}
+	for _, tt := range tests {
+		rule := compiledRule(t, tt.rule)
+		if got := rule.matches(tt.feed, tt.item); got != tt.want {
+			t.Errorf("%s: matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRSSRuleCompileErrors(t *testing.T) {
+	for _, r := range []RSSRule{
+		{},
+		{Title: "("},
+		{Title: "x", MinSize: "big"},
+		{Title: "x", Mode: "seed"},
+		{Title: "x", Profile: "nope"},
+	} {
+		if err := r.compile(); err == nil {
+			t.Errorf("compile(%+v) succeeded", r)
+		}
+	}
+}
+
+// testRSSFeed lists two releases of one episode, another episode, a season pack and an item
+// no rule wants.
+const testRSSFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+  <channel>
+    <item>
+      <title>Some.Show.S01E01.1080p.WEB</title>
+      <size>1073741824</size>
+      <torznab:attr name="magneturl" value="magnet:?xt=urn:btih:1111111111111111111111111111111111111111" />
+    </item>
+    <item>
+      <title>Some.Show.S01E01.1080p.WEB.REPACK</title>
+      <size>1073741824</size>
+      <torznab:attr name="magneturl" value="magnet:?xt=urn:btih:2222222222222222222222222222222222222222" />
+    </item>
+    <item>
+      <title>Some.Show.S01E02.1080p.WEB</title>
+      <size>1073741824</size>
+      <torznab:attr name="magneturl" value="magnet:?xt=urn:btih:3333333333333333333333333333333333333333" />
+    </item>
+    <item>
+      <title>Some.Show.S01E03.1080p.WEB</title>
+      <size>10737418240</size>
+      <torznab:attr name="magneturl" value="magnet:?xt=urn:btih:4444444444444444444444444444444444444444" />
+    </item>
+    <item>
+      <title>Other.Show.S01E01.1080p.WEB</title>
+      <torznab:attr name="magneturl" value="magnet:?xt=urn:btih:5555555555555555555555555555555555555555" />
+    </item>
+  </channel>
+</rss>`
+
+// recordingGrabber records grabbed titles, failing those listed in fail.
+type recordingGrabber struct {
+	mu      sync.Mutex
+	grabbed []string
+	fail    map[string]bool
+}
+
+func (g *recordingGrabber) grab(ctx context.Context, rule *RSSRule, item TorrentSearchResult) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.fail[item.Title] {
+		return errors.New("no peers")
+	}
+	g.grabbed = append(g.grabbed, rule.Name+": "+item.Title)
+	return nil
+}
+
+func newTestRSSWatcher(t *testing.T, statePath string, grabber *recordingGrabber) *RSSWatcher {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(testRSSFeed))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &RSSConfig{
+		Feeds: []RSSFeed{{Name: "tv", URL: server.URL}},
+		Rules: []RSSRule{
+			compiledRule(t, RSSRule{Name: "show", Title: `^Some\.Show\.`, Quality: []string{"1080p"}, MaxSize: "4 GiB", Episodes: true}),
+		},
+	}
+	w, err := NewRSSWatcher(cfg, nil, nil, nil, statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.grabber = grabber.grab
+	return w
+}
+
+func TestRSSWatcherPoll(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state", "rss.json")
+	grabber := &recordingGrabber{}
+	w := newTestRSSWatcher(t, statePath, grabber)
+
+	w.Poll(context.Background())
+	// One release per episode; the oversized episode 3 and the other show are skipped.
+	want := []string{"show: Some.Show.S01E01.1080p.WEB", "show: Some.Show.S01E02.1080p.WEB"}
+	if !reflect.DeepEqual(grabber.grabbed, want) {
+		t.Errorf("grabbed %q, want %q", grabber.grabbed, want)
+	}
+
+	// Polling again grabs nothing new.
+	w.Poll(context.Background())
+	if len(grabber.grabbed) != 2 {
+		t.Errorf("grabbed %q after a second poll", grabber.grabbed)
+	}
+
+	// A watcher reloading the state doesn't grab them again either.
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatalf("state not saved: %v", err)
+	}
+	if !strings.Contains(string(data), `"S01E02"`) {
+		t.Errorf("state lacks the grabbed episodes:\n%s", data)
+	}
+	reloaded := &recordingGrabber{}
+	newTestRSSWatcher(t, statePath, reloaded).Poll(context.Background())
+	if len(reloaded.grabbed) != 0 {
+		t.Errorf("reloaded watcher grabbed %q", reloaded.grabbed)
+	}
+}
+
+func TestRSSWatcherRetriesFailedGrabs(t *testing.T) {
+	grabber := &recordingGrabber{fail: map[string]bool{"Some.Show.S01E01.1080p.WEB": true}}
+	w := newTestRSSWatcher(t, filepath.Join(t.TempDir(), "rss.json"), grabber)
+
+	w.Poll(context.Background())
+	// The failed release doesn't use up its episode: the repack is grabbed instead.
+	want := []string{"show: Some.Show.S01E01.1080p.WEB.REPACK", "show: Some.Show.S01E02.1080p.WEB"}
+	if !reflect.DeepEqual(grabber.grabbed, want) {
+		t.Errorf("grabbed %q, want %q", grabber.grabbed, want)
+	}
+	if len(w.grabbing) != 0 {
+		t.Errorf("reservations left behind: %v", w.grabbing)
+	}
+}
+
+func TestNewRSSWatcherBadState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "rss.json")
+	if err := os.WriteFile(statePath, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRSSWatcher(&RSSConfig{}, nil, nil, nil, statePath); err == nil {
+		t.Error("loaded a corrupt state file")
+	}
+}
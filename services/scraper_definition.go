@@ -0,0 +1,466 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+// ScraperDefinition describes an HTML torrent site declaratively: how to build its search URL
+// and where each result field sits in its result rows. New sites and mirrors with another
+// layout can be supported by writing a definition instead of a parser.
+//
+//	name: example
+//	baseUrls: [https://example.org, https://example-mirror.org]
+//	search: /search?q={query}&p={page}&sort={order}
+//	orders: {seeders: seeds, size: size, date: added}
+//	rows: table.results > tbody > tr
+//	fields:
+//	  title: td.name a
+//	  magnet: {selector: "a[href^='magnet:']", attr: href}
+//	  size: {selector: td:nth-child(3), regex: '([\d.]+\s*[KMGT]?i?B)'}
+//	  seeders: td:nth-child(4)
+type ScraperDefinition struct {
+	Name string `yaml:"name"`
+	// BaseURLs are the site and its mirrors; each is searched as a separate provider.
+	BaseURLs []string `yaml:"baseUrls"`
+	// Search is the search URL relative to the base URL, with {query}, {page} and {order}
+	// placeholders; values are query-escaped, so spaces become "+".
+	Search string `yaml:"search"`
+	// FirstPage is the site's number for the first results page, usually 0 or 1.
+	FirstPage int `yaml:"firstPage"`
+	// Orders maps sort orders ("seeders", "size", "date") to the site's {order} values; orders
+	// the site lacks fall back to its seeders order.
+	Orders map[TorrentSortOrder]string `yaml:"orders"`
+	// Profile names the built-in scraper profile for this site; empty uses the configured one.
+	Profile string `yaml:"profile"`
+	// Rows selects the result rows; the fields are selected within each row.
+	Rows   string        `yaml:"rows"`
+	Fields ScraperFields `yaml:"fields"`
+	// DateLayouts are Go time layouts for upload dates, tried after RFC 3339 and the default
+	// site's formats ("03-14 2019", "Today 12:34", "5 mins ago"). Dates are taken as UTC.
+	DateLayouts []string `yaml:"dateLayouts"`
+
+	rows *selector
+}
+
+// ScraperFields locates each result field within a row. Title and one of Magnet or InfoHash
+// are required; rows missing them are skipped.
+type ScraperFields struct {
+	Title    FieldRule `yaml:"title"`
+	Magnet   FieldRule `yaml:"magnet"`
+	InfoHash FieldRule `yaml:"infoHash"` // Used to build a magnet link when Magnet is absent
+	Size     FieldRule `yaml:"size"`     // e.g. "1.37 GiB"
+	Seeders  FieldRule `yaml:"seeders"`
+	Leechers FieldRule `yaml:"leechers"`
+	Uploader FieldRule `yaml:"uploader"`
+	Date     FieldRule `yaml:"date"`
+}
+
+// FieldRule extracts one value from a result row. In YAML it is either a mapping or just a
+// selector string.
+type FieldRule struct {
+	// Selector selects the element within the row; empty uses the row itself.
+	Selector string `yaml:"selector"`
+	// Attr reads an attribute, e.g. "href", instead of the element's text.
+	Attr string `yaml:"attr"`
+	// Regex extracts part of the value: its first capture group, or the whole match.
+	Regex string `yaml:"regex"`
+
+	sel *selector
+	re  *regexp.Regexp
+}
+
+// UnmarshalYAML accepts a plain selector string as shorthand.
+func (f *FieldRule) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		f.Selector = node.Value
+		return nil
+	}
+	type plain FieldRule
+	return node.Decode((*plain)(f))
+}
+
+// IsSet reports whether the field is configured.
+func (f *FieldRule) IsSet() bool {
+	return f.Selector != "" || f.Attr != "" || f.Regex != ""
+}
+
+func (f *FieldRule) compile() error {
+	var errs []error
+	if f.Selector != "" {
+		sel, err := compileSelector(f.Selector)
+		errs = append(errs, err)
+		f.sel = sel
+	}
+	if f.Regex != "" {
+		re, err := regexp.Compile(f.Regex)
+		if err != nil {
+			err = fmt.Errorf("invalid regex: %w", err)
+		}
+		errs = append(errs, err)
+		f.re = re
+	}
+	return errors.Join(errs...)
+}
+
+// extract returns the field's value in row, or "" when it's unset or doesn't match.
+func (f *FieldRule) extract(row *html.Node) string {
+	if !f.IsSet() {
+		return ""
+	}
+	n := row
+	if f.sel != nil {
+		if n = f.sel.matchFirst(row); n == nil {
+			return ""
+		}
+	}
+	var value string
+	if f.Attr != "" {
+		value = attrValue(n, f.Attr)
+	} else {
+		value = strings.Join(strings.Fields(extractText(n)), " ")
+	}
+	if f.re != nil {
+		m := f.re.FindStringSubmatch(value)
+		switch {
+		case m == nil:
+			return ""
+		case len(m) > 1:
+			value = m[1]
+		default:
+			value = m[0]
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+// Validate compiles the definition's selectors and patterns and checks that it is complete,
+// reporting every problem found.
+func (d *ScraperDefinition) Validate() error {
+	var errs []error
+	problem := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if d.Name == "" {
+		problem("name is required")
+	}
+	if len(d.BaseURLs) == 0 {
+		problem("baseUrls needs at least one URL")
+	}
+	for _, raw := range d.BaseURLs {
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problem("base URL %q must be an absolute http(s) URL", raw)
+		}
+	}
+	if !strings.Contains(d.Search, "{query}") {
+		problem("search must contain a {query} placeholder")
+	} else if _, err := url.Parse(expandSearch(d.Search, "q", 0, "o")); err != nil {
+		problem("search is not a valid URL: %v", err)
+	}
+	if d.FirstPage < 0 {
+		problem("firstPage must not be negative")
+	}
+	for order := range d.Orders {
+		if !slices.Contains(TorrentSortOrders, order) {
+			problem("orders: unknown sort order %q (expected one of %v)", order, TorrentSortOrders)
+		}
+	}
+	if strings.Contains(d.Search, "{order}") && d.Orders[SortBySeeders] == "" {
+		problem("search uses {order} but orders has no seeders value")
+	}
+	if d.Profile != "" {
+		if _, ok := LookupScraperProfile(d.Profile); !ok {
+			problem("unknown profile %q (available: %s)", d.Profile, strings.Join(ScraperProfileNames(), ", "))
+		}
+	}
+
+	if d.Rows == "" {
+		problem("rows selector is required")
+	} else if sel, err := compileSelector(d.Rows); err != nil {
+		problem("rows: %v", err)
+	} else {
+		d.rows = sel
+	}
+	if !d.Fields.Title.IsSet() {
+		problem("fields.title is required")
+	}
+	if !d.Fields.Magnet.IsSet() && !d.Fields.InfoHash.IsSet() {
+		problem("fields.magnet or fields.infoHash is required")
+	}
+	for _, field := range d.Fields.all() {
+		if err := field.rule.compile(); err != nil {
+			problem("fields.%s: %v", field.name, err)
+		}
+	}
+	for _, layout := range d.DateLayouts {
+		if layout == "" {
+			problem("dateLayouts must not contain empty layouts")
+		}
+	}
+
+	if len(errs) > 0 {
+		name := d.Name
+		if name == "" {
+			name = "unnamed"
+		}
+		return fmt.Errorf("scraper definition %s: %w", name, errors.Join(errs...))
+	}
+	return nil
+}
+
+type namedFieldRule struct {
+	name string
+	rule *FieldRule
+}
+
+func (f *ScraperFields) all() []namedFieldRule {
+	return []namedFieldRule{
+		{"title", &f.Title}, {"magnet", &f.Magnet}, {"infoHash", &f.InfoHash}, {"size", &f.Size},
+		{"seeders", &f.Seeders}, {"leechers", &f.Leechers}, {"uploader", &f.Uploader}, {"date", &f.Date},
+	}
+}
+
+// expandSearch fills in the placeholders of a search URL template.
+func expandSearch(template, query string, page int, order string) string {
+	return strings.NewReplacer(
+		"{query}", url.QueryEscape(query),
+		"{page}", strconv.Itoa(page),
+		"{order}", url.QueryEscape(order),
+	).Replace(template)
+}
+
+// LoadScraperDefinition reads and validates one YAML scraper definition.
+func LoadScraperDefinition(path string) (*ScraperDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scraper definition: %w", err)
+	}
+	var def ScraperDefinition
+	if err := yaml.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("failed to parse scraper definition %s: %w", path, err)
+	}
+	if def.Name == "" {
+		def.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := def.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &def, nil
+}
+
+// LoadScraperDefinitions loads a definition file, or every .yaml and .yml file in a directory.
+// Every invalid definition is reported.
+func LoadScraperDefinitions(path string) ([]*ScraperDefinition, error) {
+	paths := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to read scraper definitions: %w", err)
+	} else if info.IsDir() {
+		paths = nil
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, _ := filepath.Glob(filepath.Join(path, pattern)) // Only fails for bad patterns
+			paths = append(paths, matches...)
+		}
+		slices.Sort(paths)
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no scraper definitions (*.yaml) in %s", path)
+		}
+	}
+
+	var defs []*ScraperDefinition
+	var errs []error
+	seen := map[string]string{}
+	for _, p := range paths {
+		def, err := LoadScraperDefinition(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if other, ok := seen[def.Name]; ok {
+			errs = append(errs, fmt.Errorf("%s: scraper definition name %q is already used by %s", p, def.Name, other))
+			continue
+		}
+		seen[def.Name] = p
+		defs = append(defs, def)
+	}
+	return defs, errors.Join(errs...)
+}
+
+// DefinitionScraper searches one base URL of a site described by a ScraperDefinition.
+type DefinitionScraper struct {
+	Client     *http.Client // Has a cookie jar, so cookies set by the site are sent back
+	BaseURL    string
+	Definition *ScraperDefinition // Must be valid
+	Profile    ScraperProfile
+}
+
+// NewDefinitionScraper creates a scraper for baseURL, one of def's base URLs, using def's
+// profile or else DefaultScraperProfile.
+func NewDefinitionScraper(def *ScraperDefinition, baseURL string) *DefinitionScraper {
+	jar, _ := cookiejar.New(nil) // Never fails without options
+	profile, _ := LookupScraperProfile(def.Profile)
+	return &DefinitionScraper{
+		Client:     &http.Client{Timeout: 20 * time.Second, Jar: jar},
+		BaseURL:    baseURL,
+		Definition: def,
+		Profile:    profile,
+	}
+}
+
+// UseProfile switches to the given browser profile and seeds the cookie jar with its cookies.
+func (s *DefinitionScraper) UseProfile(p ScraperProfile) error {
+	if err := p.seedCookies(s.Client.Jar, s.BaseURL); err != nil {
+		return err
+	}
+	s.Profile = p
+	return nil
+}
+
+// SearchURL returns the URL searched for query on the given 0-indexed page.
+func (s *DefinitionScraper) SearchURL(query string, page int, orderBy TorrentSortOrder) (*url.URL, error) {
+	base, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base URL '%s': %w", s.BaseURL, err)
+	}
+	if orderBy == "" {
+		orderBy = SortBySeeders
+	}
+	order, ok := s.Definition.Orders[orderBy]
+	if !ok {
+		order = s.Definition.Orders[SortBySeeders]
+	}
+	ref, err := url.Parse(expandSearch(s.Definition.Search, query, page+s.Definition.FirstPage, order))
+	if err != nil {
+		return nil, fmt.Errorf("invalid search URL for %s: %w", s.Definition.Name, err)
+	}
+	return base.ResolveReference(ref), nil
+}
+
+// SearchTorrents fetches a page of search results from the site.
+func (s *DefinitionScraper) SearchTorrents(ctx context.Context, query string, page int, orderBy TorrentSortOrder) ([]TorrentSearchResult, error) {
+	if query == "" {
+		return nil, fmt.Errorf("search query cannot be empty")
+	}
+	reqURL, err := s.SearchURL(query, page, orderBy)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	s.Profile.apply(req, reqURL)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute HTTP request to %s: %w", s.Definition.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		doc, err := html.Parse(io.LimitReader(resp.Body, 1<<20))
+		if err == nil {
+			if reason := detectBlockPage(doc); reason != "" {
+				return nil, &ScraperBlockedError{Site: reqURL.Host, Reason: reason}
+			}
+		}
+		return nil, upstreamStatusError(s.Definition.Name, resp, "")
+	}
+	return s.ParseResults(resp.Body)
+}
+
+// ParseResults extracts the results from a search results page. A page without result rows
+// that looks like a captcha or block page gives a *ScraperBlockedError.
+func (s *DefinitionScraper) ParseResults(body io.Reader) ([]TorrentSearchResult, error) {
+	return s.parseResults(body, time.Now().UTC())
+}
+
+// parseResults is ParseResults with now as the reference for relative upload dates.
+func (s *DefinitionScraper) parseResults(body io.Reader, now time.Time) ([]TorrentSearchResult, error) {
+	doc, err := html.Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	rows := s.Definition.rows.matchAll(doc)
+	if len(rows) == 0 {
+		if reason := detectBlockPage(doc); reason != "" {
+			site := s.BaseURL
+			if u, err := url.Parse(s.BaseURL); err == nil && u.Host != "" {
+				site = u.Host
+			}
+			return nil, &ScraperBlockedError{Site: site, Reason: reason}
+		}
+	}
+
+	var results []TorrentSearchResult
+	for _, row := range rows {
+		if result, ok := s.Definition.extractRow(row, now); ok {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// extractRow reads a result from a row, reporting false when it lacks a title or magnet link.
+func (d *ScraperDefinition) extractRow(row *html.Node, now time.Time) (TorrentSearchResult, bool) {
+	f := &d.Fields
+	result := TorrentSearchResult{
+		Title:     f.Title.extract(row),
+		MagnetURL: f.Magnet.extract(row),
+		Seeders:   parseCount(f.Seeders.extract(row)),
+		Leechers:  parseCount(f.Leechers.extract(row)),
+		Uploader:  f.Uploader.extract(row),
+	}
+	if !strings.HasPrefix(result.MagnetURL, "magnet:") {
+		result.MagnetURL = ""
+	}
+	if result.MagnetURL != "" {
+		result.InfoHash = magnetInfoHash(result.MagnetURL)
+	} else if hash := magnetInfoHash("magnet:?xt=urn:btih:" + f.InfoHash.extract(row)); hash != "" {
+		result.InfoHash = hash
+		result.MagnetURL = "magnet:?xt=urn:btih:" + hash + "&dn=" + url.QueryEscape(result.Title)
+	}
+	if result.Title == "" || result.MagnetURL == "" {
+		return result, false
+	}
+	if size, ok := parseSize(f.Size.extract(row)); ok {
+		result.Size = size
+	}
+	if t, ok := d.parseDate(f.Date.extract(row), now); ok {
+		result.UploadDate = t.UTC().Format(time.RFC3339)
+	}
+	return result, true
+}
+
+func (d *ScraperDefinition) parseDate(s string, now time.Time) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	if t, ok := parseUploadDate(s, now); ok {
+		return t, true
+	}
+	for _, layout := range d.DateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// definitionFixtureResults are the results each definition under scrapers/ must extract from
+// its fixture, the saved search page next to it, parsed at testNow.
+var definitionFixtureResults = map[string][]TorrentSearchResult{
+	"tpb.yaml": {
+		{
+			Title:      "Big Buck Bunny 2008 1080p BluRay x264",
+			MagnetURL:  "magnet:?xt=urn:btih:dd8255ecdc7ca55fb0bbf81323d87062db1f6d1c&dn=Big+Buck+Bunny",
+			InfoHash:   "dd8255ecdc7ca55fb0bbf81323d87062db1f6d1c",
+			Seeders:    1234,
+			Leechers:   56,
+			Size:       1471026298,
+			Uploader:   "blender",
+			UploadDate: "2019-03-14T00:00:00Z",
+		},
+		{
+			Title:      "Big Buck Bunny 720p",
+			MagnetURL:  "magnet:?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d53056&dn=Big+Buck+Bunny+720p",
+			InfoHash:   "c9e15763f722f23e98a29decdfae341b98d53056",
+			Seeders:    12,
+			Leechers:   3,
+			Size:       503840768,
+			Uploader:   "anon",
+			UploadDate: "2024-06-09T12:34:00Z",
+		},
+	},
+}
+
+func TestScraperDefinitionFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "scrapers", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no definitions under scrapers/")
+	}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		t.Run(name, func(t *testing.T) {
+			want, ok := definitionFixtureResults[name]
+			if !ok {
+				t.Fatalf("no expected results for %s; add them to definitionFixtureResults", name)
+			}
+			def, err := LoadScraperDefinition(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(strings.TrimSuffix(path, ".yaml") + ".html")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			got, err := NewDefinitionScraper(def, def.BaseURLs[0]).parseResults(f, testNow)
+			if err != nil {
+				t.Fatalf("parseResults: %v", err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %d results, want %d: %+v", len(got), len(want), got)
+			}
+			for i := range want {
+				if !reflect.DeepEqual(got[i], want[i]) {
+					t.Errorf("result %d\n got %+v\nwant %+v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScraperDefinitionMatchesBuiltInParser(t *testing.T) {
+	// The tpb definition describes the built-in parser's site, so both read a page alike.
+	def, err := LoadScraperDefinition(filepath.Join("..", "scrapers", "tpb.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := filepath.Join("testdata", "tpb_search.html")
+
+	f, err := os.Open(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fromDefinition, err := NewDefinitionScraper(def, def.BaseURLs[0]).parseResults(f, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f2, err := os.Open(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+	builtIn, err := NewConcreteTorrentSearchService(def.BaseURLs[0]).parseHTMLResults(f2, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fromDefinition, builtIn) {
+		t.Errorf("definition and built-in parser differ\ndefinition %+v\n  built-in %+v", fromDefinition, builtIn)
+	}
+}
+
+func TestScraperDefinitionBlocked(t *testing.T) {
+	def, err := LoadScraperDefinition(filepath.Join("..", "scrapers", "tpb.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filepath.Join("testdata", "tpb_blocked.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = NewDefinitionScraper(def, "https://mirror.example/s/").parseResults(f, testNow)
+	var blocked *ScraperBlockedError
+	if !errors.As(err, &blocked) || blocked.Site != "mirror.example" {
+		t.Fatalf("got error %v, want a *ScraperBlockedError for mirror.example", err)
+	}
+}
+
+func TestScraperDefinitionValidate(t *testing.T) {
+	def := &ScraperDefinition{
+		Rows: "tr >",
+		Fields: ScraperFields{
+			Seeders: FieldRule{Selector: "td:hover", Regex: "("},
+		},
+	}
+	err := def.Validate()
+	if err == nil {
+		t.Fatal("Validate succeeded")
+	}
+	for _, want := range []string{"name", "baseUrls", "search", "rows", "title", "magnet", "seeders", "regex"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate error doesn't mention %q:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultScraperProfile is the browser the HTML scraper impersonates unless configured otherwise.
+const DefaultScraperProfile = "chrome-macos"
+
+// Referer policies for ScraperProfile.Referer.
+const (
+	RefererOrigin = "origin" // The site's origin, as when navigating from its home page; the default
+	RefererNone   = "none"   // No Referer header
+)
+
+// ScraperProfile is the set of request headers the HTML scraper sends to look like a browser.
+// Profiles age as browsers update, so they can be replaced from config without a release.
+type ScraperProfile struct {
+	Name           string `yaml:"name"`
+	UserAgent      string `yaml:"userAgent"`
+	Accept         string `yaml:"accept"`
+	AcceptLanguage string `yaml:"acceptLanguage"`
+	// ClientHints are the Sec-Ch-Ua* headers Chromium browsers send; empty for other browsers.
+	ClientHints map[string]string `yaml:"clientHints"`
+	// Headers are any further headers, e.g. the Sec-Fetch-* navigation headers.
+	Headers map[string]string `yaml:"headers"`
+	// Cookies are sent from the first request on, e.g. a challenge clearance cookie obtained
+	// in a real browser. Cookies the site sets later are kept in the client's cookie jar.
+	Cookies map[string]string `yaml:"cookies"`
+	// Referer is RefererOrigin, RefererNone or a fixed URL.
+	Referer string `yaml:"referer"`
+}
+
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"
+
+// navigationHeaders are the Sec-Fetch-* headers of a same-site, user-initiated navigation.
+var navigationHeaders = map[string]string{
+	"Sec-Fetch-Dest":            "document",
+	"Sec-Fetch-Mode":            "navigate",
+	"Sec-Fetch-Site":            "same-origin",
+	"Sec-Fetch-User":            "?1",
+	"Upgrade-Insecure-Requests": "1",
+}
+
+// scraperProfiles are the built-in profiles, selectable by name.
+var scraperProfiles = map[string]ScraperProfile{
+	"chrome-macos": {
+		Name:           "chrome-macos",
+		UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/134.0.0.0 Safari/537.36",
+		Accept:         browserAccept,
+		AcceptLanguage: "en-US,en;q=0.9",
+		ClientHints: map[string]string{
+			"Sec-Ch-Ua":          `"Not:A-Brand";v="24", "Chromium";v="134"`,
+			"Sec-Ch-Ua-Mobile":   "?0",
+			"Sec-Ch-Ua-Platform": `"macOS"`,
+		},
+		Headers: merged(navigationHeaders, map[string]string{"Dnt": "1", "Priority": "u=0, i"}),
+	},
+	"chrome-windows": {
+		Name:           "chrome-windows",
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/134.0.0.0 Safari/537.36",
+		Accept:         browserAccept,
+		AcceptLanguage: "en-US,en;q=0.9",
+		ClientHints: map[string]string{
+			"Sec-Ch-Ua":          `"Not:A-Brand";v="24", "Chromium";v="134"`,
+			"Sec-Ch-Ua-Mobile":   "?0",
+			"Sec-Ch-Ua-Platform": `"Windows"`,
+		},
+		Headers: merged(navigationHeaders, map[string]string{"Priority": "u=0, i"}),
+	},
+	// Firefox sends no client hints.
+	"firefox-linux": {
+		Name:           "firefox-linux",
+		UserAgent:      "Mozilla/5.0 (X11; Linux x86_64; rv:136.0) Gecko/20100101 Firefox/136.0",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		AcceptLanguage: "en-US,en;q=0.5",
+		Headers:        merged(navigationHeaders, map[string]string{"Priority": "u=0, i"}),
+	},
+}
+
+func merged(maps ...map[string]string) map[string]string {
+	out := map[string]string{}
+	for _, m := range maps {
+		for k, v := range m {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// LookupScraperProfile returns the named built-in profile; an empty name selects
+// DefaultScraperProfile.
+func LookupScraperProfile(name string) (ScraperProfile, bool) {
+	if name == "" {
+		name = DefaultScraperProfile
+	}
+	p, ok := scraperProfiles[strings.ToLower(name)]
+	return p, ok
+}
+
+// ScraperProfileNames returns the names of all built-in profiles, sorted.
+func ScraperProfileNames() []string {
+	names := make([]string, 0, len(scraperProfiles))
+	for name := range scraperProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadScraperProfile reads a profile from a YAML file. Fields the file leaves out are taken
+// from the built-in profile it names in "base" (DefaultScraperProfile when absent).
+func LoadScraperProfile(path string) (ScraperProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ScraperProfile{}, fmt.Errorf("failed to read scraper profile: %w", err)
+	}
+	var file struct {
+		Base           string `yaml:"base"`
+		ScraperProfile `yaml:",inline"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return ScraperProfile{}, fmt.Errorf("failed to parse scraper profile %s: %w", path, err)
+	}
+	p, ok := LookupScraperProfile(file.Base)
+	if !ok {
+		return ScraperProfile{}, fmt.Errorf("scraper profile %s: unknown base profile %q (available: %s)", path, file.Base, strings.Join(ScraperProfileNames(), ", "))
+	}
+
+	custom := file.ScraperProfile
+	if custom.Name != "" {
+		p.Name = custom.Name
+	} else {
+		p.Name = path
+	}
+	if custom.UserAgent != "" {
+		p.UserAgent = custom.UserAgent
+	}
+	if custom.Accept != "" {
+		p.Accept = custom.Accept
+	}
+	if custom.AcceptLanguage != "" {
+		p.AcceptLanguage = custom.AcceptLanguage
+	}
+	if custom.ClientHints != nil {
+		p.ClientHints = custom.ClientHints // Replaced, not merged: hints must match the user agent
+	}
+	p.Headers = merged(p.Headers, custom.Headers)
+	p.Cookies = merged(p.Cookies, custom.Cookies)
+	if custom.Referer != "" {
+		p.Referer = custom.Referer
+	}
+	if err := p.validate(); err != nil {
+		return ScraperProfile{}, fmt.Errorf("scraper profile %s: %w", path, err)
+	}
+	return p, nil
+}
+
+func (p ScraperProfile) validate() error {
+	if p.UserAgent == "" {
+		return errors.New("userAgent is required")
+	}
+	switch p.Referer {
+	case "", RefererOrigin, RefererNone:
+	default:
+		if u, err := url.Parse(p.Referer); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("referer must be %q, %q or an absolute URL", RefererOrigin, RefererNone)
+		}
+	}
+	return nil
+}
+
+// apply sets the profile's headers on a request to a page of the site at siteURL.
+func (p ScraperProfile) apply(req *http.Request, siteURL *url.URL) {
+	if p.Accept != "" {
+		req.Header.Set("Accept", p.Accept)
+	}
+	if p.AcceptLanguage != "" {
+		req.Header.Set("Accept-Language", p.AcceptLanguage)
+	}
+	req.Header.Set("User-Agent", p.UserAgent)
+	for k, v := range p.ClientHints {
+		req.Header.Set(k, v)
+	}
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+	switch p.Referer {
+	case RefererNone:
+	case "", RefererOrigin:
+		if siteURL.Scheme != "" && siteURL.Host != "" {
+			req.Header.Set("Referer", (&url.URL{Scheme: siteURL.Scheme, Host: siteURL.Host}).String()+"/")
+		}
+	default:
+		req.Header.Set("Referer", p.Referer)
+	}
+}
+
+// seedCookies stores the profile's preset cookies in jar for the site at baseURL.
+func (p ScraperProfile) seedCookies(jar http.CookieJar, baseURL string) error {
+	siteURL, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse base URL '%s': %w", baseURL, err)
+	}
+	if len(p.Cookies) == 0 || jar == nil {
+		return nil
+	}
+	cookies := make([]*http.Cookie, 0, len(p.Cookies))
+	for name, value := range p.Cookies {
+		cookies = append(cookies, &http.Cookie{Name: name, Value: value})
+	}
+	jar.SetCookies(&url.URL{Scheme: siteURL.Scheme, Host: siteURL.Host, Path: "/"}, cookies)
+	return nil
+}
+
+// ErrScraperBlocked is matched (with errors.Is) by every *ScraperBlockedError.
+var ErrScraperBlocked = errors.New("blocked by torrent site")
+
+// ScraperBlockedError is returned when a torrent site answers with a block or captcha page
+// instead of search results, so that it isn't mistaken for an empty result list.
+type ScraperBlockedError struct {
+	Site   string // Host of the site
+	Reason string // What gave the block away, e.g. `page title "Just a moment..."`
+}
+
+func (e *ScraperBlockedError) Error() string {
+	return fmt.Sprintf("torrent site %s blocked the request (%s); try another scraper profile or a clearance cookie", e.Site, e.Reason)
+}
+
+func (e *ScraperBlockedError) Is(target error) bool { return target == ErrScraperBlocked }
+
+// blockPageTitles are lower-cased <title> prefixes of well-known challenge and block pages.
+var blockPageTitles = []string{
+	"just a moment",      // Cloudflare JS challenge
+	"attention required", // Cloudflare block
+	"access denied",
+	"ddos-guard",
+	"ddos protection",
+	"security check",
+	"are you a robot",
+	"captcha",
+}
+
+// blockPageMarkers are lower-cased substrings of element ids, classes and script or iframe
+// sources that only appear on challenge pages.
+var blockPageMarkers = []string{
+	"cf-challenge", "challenge-form", "cf_chl", "challenge-platform", "cf-turnstile",
+	"g-recaptcha", "recaptcha/api", "h-captcha", "hcaptcha.com", "ddos-guard",
+}
+
+// detectBlockPage returns why a parsed page looks like a block or captcha page, or "".
+func detectBlockPage(doc *html.Node) string {
+	var reason string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if reason != "" {
+			return
+		}
+		if n.Type == html.ElementNode {
+			if n.Data == "title" {
+				title := strings.TrimSpace(extractText(n))
+				for _, prefix := range blockPageTitles {
+					if strings.HasPrefix(strings.ToLower(title), prefix) {
+						reason = fmt.Sprintf("page title %q", title)
+						return
+					}
+				}
+			}
+			for _, attr := range n.Attr {
+				if attr.Key != "id" && attr.Key != "class" && attr.Key != "src" && attr.Key != "action" {
+					continue
+				}
+				val := strings.ToLower(attr.Val)
+				for _, marker := range blockPageMarkers {
+					if strings.Contains(val, marker) {
+						reason = fmt.Sprintf("%s %s=%q", n.Data, attr.Key, marker)
+						return
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return reason
+}
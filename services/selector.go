@@ -0,0 +1,351 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// selector is a compiled CSS selector, supporting the subset scraper definitions need:
+// type, universal, #id, .class and [attr], [attr=v], [attr~=v], [attr^=v], [attr$=v],
+// [attr*=v] selectors; :first-child, :last-child, :nth-child(n) and :nth-last-child(n);
+// descendant and child (>) combinators; and comma-separated alternatives.
+type selector struct {
+	alternatives [][]compoundSelector // Each alternative lists its compounds left to right
+}
+
+// compoundSelector is a run of simple selectors applying to one element, such as
+// "td.name:nth-child(2)", with the combinator relating it to the compound before it.
+type compoundSelector struct {
+	child   bool   // Combinator: the element is a child of the previous compound's match, not just a descendant
+	tag     string // Empty matches any element
+	id      string
+	classes []string
+	attrs   []attrSelector
+	nth     int  // 1-based position among element siblings; 0 means any
+	fromEnd bool // nth counts from the last sibling
+}
+
+type attrSelector struct {
+	key, op, val string // op is "" when only presence is tested
+}
+
+// compileSelector parses a CSS selector.
+func compileSelector(s string) (*selector, error) {
+	sel := &selector{}
+	for _, alt := range splitSelectorList(s) {
+		compounds, err := parseCompounds(strings.TrimSpace(alt))
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", s, err)
+		}
+		sel.alternatives = append(sel.alternatives, compounds)
+	}
+	return sel, nil
+}
+
+// splitSelectorList splits a selector at the commas between alternatives, leaving commas
+// inside quotes, brackets and parentheses, as in a[title='a,b'], alone.
+func splitSelectorList(s string) []string {
+	var parts []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '[' || ch == '(':
+			depth++
+		case ch == ']' || ch == ')':
+			depth--
+		case ch == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// closingBracket returns the index of the ']' closing the attribute selector s starts with,
+// skipping quoted values, or -1.
+func closingBracket(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch ch := s[i]; {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseCompounds(s string) ([]compoundSelector, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty selector")
+	}
+	var compounds []compoundSelector
+	child := false
+	for s != "" {
+		s = strings.TrimLeft(s, " \t\n")
+		if strings.HasPrefix(s, ">") {
+			if child || len(compounds) == 0 {
+				return nil, fmt.Errorf("misplaced '>'")
+			}
+			child = true
+			s = s[1:]
+			continue
+		}
+		if s == "" {
+			break
+		}
+		c, rest, err := parseCompound(s)
+		if err != nil {
+			return nil, err
+		}
+		c.child = child
+		child = false
+		compounds = append(compounds, c)
+		s = rest
+	}
+	if child {
+		return nil, fmt.Errorf("selector ends with '>'")
+	}
+	return compounds, nil
+}
+
+// parseCompound parses one compound selector from the start of s and returns the rest of s.
+func parseCompound(s string) (compoundSelector, string, error) {
+	var c compoundSelector
+	if strings.HasPrefix(s, "*") {
+		s = s[1:]
+	} else {
+		c.tag, s = cutIdent(s)
+		c.tag = strings.ToLower(c.tag)
+	}
+	for s != "" && !strings.ContainsRune(" \t\n>", rune(s[0])) {
+		var name string
+		switch s[0] {
+		case '#':
+			if c.id, s = cutIdent(s[1:]); c.id == "" {
+				return c, "", fmt.Errorf("'#' without an id")
+			}
+		case '.':
+			if name, s = cutIdent(s[1:]); name == "" {
+				return c, "", fmt.Errorf("'.' without a class")
+			}
+			c.classes = append(c.classes, name)
+		case '[':
+			end := closingBracket(s)
+			if end < 0 {
+				return c, "", fmt.Errorf("unterminated '['")
+			}
+			a, err := parseAttrSelector(s[1:end])
+			if err != nil {
+				return c, "", err
+			}
+			c.attrs = append(c.attrs, a)
+			s = s[end+1:]
+		case ':':
+			name, s = cutIdent(s[1:])
+			switch name {
+			case "first-child":
+				c.nth = 1
+			case "last-child":
+				c.nth, c.fromEnd = 1, true
+			case "nth-child", "nth-last-child":
+				end := strings.IndexByte(s, ')')
+				if !strings.HasPrefix(s, "(") || end < 0 {
+					return c, "", fmt.Errorf(":%s needs an argument", name)
+				}
+				n, err := strconv.Atoi(strings.TrimSpace(s[1:end]))
+				if err != nil || n < 1 {
+					return c, "", fmt.Errorf(":%s supports only positive integers", name)
+				}
+				c.nth, c.fromEnd = n, name == "nth-last-child"
+				s = s[end+1:]
+			default:
+				return c, "", fmt.Errorf("unsupported pseudo-class :%s", name)
+			}
+		default:
+			return c, "", fmt.Errorf("unexpected %q", s[0])
+		}
+	}
+	return c, s, nil
+}
+
+func parseAttrSelector(s string) (attrSelector, error) {
+	i := strings.IndexAny(s, "=~^$*")
+	if i < 0 {
+		i = len(s)
+	}
+	a := attrSelector{key: strings.ToLower(strings.TrimSpace(s[:i]))}
+	if name, rest := cutIdent(a.key); name == "" || rest != "" {
+		return a, fmt.Errorf("invalid attribute name in [%s]", s)
+	}
+	if i == len(s) {
+		return a, nil
+	}
+	rest := s[i:]
+	if rest[0] == '=' {
+		a.op, rest = "=", rest[1:]
+	} else if len(rest) > 1 && rest[1] == '=' {
+		a.op, rest = rest[:2], rest[2:]
+	} else {
+		return a, fmt.Errorf("invalid attribute operator in [%s]", s)
+	}
+	a.val = strings.Trim(strings.TrimSpace(rest), `"'`)
+	return a, nil
+}
+
+// cutIdent splits a leading CSS identifier off s.
+func cutIdent(s string) (string, string) {
+	i := 0
+	for i < len(s) {
+		ch := s[i]
+		if ch == '-' || ch == '_' || ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= 0x80 {
+			i++
+			continue
+		}
+		break
+	}
+	return s[:i], s[i:]
+}
+
+// matchAll returns the elements under root, in document order, that match the selector.
+// Combinators only look at ancestors up to root, so a selector is relative to it.
+func (sel *selector) matchAll(root *html.Node) []*html.Node {
+	var matches []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && sel.matches(c, root) {
+				matches = append(matches, c)
+			}
+			walk(c)
+		}
+	}
+	walk(root)
+	return matches
+}
+
+// matchFirst returns the first element under root matching the selector, or nil.
+func (sel *selector) matchFirst(root *html.Node) *html.Node {
+	if m := sel.matchAll(root); len(m) > 0 {
+		return m[0]
+	}
+	return nil
+}
+
+func (sel *selector) matches(n, root *html.Node) bool {
+	for _, compounds := range sel.alternatives {
+		if matchCompounds(n, root, compounds) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchCompounds reports whether n matches the last compound, with its ancestors (up to and
+// including root) matching the ones before it.
+func matchCompounds(n, root *html.Node, compounds []compoundSelector) bool {
+	last := compounds[len(compounds)-1]
+	if !last.matches(n) {
+		return false
+	}
+	if len(compounds) == 1 {
+		return true
+	}
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && matchCompounds(p, root, compounds[:len(compounds)-1]) {
+			return true
+		}
+		if last.child || p == root {
+			return false
+		}
+	}
+	return false
+}
+
+func (c *compoundSelector) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode || (c.tag != "" && n.Data != c.tag) {
+		return false
+	}
+	if c.id != "" && attrValue(n, "id") != c.id {
+		return false
+	}
+	classes := strings.Fields(attrValue(n, "class"))
+	for _, class := range c.classes {
+		if !slices.Contains(classes, class) {
+			return false
+		}
+	}
+	for _, a := range c.attrs {
+		if !a.matches(n) {
+			return false
+		}
+	}
+	return c.nth == 0 || elementPosition(n, c.fromEnd) == c.nth
+}
+
+func (a attrSelector) matches(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		if attr.Key != a.key {
+			continue
+		}
+		switch a.op {
+		case "":
+			return true
+		case "=":
+			return attr.Val == a.val
+		case "~=":
+			return slices.Contains(strings.Fields(attr.Val), a.val)
+		case "^=":
+			return a.val != "" && strings.HasPrefix(attr.Val, a.val)
+		case "$=":
+			return a.val != "" && strings.HasSuffix(attr.Val, a.val)
+		case "*=":
+			return a.val != "" && strings.Contains(attr.Val, a.val)
+		}
+		return false
+	}
+	return false
+}
+
+// elementPosition returns the 1-based position of n among its element siblings, counted from
+// the last one when fromEnd is set.
+func elementPosition(n *html.Node, fromEnd bool) int {
+	pos := 1
+	for s := n.PrevSibling; !fromEnd && s != nil; s = s.PrevSibling {
+		if s.Type == html.ElementNode {
+			pos++
+		}
+	}
+	for s := n.NextSibling; fromEnd && s != nil; s = s.NextSibling {
+		if s.Type == html.ElementNode {
+			pos++
+		}
+	}
+	return pos
+}
+
+// attrValue returns the value of n's attribute key, or "".
+func attrValue(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// selectorTestPage is the document the selector tests match against; elements are identified
+// by their id.
+const selectorTestPage = `<html><body>
+<table id="results" class="list wide">
+	<tbody>
+		<tr id="r1" class="row odd"><td id="r1c1">a</td><td id="r1c2" class="name"><a id="a1" href="magnet:?xt=1" title="a,b">x</a></td><td id="r1c3">1</td></tr>
+		<tr id="r2" class="row"><td id="r2c1">b</td><td id="r2c2" class="name"><span id="s2"><a id="a2" href="/torrent/2" title="c]d">y</a></span></td><td id="r2c3">2</td></tr>
+	</tbody>
+</table>
+<div id="footer" data-kind="page footer"><a id="a3" href="https://example.org/next.html" rel="next nofollow">next</a></div>
+</body></html>`
+
+func TestCompileSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     [][]compoundSelector
+	}{
+		{"td", [][]compoundSelector{{{tag: "td"}}}},
+		{"*", [][]compoundSelector{{{}}}},
+		{"TR.row.odd#r1", [][]compoundSelector{{{tag: "tr", id: "r1", classes: []string{"row", "odd"}}}}},
+		{"table > tbody tr", [][]compoundSelector{{{tag: "table"}, {tag: "tbody", child: true}, {tag: "tr"}}}},
+		{"table>tbody>tr", [][]compoundSelector{{{tag: "table"}, {tag: "tbody", child: true}, {tag: "tr", child: true}}}},
+		{"td:first-child, td:last-child", [][]compoundSelector{{{tag: "td", nth: 1}}, {{tag: "td", nth: 1, fromEnd: true}}}},
+		{"td:nth-child(2)", [][]compoundSelector{{{tag: "td", nth: 2}}}},
+		{"td:nth-last-child( 2 )", [][]compoundSelector{{{tag: "td", nth: 2, fromEnd: true}}}},
+		{"[href]", [][]compoundSelector{{{attrs: []attrSelector{{key: "href"}}}}}},
+		{"a[HREF^='magnet:'][title]", [][]compoundSelector{{{tag: "a", attrs: []attrSelector{{key: "href", op: "^=", val: "magnet:"}, {key: "title"}}}}}},
+		{`a[title='a,b']`, [][]compoundSelector{{{tag: "a", attrs: []attrSelector{{key: "title", op: "=", val: "a,b"}}}}}},
+		{`a[title="c]d"], td`, [][]compoundSelector{{{tag: "a", attrs: []attrSelector{{key: "title", op: "=", val: "c]d"}}}}, {{tag: "td"}}}},
+		{`a[rel~=next] , div[data-kind*="foot"]`, [][]compoundSelector{
+			{{tag: "a", attrs: []attrSelector{{key: "rel", op: "~=", val: "next"}}}},
+			{{tag: "div", attrs: []attrSelector{{key: "data-kind", op: "*=", val: "foot"}}}},
+		}},
+	}
+	for _, tt := range tests {
+		sel, err := compileSelector(tt.selector)
+		if err != nil {
+			t.Errorf("compileSelector(%q): %v", tt.selector, err)
+			continue
+		}
+		if !reflect.DeepEqual(sel.alternatives, tt.want) {
+			t.Errorf("compileSelector(%q)\n got %+v\nwant %+v", tt.selector, sel.alternatives, tt.want)
+		}
+	}
+}
+
+func TestCompileSelectorErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"td,",
+		"> td",
+		"tr >",
+		"tr > > td",
+		"#",
+		"td.",
+		"a[href",
+		"a[title='x]",
+		"a[]",
+		"a[=x]",
+		"a[href!=x]",
+		"td:hover",
+		"td:nth-child",
+		"td:nth-child(0)",
+		"td:nth-child(2n+1)",
+		"td + td",
+	} {
+		if _, err := compileSelector(s); err == nil {
+			t.Errorf("compileSelector(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestSelectorMatchAll(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(selectorTestPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		selector string
+		want     string // Space-separated ids of the matches, in document order
+	}{
+		// Type, id and class
+		{"tr", "r1 r2"},
+		{"#r2", "r2"},
+		{"td.name", "r1c2 r2c2"},
+		{".row.odd", "r1"},
+		{"table.wide.list", "results"},
+		{"tr.missing", ""},
+
+		// Child vs descendant
+		{"table#results > tbody > tr", "r1 r2"},
+		{"table > tr", ""}, // The parser inserts the tbody
+		{"table tr", "r1 r2"},
+		{"td.name > a", "a1"},
+		{"td.name a", "a1 a2"},
+		{"tr > a", ""},
+		{"table td > span > a", "a2"},
+		{"body > div > a", "a3"},
+
+		// Positions
+		{"td:first-child", "r1c1 r2c1"},
+		{"td:last-child", "r1c3 r2c3"},
+		{"td:nth-child(2)", "r1c2 r2c2"},
+		{"td:nth-last-child(2)", "r1c2 r2c2"},
+		{"td:nth-last-child(3)", "r1c1 r2c1"},
+		{"td:nth-last-child(4)", ""},
+		{"tr:nth-last-child(1) td:nth-child(3)", "r2c3"},
+
+		// Attribute operators
+		{"[href]", "a1 a2 a3"},
+		{"a[href='/torrent/2']", "a2"},
+		{"a[href^='magnet:']", "a1"},
+		{"a[href$='.html']", "a3"},
+		{"a[href*=torrent]", "a2"},
+		{"a[rel~=nofollow]", "a3"},
+		{"a[rel~=nofol]", ""},
+		{"a[rel=next]", ""},
+		{"a[title='a,b']", "a1"},
+		{`a[title="c]d"]`, "a2"},
+		{"[href^='']", ""},
+
+		// Alternatives, in document order without duplicates
+		{"#a3, #a1, a[title='a,b']", "a1 a3"},
+	}
+	for _, tt := range tests {
+		sel, err := compileSelector(tt.selector)
+		if err != nil {
+			t.Errorf("compileSelector(%q): %v", tt.selector, err)
+			continue
+		}
+		var ids []string
+		for _, n := range sel.matchAll(doc) {
+			ids = append(ids, attrValue(n, "id"))
+		}
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("%q matched %q, want %q", tt.selector, got, tt.want)
+		}
+	}
+}
+
+func TestMatchCompoundsRelativeToRoot(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(selectorTestPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, _ := compileSelector("tr")
+	row := rows.matchFirst(doc)
+
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"td:nth-child(2) a", "a1"},
+		{"tr > td.name > a", "a1"}, // The root itself can match the first compound
+		{"table td", ""},           // Ancestors above the root don't count
+		{"tbody a", ""},
+	}
+	for _, tt := range tests {
+		sel, err := compileSelector(tt.selector)
+		if err != nil {
+			t.Fatalf("compileSelector(%q): %v", tt.selector, err)
+		}
+		got := ""
+		if n := sel.matchFirst(row); n != nil {
+			got = attrValue(n, "id")
+		}
+		if got != tt.want {
+			t.Errorf("%q within the first row matched %q, want %q", tt.selector, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"torrent-play/release"
+)
+
+// StreamStatus is a JSON-friendly snapshot of a stream for status endpoints and the UI.
+type StreamStatus struct {
+	ID        string      `json:"id"`
+	State     StreamState `json:"state"`
+	Error     string      `json:"error,omitempty"`
+	Profile   string      `json:"profile"`
+	FastStart bool        `json:"fastStart"`
+	// FastStartIgnored is true when fast start was requested but has no effect because the
+	// profile copies the video, which can only be cut at the source's keyframes.
+	FastStartIgnored bool `json:"fastStartIgnored,omitempty"`
+	// DASH is true when the stream has a DASH manifest; see StreamOptions.SupportsDASH.
+	DASH bool `json:"dash"`
+
+	FileName       string        `json:"fileName,omitempty"`
+	Release        *release.Info `json:"release,omitempty"`
+	FileSize       int64         `json:"fileSize,omitempty"`
+	BytesCompleted int64         `json:"bytesCompleted,omitempty"`
+	Progress       float64       `json:"progress"` // Download progress of the selected file, 0-1
+
+	// Playable is true once the first segment has been written, along with the default audio
+	// rendition's when it has its own playlist, and the HLS URL can be loaded.
+	Playable             bool  `json:"playable"`
+	TimeToFirstSegmentMs int64 `json:"timeToFirstSegmentMs,omitempty"`
+
+	// Thumbnails is true when a WebVTT thumbnail track is available under thumbs/, and
+	// Poster once the poster frame has been written.
+	Thumbnails bool `json:"thumbnails"`
+	Poster     bool `json:"poster"`
+
+	AudioTracks []AudioTrack    `json:"audioTracks"`
+	Subtitles   []SubtitleTrack `json:"subtitles"`
+	AddedAt     time.Time       `json:"addedAt"`
+}
+
+// StreamMetrics aggregates stream timings since the service started.
+type StreamMetrics struct {
+	StreamsAdded             int   `json:"streamsAdded"`
+	StreamsPlayable          int   `json:"streamsPlayable"`
+	LastTimeToFirstSegmentMs int64 `json:"lastTimeToFirstSegmentMs"`
+	AvgTimeToFirstSegmentMs  int64 `json:"avgTimeToFirstSegmentMs"`
+	MaxTimeToFirstSegmentMs  int64 `json:"maxTimeToFirstSegmentMs"`
+}
+
+// streamMetrics accumulates StreamMetrics. It is guarded by the HlsService lock.
+type streamMetrics struct {
+	added, playable          int
+	total, last, maxDuration time.Duration
+}
+
+func (m *streamMetrics) recordFirstSegment(d time.Duration) {
+	m.playable++
+	m.total += d
+	m.last = d
+	if d > m.maxDuration {
+		m.maxDuration = d
+	}
+}
+
+func (m *streamMetrics) snapshot() StreamMetrics {
+	out := StreamMetrics{
+		StreamsAdded:             m.added,
+		StreamsPlayable:          m.playable,
+		LastTimeToFirstSegmentMs: m.last.Milliseconds(),
+		MaxTimeToFirstSegmentMs:  m.maxDuration.Milliseconds(),
+	}
+	if m.playable > 0 {
+		out.AvgTimeToFirstSegmentMs = (m.total / time.Duration(m.playable)).Milliseconds()
+	}
+	return out
+}
+
+// Metrics returns the aggregated stream timings.
+func (s *HlsService) Metrics() StreamMetrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.metrics.snapshot()
+}
+
+// StreamStatus returns a snapshot of a single stream.
+func (s *HlsService) StreamStatus(streamID string) (StreamStatus, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	info, ok := s.streams[streamID]
+	if !ok {
+		return StreamStatus{}, false
+	}
+	return info.status(), true
+}
+
+// ListStreamStatuses returns a snapshot of every stream, most recently added first.
+func (s *HlsService) ListStreamStatuses() []StreamStatus {
+	s.mu.RLock()
+	statuses := make([]StreamStatus, 0, len(s.streams))
+	for _, info := range s.streams {
+		statuses = append(statuses, info.status())
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].AddedAt.After(statuses[j].AddedAt)
+	})
+	return statuses
+}
+
+// status builds the snapshot. The caller must hold the service lock.
+func (info *StreamInfo) status() StreamStatus {
+	profile, _ := LookupTranscodeProfile(info.Options.Profile)
+	st := StreamStatus{
+		ID:          info.ID,
+		State:       info.State,
+		Profile:     profile.Name,
+		FastStart:   info.Options.FastStart,
+		DASH:        info.Options.SupportsDASH(),
+		Playable:    !info.FirstSegmentAt.IsZero(),
+		AudioTracks: append([]AudioTrack{}, info.AudioTracks...),
+		Subtitles:   append([]SubtitleTrack{}, info.Subtitles...),
+		AddedAt:     info.AddedAt,
+		Release:     info.Release,
+	}
+	st.FastStartIgnored = info.FastStartIgnored
+	if info.Error != nil {
+		st.Error = info.Error.Error()
+	}
+	if info.Thumbnails && info.HlsDir != "" {
+		_, err := os.Stat(filepath.Join(info.HlsDir, thumbsDirName, thumbnailsVTTName))
+		st.Thumbnails = err == nil
+		_, err = os.Stat(filepath.Join(info.HlsDir, thumbsDirName, posterFileName))
+		st.Poster = err == nil
+	}
+	if st.Playable {
+		st.TimeToFirstSegmentMs = info.FirstSegmentAt.Sub(info.AddedAt).Milliseconds()
+	}
+	if info.File != nil {
+		st.FileName = path.Base(info.File.Path())
+		st.FileSize = info.File.Length()
+		st.BytesCompleted = info.File.BytesCompleted()
+		if st.FileSize > 0 {
+			st.Progress = float64(st.BytesCompleted) / float64(st.FileSize)
+		}
+	}
+	return st
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SubtitleQuery describes a subtitle search. At least one of ImdbID, FileHash or Query must be set.
+type SubtitleQuery struct {
+	ImdbID    string   // IMDb ID as found in SearchResult.ImdbID, e.g. "tt0133093"
+	FileHash  string   // OpenSubtitles hash of the video file, see OpenSubtitlesHash
+	Query     string   // Free-text title or release name
+	Languages []string // Language codes to restrict the search to, e.g. "en"
+}
+
+// SubtitleSearchResult is a single downloadable subtitle file.
+type SubtitleSearchResult struct {
+	FileID        string `json:"fileId"`
+	FileName      string `json:"fileName"`
+	Language      string `json:"language"`
+	Release       string `json:"release"`
+	DownloadCount int    `json:"downloadCount"`
+	HashMatch     bool   `json:"hashMatch"` // The subtitle was synced against this exact file
+}
+
+// SubtitleProvider defines the interface for an external subtitle search service.
+type SubtitleProvider interface {
+	SearchSubtitles(ctx context.Context, query SubtitleQuery) ([]SubtitleSearchResult, error)
+	// DownloadSubtitle returns the subtitle file contents and its file name.
+	DownloadSubtitle(ctx context.Context, fileID string) (data []byte, fileName string, err error)
+}
+
+const (
+	// DefaultOpenSubtitlesBaseURL is the OpenSubtitles REST API root.
+	DefaultOpenSubtitlesBaseURL = "https://api.opensubtitles.com/api/v1"
+	openSubtitlesUserAgent      = "torrent-play v1.0"
+)
+
+// OpenSubtitlesService implements SubtitleProvider against the OpenSubtitles REST API,
+// or any service exposing the same /subtitles and /download endpoints.
+type OpenSubtitlesService struct {
+	Client  *http.Client
+	BaseURL string
+	APIKey  string
+}
+
+// NewOpenSubtitlesService creates a new instance of OpenSubtitlesService.
+// If baseURL is empty, it uses DefaultOpenSubtitlesBaseURL.
+func NewOpenSubtitlesService(baseURL, apiKey string) *OpenSubtitlesService {
+	if baseURL == "" {
+		baseURL = DefaultOpenSubtitlesBaseURL
+	}
+	return &OpenSubtitlesService{
+		Client: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		APIKey:  apiKey,
+	}
+}
+
+// openSubtitlesSearchResponse mirrors the parts of GET /subtitles used here.
+type openSubtitlesSearchResponse struct {
+	Data []struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			Language       string `json:"language"`
+			Release        string `json:"release"`
+			DownloadCount  int    `json:"download_count"`
+			MovieHashMatch bool   `json:"moviehash_match"`
+			Files          []struct {
+				FileID   int64  `json:"file_id"`
+				FileName string `json:"file_name"`
+			} `json:"files"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// openSubtitlesDownloadResponse mirrors the parts of POST /download used here.
+type openSubtitlesDownloadResponse struct {
+	Link     string `json:"link"`
+	FileName string `json:"file_name"`
+	Message  string `json:"message"`
+}
+
+// SearchSubtitles searches for subtitles by IMDb ID, file hash and/or name.
+// Results are ordered with hash matches first, then by download count.
+func (s *OpenSubtitlesService) SearchSubtitles(ctx context.Context, query SubtitleQuery) ([]SubtitleSearchResult, error) {
+	if query.ImdbID == "" && query.FileHash == "" && query.Query == "" {
+		return nil, fmt.Errorf("subtitle search needs an IMDb ID, file hash or query")
+	}
+
+	params := url.Values{}
+	if query.ImdbID != "" {
+		// The API takes the numeric part of the IMDb ID.
+		id, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(query.ImdbID), "tt"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid IMDb ID %q", query.ImdbID)
+		}
+		params.Set("imdb_id", strconv.Itoa(id))
+	}
+	if query.FileHash != "" {
+		params.Set("moviehash", strings.ToLower(query.FileHash))
+	}
+	if query.Query != "" {
+		params.Set("query", query.Query)
+	}
+	if len(query.Languages) > 0 {
+		langs := make([]string, 0, len(query.Languages))
+		for _, l := range query.Languages {
+			if info, ok := lookupLanguage(l); ok {
+				l = info.Tag
+			}
+			langs = append(langs, strings.ToLower(l))
+		}
+		sort.Strings(langs) // The API expects a sorted, comma separated list
+		params.Set("languages", strings.Join(langs, ","))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL+"/subtitles?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	var apiResp openSubtitlesSearchResponse
+	if err := s.doJSON(req, &apiResp); err != nil {
+		return nil, err
+	}
+
+	results := make([]SubtitleSearchResult, 0, len(apiResp.Data))
+	for _, item := range apiResp.Data {
+		for _, f := range item.Attributes.Files {
+			results = append(results, SubtitleSearchResult{
+				FileID:        strconv.FormatInt(f.FileID, 10),
+				FileName:      f.FileName,
+				Language:      item.Attributes.Language,
+				Release:       item.Attributes.Release,
+				DownloadCount: item.Attributes.DownloadCount,
+				HashMatch:     item.Attributes.MovieHashMatch,
+			})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].HashMatch != results[j].HashMatch {
+			return results[i].HashMatch
+		}
+		return results[i].DownloadCount > results[j].DownloadCount
+	})
+	return results, nil
+}
+
+// DownloadSubtitle requests a download link for the file and fetches the subtitle from it.
+func (s *OpenSubtitlesService) DownloadSubtitle(ctx context.Context, fileID string) ([]byte, string, error) {
+	id, err := strconv.ParseInt(fileID, 10, 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid subtitle file ID %q", fileID)
+	}
+	body, err := json.Marshal(map[string]any{"file_id": id})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode download request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.BaseURL+"/download", bytes.NewReader(body))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var link openSubtitlesDownloadResponse
+	if err := s.doJSON(req, &link); err != nil {
+		return nil, "", err
+	}
+	if link.Link == "" {
+		return nil, "", fmt.Errorf("subtitle provider returned no download link: %s", link.Message)
+	}
+
+	fileReq, err := http.NewRequestWithContext(ctx, http.MethodGet, link.Link, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	fileReq.Header.Set("User-Agent", openSubtitlesUserAgent)
+	resp, err := s.Client.Do(fileReq)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download subtitle: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", upstreamStatusError("subtitle download", resp, "")
+	}
+	// Subtitle files are small; cap the read so a misbehaving server can't exhaust memory.
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read subtitle: %w", err)
+	}
+	return data, link.FileName, nil
+}
+
+// doJSON sends an API request with the provider's headers and decodes the JSON response into v.
+func (s *OpenSubtitlesService) doJSON(req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", openSubtitlesUserAgent)
+	if s.APIKey != "" {
+		req.Header.Set("Api-Key", s.APIKey)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute HTTP request to subtitle provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return upstreamStatusError("subtitle provider", resp, strings.TrimSpace(string(bodyBytes)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode subtitle provider response: %w", err)
+	}
+	return nil
+}
+
+// openSubtitlesHashChunk is the size of the head and tail blocks hashed by OpenSubtitlesHash.
+const openSubtitlesHashChunk = 64 * 1024
+
+// OpenSubtitlesHash computes the OpenSubtitles "moviehash" of a file: its size plus the
+// little-endian uint64 sums of its first and last 64 KiB, as 16 hex digits.
+func OpenSubtitlesHash(r io.ReadSeeker, size int64) (string, error) {
+	if size < openSubtitlesHashChunk {
+		return "", fmt.Errorf("file too small to hash (%d bytes)", size)
+	}
+
+	hash := uint64(size)
+	buf := make([]byte, openSubtitlesHashChunk)
+	for _, offset := range []int64{0, size - openSubtitlesHashChunk} {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return "", fmt.Errorf("failed to seek for hashing: %w", err)
+		}
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", fmt.Errorf("failed to read for hashing: %w", err)
+		}
+		for i := 0; i < len(buf); i += 8 {
+			hash += binary.LittleEndian.Uint64(buf[i:])
+		}
+	}
+	return fmt.Sprintf("%016x", hash), nil
+}
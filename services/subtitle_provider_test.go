@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testOpenSubtitlesKey = "subtitle-key"
+
+// testSRT is the subtitle file the fake OpenSubtitles API serves for downloads.
+const testSRT = "1\n00:00:01,000 --> 00:00:02,000\nHello\n"
+
+// fakeOpenSubtitles serves the /subtitles and /download endpoints of the OpenSubtitles API
+// and the files its download links point to. It records the search queries.
+type fakeOpenSubtitles struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	queries []url.Values
+}
+
+func (f *fakeOpenSubtitles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/files/4242.srt" {
+		w.Write([]byte(testSRT))
+		return
+	}
+	if r.Header.Get("Api-Key") != testOpenSubtitlesKey {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message": "You cannot consume this service"}`))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/subtitles":
+		f.mu.Lock()
+		f.queries = append(f.queries, r.URL.Query())
+		f.mu.Unlock()
+		w.Write([]byte(`{"total_count": 3, "data": [
+			{"id": "1", "attributes": {"language": "en", "release": "The.Matrix.1999.720p", "download_count": 500, "moviehash_match": false,
+				"files": [{"file_id": 101, "file_name": "matrix.720p.srt"}]}},
+			{"id": "2", "attributes": {"language": "en", "release": "The.Matrix.1999.1080p", "download_count": 20, "moviehash_match": true,
+				"files": [{"file_id": 4242, "file_name": "matrix.1080p.srt"}]}},
+			{"id": "3", "attributes": {"language": "fr", "release": "The.Matrix.1999.CD1-2", "download_count": 900,
+				"files": [{"file_id": 301, "file_name": "cd1.srt"}, {"file_id": 302, "file_name": "cd2.srt"}]}}
+		]}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/download":
+		var body struct {
+			FileID int64 `json:"file_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if body.FileID != 4242 {
+			w.Write([]byte(`{"message": "You have downloaded your allowed 5 subtitles for 24h"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"link": f.server.URL + "/files/4242.srt", "file_name": "matrix.1080p.srt"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestOpenSubtitles(t *testing.T) (*OpenSubtitlesService, *fakeOpenSubtitles) {
+	t.Helper()
+	fake := &fakeOpenSubtitles{}
+	fake.server = httptest.NewServer(fake)
+	t.Cleanup(fake.server.Close)
+	return NewOpenSubtitlesService(fake.server.URL+"/api/v1/", testOpenSubtitlesKey), fake
+}
+
+func TestOpenSubtitlesSearch(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     SubtitleQuery
+		wantQuery url.Values
+	}{
+		{"imdb id", SubtitleQuery{ImdbID: "tt0133093"}, url.Values{"imdb_id": {"133093"}}},
+		{"hash", SubtitleQuery{FileHash: "8E245D9679D31E12"}, url.Values{"moviehash": {"8e245d9679d31e12"}}},
+		{"name", SubtitleQuery{Query: "The Matrix", Languages: []string{"French", "eng"}}, url.Values{"query": {"The Matrix"}, "languages": {"en,fr"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, fake := newTestOpenSubtitles(t)
+			got, err := s.SearchSubtitles(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("SearchSubtitles: %v", err)
+			}
+			if !reflect.DeepEqual(fake.queries[0], tt.wantQuery) {
+				t.Errorf("query = %v, want %v", fake.queries[0], tt.wantQuery)
+			}
+			// Hash matches first, then by download count; every file of a result is listed.
+			var ids []string
+			for _, r := range got {
+				ids = append(ids, r.FileID)
+			}
+			if want := []string{"4242", "301", "302", "101"}; !reflect.DeepEqual(ids, want) {
+				t.Errorf("file IDs = %v, want %v", ids, want)
+			}
+			want := SubtitleSearchResult{FileID: "4242", FileName: "matrix.1080p.srt", Language: "en", Release: "The.Matrix.1999.1080p", DownloadCount: 20, HashMatch: true}
+			if got[0] != want {
+				t.Errorf("first result = %+v, want %+v", got[0], want)
+			}
+		})
+	}
+}
+
+func TestOpenSubtitlesSearchErrors(t *testing.T) {
+	s, _ := newTestOpenSubtitles(t)
+	if _, err := s.SearchSubtitles(context.Background(), SubtitleQuery{}); err == nil {
+		t.Error("searched without an ID, hash or query")
+	}
+	if _, err := s.SearchSubtitles(context.Background(), SubtitleQuery{ImdbID: "matrix"}); err == nil {
+		t.Error("searched with an invalid IMDb ID")
+	}
+	s.APIKey = "wrong"
+	if _, err := s.SearchSubtitles(context.Background(), SubtitleQuery{Query: "x"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("got %v, want the 401", err)
+	}
+}
+
+func TestOpenSubtitlesDownload(t *testing.T) {
+	s, _ := newTestOpenSubtitles(t)
+	data, name, err := s.DownloadSubtitle(context.Background(), "4242")
+	if err != nil {
+		t.Fatalf("DownloadSubtitle: %v", err)
+	}
+	if string(data) != testSRT || name != "matrix.1080p.srt" {
+		t.Errorf("got %q (%s), want the fixture file", data, name)
+	}
+
+	_, _, err = s.DownloadSubtitle(context.Background(), "101")
+	if err == nil || !strings.Contains(err.Error(), "allowed 5 subtitles") {
+		t.Errorf("got %v, want the quota message", err)
+	}
+	if _, _, err := s.DownloadSubtitle(context.Background(), "abc"); err == nil {
+		t.Error("downloaded an invalid file ID")
+	}
+}
+
+// stubFFmpeg points FFmpegPath at a script that consumes its input and writes a one-segment
+// playlist wherever -segment_list asks, as a subtitle conversion would.
+func stubFFmpeg(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the ffmpeg stub is a shell script")
+	}
+	script := filepath.Join(t.TempDir(), "ffmpeg")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+while [ $# -gt 0 ]; do
+	[ "$1" = -segment_list ] && list=$2
+	shift
+done
+cat >/dev/null
+printf '#EXTM3U\n#EXTINF:10.000,\nsub_000.vtt\n#EXT-X-ENDLIST\n' >"$list"
+`), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := FFmpegPath
+	FFmpegPath = script
+	t.Cleanup(func() { FFmpegPath = old })
+}
+
+// newTestStream registers a stream that has its HLS directory but hasn't been probed yet.
+func newTestStream(t *testing.T) (*HlsService, string) {
+	t.Helper()
+	hlsDir := t.TempDir()
+	s := &HlsService{streams: map[string]*StreamInfo{}, streamKeys: map[string]string{}}
+	s.streams["s1"] = &StreamInfo{ID: "s1", HlsDir: hlsDir, State: StateDownloading}
+	return s, hlsDir
+}
+
+func TestAttachSubtitle(t *testing.T) {
+	stubFFmpeg(t)
+	provider, _ := newTestOpenSubtitles(t)
+	s, hlsDir := newTestStream(t)
+
+	data, name, err := provider.DownloadSubtitle(context.Background(), "4242")
+	if err != nil {
+		t.Fatal(err)
+	}
+	track, err := s.AttachSubtitle("s1", data, name, "eng")
+	if err != nil {
+		t.Fatalf("AttachSubtitle: %v", err)
+	}
+	if track.Language != "en" || track.Name != "English" || track.Source != SubtitleExternal {
+		t.Errorf("track = %+v, want an external English track", track)
+	}
+	if _, err := os.Stat(filepath.Join(hlsDir, filepath.FromSlash(track.PlaylistPath()))); err != nil {
+		t.Errorf("rendition playlist missing: %v", err)
+	}
+
+	// Probing finishes after the attach: the probed tracks come first and the attached one
+	// stays, renamed if its name is taken.
+	probed := []SubtitleTrack{{ID: "sub2", Language: "en", Name: "English", Source: SubtitleEmbedded}}
+	s.setProbedTracks("s1", nil, nil, probed, false)
+	if err := s.writeMasterPlaylist("s1"); err != nil {
+		t.Fatal(err)
+	}
+	subs := s.streams["s1"].Subtitles
+	if len(subs) != 2 || subs[0].ID != "sub2" || subs[1].ID != track.ID || subs[1].Name != "English (2)" {
+		t.Errorf("subtitles = %+v, want the probed track then the attached one", subs)
+	}
+	master, err := os.ReadFile(filepath.Join(hlsDir, masterPlaylistName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(master), `URI="`+track.PlaylistPath()+`"`) {
+		t.Errorf("master playlist lacks the attached subtitle:\n%s", master)
+	}
+
+	if _, err := s.AttachSubtitle("missing", data, name, "en"); !errors.Is(err, ErrStreamNotFound) {
+		t.Errorf("got %v, want ErrStreamNotFound", err)
+	}
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/anacrolix/torrent"
+)
+
+// SubtitleSource identifies where a subtitle track came from.
+type SubtitleSource string
+
+const (
+	SubtitleEmbedded SubtitleSource = "embedded" // A text stream inside the video container
+	SubtitleSidecar  SubtitleSource = "sidecar"  // A separate .srt/.ass/.vtt file in the torrent
+	SubtitleExternal SubtitleSource = "external" // Downloaded from a SubtitleProvider and attached later
+)
+
+// subtitlesDirName is the sub-directory of a stream's HLS directory holding WebVTT renditions.
+const subtitlesDirName = "subs"
+
+// SubtitleTrack describes a WebVTT subtitle rendition of a stream.
+type SubtitleTrack struct {
+	ID       string         `json:"id"`
+	Language string         `json:"language,omitempty"` // RFC 5646 tag, e.g. "en"
+	Name     string         `json:"name"`
+	Source   SubtitleSource `json:"source"`
+	Default  bool           `json:"default"`
+	Forced   bool           `json:"forced"`
+
+	StreamIndex int           `json:"-"` // Absolute ffprobe stream index, for embedded tracks
+	File        *torrent.File `json:"-"` // Torrent file, for sidecar tracks
+	inputFormat string        // ffmpeg demuxer for sidecar files
+}
+
+// PlaylistPath returns the track's media playlist path, relative to the HLS directory.
+func (t SubtitleTrack) PlaylistPath() string {
+	return subtitlesDirName + "/" + t.ID + ".m3u8"
+}
+
+// textSubtitleCodecs lists the ffmpeg subtitle decoders that can be converted to WebVTT.
+// Image-based formats (PGS, VobSub, DVB) are deliberately absent.
+var textSubtitleCodecs = map[string]bool{
+	"subrip":    true,
+	"srt":       true,
+	"ass":       true,
+	"ssa":       true,
+	"webvtt":    true,
+	"mov_text":  true,
+	"text":      true,
+	"microdvd":  true,
+	"subviewer": true,
+	"sami":      true,
+	"realtext":  true,
+	"mpl2":      true,
+}
+
+// sidecarSubtitleFormats maps sidecar file extensions to the ffmpeg demuxer that reads them.
+var sidecarSubtitleFormats = map[string]string{
+	".srt": "srt",
+	".ass": "ass",
+	".ssa": "ass",
+	".vtt": "webvtt",
+}
+
+// embeddedSubtitleTracks returns a track for every text subtitle stream in the probe.
+func embeddedSubtitleTracks(probe *MediaProbe) []SubtitleTrack {
+	var tracks []SubtitleTrack
+	for _, st := range probe.StreamsOfType("subtitle") {
+		if !textSubtitleCodecs[st.CodecName] {
+			continue
+		}
+		lang, _ := lookupLanguage(st.Tags.Language)
+		tracks = append(tracks, SubtitleTrack{
+			ID:          fmt.Sprintf("sub%d", st.Index),
+			Language:    lang.Tag,
+			Name:        subtitleTrackName(st.Tags.Title, lang, st.Disposition.Forced != 0, len(tracks)),
+			Source:      SubtitleEmbedded,
+			Default:     st.Disposition.Default != 0,
+			Forced:      st.Disposition.Forced != 0,
+			StreamIndex: st.Index,
+		})
+	}
+	return tracks
+}
+
+// findSidecarSubtitles returns a track for every subtitle file in the torrent that belongs to video.
+// A file belongs to the video when its name starts with the video's name (e.g. "Movie.en.srt"
+// next to "Movie.mkv"), or when it sits in a "Subs" directory next to the video, optionally in a
+// further sub-directory named after the video (the usual layout of season packs).
+func findSidecarSubtitles(video *torrent.File, files []*torrent.File) []SubtitleTrack {
+	videoDir := path.Dir(video.Path())
+	videoStem := strings.ToLower(strings.TrimSuffix(path.Base(video.Path()), path.Ext(video.Path())))
+
+	var tracks []SubtitleTrack
+	for _, f := range files {
+		ext := strings.ToLower(path.Ext(f.Path()))
+		format, ok := sidecarSubtitleFormats[ext]
+		if !ok {
+			continue
+		}
+		stem := strings.TrimSuffix(path.Base(f.Path()), path.Ext(f.Path()))
+
+		var suffix string
+		switch {
+		case path.Dir(f.Path()) == videoDir && strings.HasPrefix(strings.ToLower(stem), videoStem):
+			suffix = stem[len(videoStem):]
+		case isSubtitleDirFor(path.Dir(f.Path()), videoDir, videoStem):
+			suffix = stem
+		default:
+			continue
+		}
+
+		lang, forced := sidecarLanguage(suffix)
+		tracks = append(tracks, SubtitleTrack{
+			ID:          fmt.Sprintf("ext%d", len(tracks)),
+			Language:    lang.Tag,
+			Name:        subtitleTrackName("", lang, forced, len(tracks)),
+			Source:      SubtitleSidecar,
+			Forced:      forced,
+			File:        f,
+			inputFormat: format,
+		})
+	}
+	return tracks
+}
+
+// isSubtitleDirFor reports whether dir is a subtitles directory for the video in videoDir.
+func isSubtitleDirFor(dir, videoDir, videoStem string) bool {
+	rel := dir
+	if videoDir != "." {
+		if !strings.HasPrefix(dir, videoDir+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(dir, videoDir+"/")
+	}
+	parts := strings.Split(rel, "/")
+	switch strings.ToLower(parts[0]) {
+	case "sub", "subs", "subtitles":
+	default:
+		return false
+	}
+	return len(parts) == 1 || (len(parts) == 2 && strings.ToLower(parts[1]) == videoStem)
+}
+
+// sidecarLanguage extracts the language and forced flag from what remains of a
+// sidecar file name once the video name is removed, e.g. ".en.forced" or "2_English".
+func sidecarLanguage(suffix string) (lang languageInfo, forced bool) {
+	tokens := strings.FieldsFunc(suffix, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, tok := range tokens {
+		if strings.EqualFold(tok, "forced") {
+			forced = true
+			continue
+		}
+		if info, ok := lookupLanguage(tok); ok && lang.Tag == "" {
+			lang = info
+		}
+	}
+	return lang, forced
+}
+
+// subtitleTrackName picks a human readable NAME for a rendition; HLS requires it to be unique
+// within the group, so unnamed tracks fall back to their position.
+func subtitleTrackName(title string, lang languageInfo, forced bool, position int) string {
+	name := strings.TrimSpace(title)
+	if name == "" {
+		name = lang.Name
+	}
+	if name == "" {
+		name = "Subtitle " + strconv.Itoa(position+1)
+	}
+	if forced && !strings.Contains(strings.ToLower(name), "forced") {
+		name += " (forced)"
+	}
+	return name
+}
+
+// webvttSegmentOutputArgs returns the ffmpeg output options that convert the currently
+// mapped subtitle stream to WebVTT and segment it alongside an HLS media playlist.
+func webvttSegmentOutputArgs(hlsDir string, track SubtitleTrack) []string {
+	return []string{
+		"-c:s", "webvtt",
+		"-f", "segment",
+		"-segment_time", strconv.Itoa(hlsSegmentSeconds),
+		"-segment_list", filepath.Join(hlsDir, filepath.FromSlash(track.PlaylistPath())),
+		"-segment_list_type", "m3u8",
+		"-segment_format", "webvtt",
+		filepath.Join(hlsDir, subtitlesDirName, track.ID+"_%03d.vtt"),
+	}
+}
+
+// convertSidecarSubtitle reads a sidecar subtitle file from the torrent and writes it as a
+// segmented WebVTT rendition into the stream's HLS directory.
+func convertSidecarSubtitle(streamID, hlsDir string, track SubtitleTrack) error {
+	reader := track.File.NewReader()
+	defer reader.Close()
+
+	log.Printf("[%s] Converting sidecar subtitle %s to WebVTT", streamID, track.File.Path())
+	return segmentSubtitle(hlsDir, track, reader, track.inputFormat)
+}
+
+// segmentSubtitle converts a standalone subtitle file read from input into a segmented WebVTT
+// rendition. An empty inputFormat lets ffmpeg detect the format.
+func segmentSubtitle(hlsDir string, track SubtitleTrack, input io.Reader, inputFormat string) error {
+	var args []string
+	if inputFormat != "" {
+		args = append(args, "-f", inputFormat)
+	}
+	args = append(args, "-i", "pipe:0")
+	args = append(args, webvttSegmentOutputArgs(hlsDir, track)...)
+
+	cmd := exec.Command(FFmpegPath, args...)
+	cmd.Stdin = input
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg subtitle conversion failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// AttachSubtitle converts a downloaded subtitle file to WebVTT and adds it to the stream's
+// master playlist as a new rendition. fileName is only used to pick the input format.
+func (s *HlsService) AttachSubtitle(streamID string, data []byte, fileName, language string) (SubtitleTrack, error) {
+	s.mu.RLock()
+	info, ok := s.streams[streamID]
+	var hlsDir string
+	if ok {
+		hlsDir = info.HlsDir
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return SubtitleTrack{}, ErrStreamNotFound
+	}
+	if hlsDir == "" {
+		return SubtitleTrack{}, fmt.Errorf("stream %s has not started transcoding yet", streamID)
+	}
+	if err := ensureSubtitlesDir(hlsDir); err != nil {
+		return SubtitleTrack{}, fmt.Errorf("failed to create subtitles dir: %w", err)
+	}
+
+	lang, _ := lookupLanguage(language)
+	track := SubtitleTrack{
+		ID:       fmt.Sprintf("dl%d", s.attachedSubtitles.Add(1)),
+		Language: lang.Tag,
+		Source:   SubtitleExternal,
+	}
+	format := sidecarSubtitleFormats[strings.ToLower(filepath.Ext(fileName))]
+	log.Printf("[%s] Attaching external subtitle %s as %s", streamID, fileName, track.ID)
+	if err := segmentSubtitle(hlsDir, track, bytes.NewReader(data), format); err != nil {
+		return SubtitleTrack{}, err
+	}
+
+	s.mu.Lock()
+	track.Name = uniqueSubtitleName(subtitleTrackName("", lang, false, len(info.Subtitles)), info.Subtitles)
+	info.Subtitles = append(info.Subtitles, track)
+	s.mu.Unlock()
+
+	if err := s.writeMasterPlaylist(streamID); err != nil {
+		return SubtitleTrack{}, fmt.Errorf("failed to update master playlist: %w", err)
+	}
+	return track, nil
+}
+
+// uniqueSubtitleName appends a counter to name if another rendition already uses it.
+func uniqueSubtitleName(name string, existing []SubtitleTrack) string {
+	taken := make(map[string]bool, len(existing))
+	for _, track := range existing {
+		taken[track.Name] = true
+	}
+	candidate := name
+	for n := 2; taken[candidate]; n++ {
+		candidate = fmt.Sprintf("%s (%d)", name, n)
+	}
+	return candidate
+}
+
+// StreamFileHash computes the OpenSubtitles hash of the stream's selected file. It blocks
+// until the first and last 64 KiB of the file have been downloaded, or ctx is done.
+func (s *HlsService) StreamFileHash(ctx context.Context, streamID string) (string, error) {
+	s.mu.RLock()
+	info, ok := s.streams[streamID]
+	var file *torrent.File
+	if ok {
+		file = info.File
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return "", ErrStreamNotFound
+	}
+	if file == nil {
+		return "", fmt.Errorf("stream %s has no file selected yet", streamID)
+	}
+
+	reader := file.NewReader()
+	defer reader.Close()
+	return OpenSubtitlesHash(contextReadSeeker{ctx: ctx, r: reader}, file.Length())
+}
+
+// contextReadSeeker adapts a torrent reader so that reads give up when ctx is done.
+type contextReadSeeker struct {
+	ctx context.Context
+	r   torrent.Reader
+}
+
+func (c contextReadSeeker) Read(p []byte) (int, error) {
+	return c.r.ReadContext(c.ctx, p)
+}
+
+func (c contextReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return c.r.Seek(offset, whence)
+}
+
+// ensureSubtitlesDir creates the directory that holds WebVTT renditions.
+func ensureSubtitlesDir(hlsDir string) error {
+	return os.MkdirAll(filepath.Join(hlsDir, subtitlesDirName), 0750)
+}
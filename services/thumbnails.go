@@ -0,0 +1,139 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// thumbsDirName is the sub-directory of a stream's HLS directory holding trickplay sprites,
+// their WebVTT index and the poster frame.
+const thumbsDirName = "thumbs"
+
+const (
+	thumbnailsVTTName = "thumbs.vtt"
+	posterFileName    = "poster.jpg"
+
+	thumbnailInterval = 10  // Seconds between thumbnails
+	thumbnailWidth    = 160 // Pixels; the height follows the source aspect ratio
+	spriteColumns     = 5
+	spriteRows        = 5
+	posterWidth       = 480
+)
+
+// thumbnailGeometry is the size of a single thumbnail within a sprite sheet.
+type thumbnailGeometry struct {
+	Width, Height int
+}
+
+// thumbnailGeometryFor derives the thumbnail size from the source video's aspect ratio. It
+// reports false when the probe has no usable video stream, in which case no thumbnails are made.
+func thumbnailGeometryFor(probe *MediaProbe) (thumbnailGeometry, bool) {
+	videos := probe.StreamsOfType("video")
+	if len(videos) == 0 || videos[0].Width <= 0 || videos[0].Height <= 0 {
+		return thumbnailGeometry{}, false
+	}
+	height := int(math.Round(float64(thumbnailWidth)*float64(videos[0].Height)/float64(videos[0].Width)/2)) * 2
+	if height < 2 {
+		height = 2
+	}
+	return thumbnailGeometry{Width: thumbnailWidth, Height: height}, true
+}
+
+// spriteName returns the file name of the n-th sprite sheet, numbered from 1 like ffmpeg's image2 muxer.
+func spriteName(n int) string {
+	return fmt.Sprintf("sprite_%03d.jpg", n)
+}
+
+// thumbnailOutputArgs returns the ffmpeg outputs writing sprite sheets of spriteColumns x spriteRows
+// thumbnails, one every thumbnailInterval seconds, into the thumbs directory. The tile filter only
+// emits a sheet once it is full (or at the end of the input), so sheets appear while transcoding
+// roughly every spriteColumns*spriteRows*thumbnailInterval seconds of video.
+func thumbnailOutputArgs(hlsDir string, geom thumbnailGeometry) []string {
+	filter := fmt.Sprintf("fps=1/%d,scale=%d:%d,tile=%dx%d", thumbnailInterval, geom.Width, geom.Height, spriteColumns, spriteRows)
+	return []string{
+		"-map", "0:v:0",
+		"-vf", filter,
+		"-an", "-sn",
+		"-q:v", "5",
+		"-f", "image2",
+		filepath.Join(hlsDir, thumbsDirName, "sprite_%03d.jpg"),
+	}
+}
+
+// posterOffset picks the time of the poster frame: a tenth into the video, to skip past logos and
+// black frames, but no more than two minutes in so the poster is available early.
+func posterOffset(duration float64) float64 {
+	if duration <= 0 {
+		return thumbnailInterval
+	}
+	return math.Min(duration/10, 120)
+}
+
+// posterOutputArgs returns the ffmpeg output writing a single poster frame taken at the given offset.
+// -ss is an output option here, so the input is still read once, from the start, by every output.
+func posterOutputArgs(hlsDir string, offset float64) []string {
+	return []string{
+		"-map", "0:v:0",
+		"-ss", strconv.FormatFloat(offset, 'f', 3, 64),
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:-2", posterWidth),
+		"-an", "-sn",
+		"-q:v", "3",
+		"-update", "1",
+		filepath.Join(hlsDir, thumbsDirName, posterFileName),
+	}
+}
+
+// writeThumbnailsVTT writes the WebVTT thumbnail track for a source of the given duration. Each cue
+// points at a region of a sprite sheet using a media fragment, e.g. "sprite_001.jpg#xywh=160,0,160,90".
+// The index is written up front from the probed duration, so cues for sheets that haven't been
+// written yet resolve to missing images until the transcode catches up.
+func writeThumbnailsVTT(hlsDir string, geom thumbnailGeometry, duration float64) error {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+
+	perSprite := spriteColumns * spriteRows
+	count := int(math.Ceil(duration / thumbnailInterval))
+	for i := 0; i < count; i++ {
+		start := time.Duration(i*thumbnailInterval) * time.Second
+		end := time.Duration(math.Min(float64((i+1)*thumbnailInterval), duration) * float64(time.Second))
+		pos := i % perSprite
+		x, y := (pos%spriteColumns)*geom.Width, (pos/spriteColumns)*geom.Height
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), spriteName(i/perSprite+1), x, y, geom.Width, geom.Height)
+	}
+	return writeFileAtomic(filepath.Join(hlsDir, thumbsDirName, thumbnailsVTTName), []byte(b.String()))
+}
+
+// vttTimestamp formats d as a WebVTT timestamp, e.g. "01:02:03.456".
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// PosterPath returns the path of the stream's poster frame, once ffmpeg has written it.
+func (s *HlsService) PosterPath(streamID string) (string, error) {
+	s.mu.RLock()
+	info, ok := s.streams[streamID]
+	var hlsDir string
+	if ok {
+		hlsDir = info.HlsDir
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return "", ErrStreamNotFound
+	}
+	if hlsDir == "" {
+		return "", os.ErrNotExist
+	}
+	posterPath := filepath.Join(hlsDir, thumbsDirName, posterFileName)
+	if _, err := os.Stat(posterPath); err != nil {
+		return "", err
+	}
+	return posterPath, nil
+}
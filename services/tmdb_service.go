@@ -0,0 +1,545 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnsupportedQuery is returned for searches a metadata provider cannot perform.
+var ErrUnsupportedQuery = errors.New("unsupported query")
+
+const (
+	tmdbAPIBaseURL   = "https://api.themoviedb.org/3"
+	tmdbImageBaseURL = "https://image.tmdb.org/t/p/"
+
+	tmdbPosterSize   = "w500"
+	tmdbBackdropSize = "w1280"
+	tmdbMaxCast      = 5 // OMDb lists a handful of leading actors; match it
+	// tmdbMaxLookups bounds the concurrent external ID lookups of a search page. A page of 20
+	// results costs 21 requests, so the API host's rate limit is raised by default; see
+	// DefaultOutboundLimits.
+	tmdbMaxLookups = 4
+)
+
+// TMDBService implements ImdbSearcher using The Movie Database API. Titles are still identified
+// by IMDb ID: search results are mapped through TMDB's external IDs, and lookups go through
+// TMDB's /find endpoint. It also provides poster and backdrop artwork.
+type TMDBService struct {
+	Client       *http.Client
+	BaseURL      string
+	ImageBaseURL string
+	// APIKey is either a v3 API key or a v4 read access token; tokens are sent as bearer
+	// credentials, keys as the api_key parameter.
+	APIKey string
+}
+
+// NewTMDBService creates a new TMDBService against the public TMDB API.
+func NewTMDBService(apiKey string) *TMDBService {
+	return &TMDBService{
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		BaseURL:      tmdbAPIBaseURL,
+		ImageBaseURL: tmdbImageBaseURL,
+		APIKey:       apiKey,
+	}
+}
+
+// tmdbTitle is the subset of a TMDB movie, TV show or search result this service reads.
+// Movies use Title and ReleaseDate, TV shows Name and FirstAirDate.
+type tmdbTitle struct {
+	ID           int     `json:"id"`
+	MediaType    string  `json:"media_type"` // Multi-search only: "movie", "tv" or "person"
+	Title        string  `json:"title"`
+	Name         string  `json:"name"`
+	ReleaseDate  string  `json:"release_date"`
+	FirstAirDate string  `json:"first_air_date"`
+	PosterPath   string  `json:"poster_path"`
+	BackdropPath string  `json:"backdrop_path"`
+	Overview     string  `json:"overview"`
+	VoteAverage  float64 `json:"vote_average"`
+	VoteCount    int     `json:"vote_count"`
+}
+
+type tmdbSearchResponse struct {
+	Page         int         `json:"page"`
+	TotalPages   int         `json:"total_pages"`
+	TotalResults int         `json:"total_results"`
+	Results      []tmdbTitle `json:"results"`
+}
+
+// tmdbCredits is the "credits" appended to movie, TV and episode details.
+type tmdbCredits struct {
+	Cast []struct {
+		Name string `json:"name"`
+	} `json:"cast"`
+	Crew []struct {
+		Name       string `json:"name"`
+		Job        string `json:"job"`
+		Department string `json:"department"`
+	} `json:"crew"`
+}
+
+type tmdbNamed struct {
+	Name        string `json:"name"`
+	EnglishName string `json:"english_name"`
+}
+
+type tmdbDetailsResponse struct {
+	tmdbTitle
+	Runtime         int         `json:"runtime"`          // Movies
+	EpisodeRunTime  []int       `json:"episode_run_time"` // TV shows
+	LastAirDate     string      `json:"last_air_date"`
+	Status          string      `json:"status"` // e.g. "Ended", "Returning Series"
+	NumberOfSeasons int         `json:"number_of_seasons"`
+	Genres          []tmdbNamed `json:"genres"`
+	SpokenLanguages []tmdbNamed `json:"spoken_languages"`
+	CreatedBy       []tmdbNamed `json:"created_by"`
+	Credits         tmdbCredits `json:"credits"`
+	ImdbID          string      `json:"imdb_id"` // Movies; TV shows have it under external_ids
+}
+
+// tmdbEpisode is a TV episode as listed in a season or returned by /find.
+type tmdbEpisode struct {
+	ID            int     `json:"id"`
+	ShowID        int     `json:"show_id"`
+	Name          string  `json:"name"`
+	Overview      string  `json:"overview"`
+	AirDate       string  `json:"air_date"`
+	SeasonNumber  int     `json:"season_number"`
+	EpisodeNumber int     `json:"episode_number"`
+	Runtime       int     `json:"runtime"`
+	StillPath     string  `json:"still_path"`
+	VoteAverage   float64 `json:"vote_average"`
+	VoteCount     int     `json:"vote_count"`
+}
+
+type tmdbFindResponse struct {
+	MovieResults     []tmdbTitle   `json:"movie_results"`
+	TVResults        []tmdbTitle   `json:"tv_results"`
+	TVEpisodeResults []tmdbEpisode `json:"tv_episode_results"`
+}
+
+// tmdbFound is the TMDB title an IMDb ID maps to.
+type tmdbFound struct {
+	Type    string // "movie", "series" or "episode", as in SearchResult.Type
+	Title   tmdbTitle
+	Episode tmdbEpisode // Set when Type is "episode"
+}
+
+// Search searches movies, TV shows or both. TMDB search results carry no IMDb IDs, so each
+// result is mapped through its external IDs; results without an IMDb ID are left out, as
+// nothing else in the app can use them, and a failed lookup fails the search. TMDB cannot
+// search episodes, and without a type the year filter only applies to the results of the
+// requested page.
+func (s *TMDBService) Search(ctx context.Context, query SearchQuery) (*SearchPage, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	params := url.Values{}
+	params.Set("query", query.Query)
+	params.Set("page", strconv.Itoa(query.Page))
+
+	var path string
+	switch query.Type {
+	case TitleTypeMovie:
+		path = "/search/movie"
+		if query.Year > 0 {
+			params.Set("year", strconv.Itoa(query.Year))
+		}
+	case TitleTypeSeries:
+		path = "/search/tv"
+		if query.Year > 0 {
+			params.Set("first_air_date_year", strconv.Itoa(query.Year))
+		}
+	case TitleTypeEpisode:
+		return nil, fmt.Errorf("%w: TMDB cannot search episodes by title", ErrUnsupportedQuery)
+	default:
+		path = "/search/multi"
+	}
+
+	var apiResp tmdbSearchResponse
+	if err := s.get(ctx, path, params, &apiResp); err != nil {
+		return nil, err
+	}
+
+	var candidates []tmdbTitle
+	for _, t := range apiResp.Results {
+		switch {
+		case query.Type == TitleTypeMovie:
+			t.MediaType = "movie"
+		case query.Type == TitleTypeSeries:
+			t.MediaType = "tv"
+		case t.MediaType != "movie" && t.MediaType != "tv":
+			continue // People, in a multi-search
+		}
+		if query.Type == "" && query.Year > 0 && t.year() != strconv.Itoa(query.Year) {
+			continue
+		}
+		candidates = append(candidates, t)
+	}
+
+	imdbIDs, err := s.externalImdbIDs(ctx, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &SearchPage{Results: []SearchResult{}, Page: query.Page, TotalResults: apiResp.TotalResults}
+	for i, t := range candidates {
+		if imdbIDs[i] == "" {
+			continue
+		}
+		page.Results = append(page.Results, s.searchResult(t, tmdbTitleType(t.MediaType), imdbIDs[i]))
+	}
+	if apiResp.Page < apiResp.TotalPages {
+		page.NextPage = query.Page + 1
+	}
+	return page, nil
+}
+
+// externalImdbIDs looks up the IMDb IDs of search results, tmdbMaxLookups at a time. A failed
+// lookup fails the whole page, so that a page missing results is never cached.
+func (s *TMDBService) externalImdbIDs(ctx context.Context, titles []tmdbTitle) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	imdbIDs := make([]string, len(titles))
+	var (
+		failOnce sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		failOnce.Do(func() {
+			firstErr = err
+			cancel() // Don't spend the rate limit on a page that will be discarded
+		})
+	}
+	sem := make(chan struct{}, tmdbMaxLookups)
+	var wg sync.WaitGroup
+	for i, t := range titles {
+		wg.Add(1)
+		go func(i int, t tmdbTitle) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				fail(ctx.Err())
+				return
+			}
+			var ids struct {
+				ImdbID string `json:"imdb_id"`
+			}
+			err := s.get(ctx, fmt.Sprintf("/%s/%d/external_ids", t.MediaType, t.ID), nil, &ids)
+			switch {
+			case errors.Is(err, ErrTitleNotFound):
+				// Removed since the search index was built; leave it out.
+			case err != nil:
+				fail(fmt.Errorf("failed to look up the IMDb ID of TMDB %s %d: %w", t.MediaType, t.ID, err))
+			default:
+				imdbIDs[i] = ids.ImdbID
+			}
+		}(i, t)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return imdbIDs, nil
+}
+
+// LookupByID finds the title with the given IMDb ID.
+func (s *TMDBService) LookupByID(ctx context.Context, imdbID string) (*SearchResult, error) {
+	found, err := s.find(ctx, imdbID)
+	if err != nil {
+		return nil, err
+	}
+	if found.Type == string(TitleTypeEpisode) {
+		result := SearchResult{
+			Title:  found.Episode.Name,
+			Year:   yearOf(found.Episode.AirDate),
+			ImdbID: imdbID,
+			Type:   found.Type,
+			Poster: s.imageURL(tmdbPosterSize, found.Episode.StillPath),
+		}
+		return &result, nil
+	}
+	result := s.searchResult(found.Title, found.Type, imdbID)
+	return &result, nil
+}
+
+// Details fetches the full details of a movie, TV show or episode by IMDb ID, with credits.
+func (s *TMDBService) Details(ctx context.Context, imdbID string) (*TitleDetails, error) {
+	found, err := s.find(ctx, imdbID)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{"append_to_response": {"credits"}}
+
+	if found.Type == string(TitleTypeEpisode) {
+		ep := found.Episode
+		var apiResp struct {
+			tmdbEpisode
+			Credits tmdbCredits `json:"credits"`
+		}
+		path := fmt.Sprintf("/tv/%d/season/%d/episode/%d", ep.ShowID, ep.SeasonNumber, ep.EpisodeNumber)
+		if err := s.get(ctx, path, params, &apiResp); err != nil {
+			return nil, err
+		}
+		details := &TitleDetails{
+			SearchResult: SearchResult{
+				Title:    apiResp.Name,
+				Year:     yearOf(apiResp.AirDate),
+				ImdbID:   imdbID,
+				Type:     found.Type,
+				Poster:   s.imageURL(tmdbPosterSize, apiResp.StillPath),
+				Backdrop: s.imageURL(tmdbBackdropSize, apiResp.StillPath),
+			},
+			Released:       apiResp.AirDate,
+			RuntimeMinutes: apiResp.Runtime,
+			Genres:         []string{},
+			Plot:           apiResp.Overview,
+			Languages:      []string{},
+			Ratings:        tmdbRatings(apiResp.VoteAverage, apiResp.VoteCount),
+		}
+		details.Directors, details.Writers, details.Cast = apiResp.Credits.people()
+		return details, nil
+	}
+
+	var apiResp tmdbDetailsResponse
+	kind := "movie"
+	if found.Type == string(TitleTypeSeries) {
+		kind = "tv"
+	}
+	if err := s.get(ctx, fmt.Sprintf("/%s/%d", kind, found.Title.ID), params, &apiResp); err != nil {
+		return nil, err
+	}
+
+	details := &TitleDetails{
+		SearchResult:   s.searchResult(apiResp.tmdbTitle, found.Type, imdbID),
+		Released:       apiResp.ReleaseDate,
+		RuntimeMinutes: apiResp.Runtime,
+		Genres:         tmdbNames(apiResp.Genres),
+		Plot:           apiResp.Overview,
+		Languages:      tmdbNames(apiResp.SpokenLanguages),
+		Ratings:        tmdbRatings(apiResp.VoteAverage, apiResp.VoteCount),
+	}
+	details.Directors, details.Writers, details.Cast = apiResp.Credits.people()
+	if kind == "tv" {
+		// Match OMDb's series years: "2008–2013" once ended, "2008–" while running.
+		details.Year = yearOf(apiResp.FirstAirDate) + "–"
+		if apiResp.Status == "Ended" || apiResp.Status == "Canceled" {
+			details.Year += yearOf(apiResp.LastAirDate)
+		}
+		details.Released = apiResp.FirstAirDate
+		if len(apiResp.EpisodeRunTime) > 0 {
+			details.RuntimeMinutes = apiResp.EpisodeRunTime[0]
+		}
+		details.Writers = tmdbNames(apiResp.CreatedBy)
+		details.TotalSeasons = apiResp.NumberOfSeasons
+	}
+	return details, nil
+}
+
+// Season lists the episodes of one season of a series. TMDB season listings carry no IMDb
+// IDs, so EpisodeSummary.ImdbID is left empty; episodes are played by series and number.
+func (s *TMDBService) Season(ctx context.Context, imdbID string, season int) (*SeasonDetails, error) {
+	found, err := s.find(ctx, imdbID)
+	if err != nil {
+		return nil, err
+	}
+	if found.Type != string(TitleTypeSeries) {
+		return nil, ErrTitleNotFound
+	}
+
+	var apiResp struct {
+		Episodes []tmdbEpisode `json:"episodes"`
+	}
+	if err := s.get(ctx, fmt.Sprintf("/tv/%d/season/%d", found.Title.ID, season), nil, &apiResp); err != nil {
+		return nil, err
+	}
+
+	details := &SeasonDetails{
+		ImdbID:   imdbID,
+		Title:    found.Title.displayTitle(),
+		Season:   season,
+		Episodes: make([]EpisodeSummary, 0, len(apiResp.Episodes)),
+	}
+	for _, ep := range apiResp.Episodes {
+		details.Episodes = append(details.Episodes, EpisodeSummary{
+			Episode:  ep.EpisodeNumber,
+			Title:    ep.Name,
+			Released: ep.AirDate,
+		})
+	}
+	return details, nil
+}
+
+// find maps an IMDb ID to the TMDB movie, TV show or episode it identifies.
+func (s *TMDBService) find(ctx context.Context, imdbID string) (*tmdbFound, error) {
+	var apiResp tmdbFindResponse
+	params := url.Values{"external_source": {"imdb_id"}}
+	if err := s.get(ctx, "/find/"+url.PathEscape(imdbID), params, &apiResp); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(apiResp.MovieResults) > 0:
+		return &tmdbFound{Type: string(TitleTypeMovie), Title: apiResp.MovieResults[0]}, nil
+	case len(apiResp.TVResults) > 0:
+		return &tmdbFound{Type: string(TitleTypeSeries), Title: apiResp.TVResults[0]}, nil
+	case len(apiResp.TVEpisodeResults) > 0:
+		return &tmdbFound{Type: string(TitleTypeEpisode), Episode: apiResp.TVEpisodeResults[0]}, nil
+	}
+	return nil, ErrTitleNotFound
+}
+
+// searchResult converts a TMDB movie or TV show into a SearchResult.
+func (s *TMDBService) searchResult(t tmdbTitle, titleType, imdbID string) SearchResult {
+	return SearchResult{
+		Title:    t.displayTitle(),
+		Year:     t.year(),
+		ImdbID:   imdbID,
+		Type:     titleType,
+		Poster:   s.imageURL(tmdbPosterSize, t.PosterPath),
+		Backdrop: s.imageURL(tmdbBackdropSize, t.BackdropPath),
+	}
+}
+
+// imageURL returns the URL of an image at the given size, or "" when there is no image.
+func (s *TMDBService) imageURL(size, path string) string {
+	if path == "" {
+		return ""
+	}
+	return strings.TrimSuffix(s.ImageBaseURL, "/") + "/" + size + path
+}
+
+// get performs a TMDB API request and decodes the JSON response into out. A 404 maps to
+// ErrTitleNotFound.
+func (s *TMDBService) get(ctx context.Context, path string, params url.Values, out any) error {
+	if s.APIKey == "" {
+		return fmt.Errorf("TMDB API key is not configured")
+	}
+
+	reqURL, err := url.Parse(strings.TrimSuffix(s.BaseURL, "/") + path)
+	if err != nil {
+		return fmt.Errorf("failed to parse TMDB URL: %w", err)
+	}
+	if params == nil {
+		params = url.Values{}
+	}
+	// v4 read access tokens are JWTs; v3 keys are plain hex.
+	bearer := strings.Count(s.APIKey, ".") == 2
+	if !bearer {
+		params.Set("api_key", s.APIKey)
+	}
+	reqURL.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer {
+		req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute HTTP request to TMDB: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrTitleNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			StatusMessage string `json:"status_message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return upstreamStatusError("TMDB API", resp, apiErr.StatusMessage)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode TMDB API response: %w", err)
+	}
+	return nil
+}
+
+func (t tmdbTitle) displayTitle() string {
+	if t.Title != "" {
+		return t.Title
+	}
+	return t.Name
+}
+
+func (t tmdbTitle) year() string {
+	if t.ReleaseDate != "" {
+		return yearOf(t.ReleaseDate)
+	}
+	return yearOf(t.FirstAirDate)
+}
+
+// people returns the directors, writers and leading cast from credits.
+func (c tmdbCredits) people() (directors, writers, cast []string) {
+	directors, writers, cast = []string{}, []string{}, []string{}
+	for _, member := range c.Crew {
+		switch {
+		case member.Job == "Director":
+			directors = append(directors, member.Name)
+		case member.Department == "Writing" && !containsFold(writers, member.Name):
+			writers = append(writers, member.Name)
+		}
+	}
+	for _, member := range c.Cast {
+		if len(cast) == tmdbMaxCast {
+			break
+		}
+		cast = append(cast, member.Name)
+	}
+	return directors, writers, cast
+}
+
+// tmdbTitleType maps a TMDB media type to a SearchResult.Type.
+func tmdbTitleType(mediaType string) string {
+	if mediaType == "tv" {
+		return string(TitleTypeSeries)
+	}
+	return string(TitleTypeMovie)
+}
+
+func tmdbNames(list []tmdbNamed) []string {
+	names := make([]string, 0, len(list))
+	for _, n := range list {
+		name := n.EnglishName
+		if name == "" {
+			name = n.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// tmdbRatings reports the TMDB user score in the form OMDb uses for its rating sources.
+func tmdbRatings(average float64, votes int) []TitleRating {
+	if votes == 0 {
+		return []TitleRating{}
+	}
+	return []TitleRating{{Source: "TMDB", Value: strconv.FormatFloat(average, 'f', 1, 64) + "/10"}}
+}
+
+// yearOf returns the year of a YYYY-MM-DD date, or "".
+func yearOf(date string) string {
+	if len(date) < 4 {
+		return ""
+	}
+	return date[:4]
+}
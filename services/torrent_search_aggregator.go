@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"torrent-play/release"
+)
+
+// DefaultTorrentProviderTimeout bounds how long the aggregator waits for a single provider.
+const DefaultTorrentProviderTimeout = 15 * time.Second
+
+// TorrentProvider is a named TorrentSearcher taking part in an aggregated search.
+type TorrentProvider struct {
+	Name     string
+	Searcher TorrentSearcher
+	Timeout  time.Duration // Zero means DefaultTorrentProviderTimeout
+}
+
+// ProviderError records why one provider's part of an aggregated search failed.
+type ProviderError struct {
+	Provider string `json:"provider"`
+	Message  string `json:"error"`
+	Code     string `json:"code,omitempty"` // See UpstreamErrorCode
+	Err      error  `json:"-"`
+}
+
+func (e ProviderError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Provider, e.Message)
+}
+
+func (e ProviderError) Unwrap() error { return e.Err }
+
+// PartialSearchError is returned alongside results when some, but not all, providers failed.
+type PartialSearchError struct {
+	Failures []ProviderError
+}
+
+func (e *PartialSearchError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = f.Error()
+	}
+	return fmt.Sprintf("%d torrent provider(s) failed: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// TorrentSearchAggregator implements TorrentSearcher by querying several providers concurrently
+// and merging their results. Torrents found by more than one provider, identified by infohash,
+// are reported once with the highest seeder count seen.
+//
+// When some providers fail, SearchTorrents returns the merged results of the others together
+// with a *PartialSearchError; it only fails outright when every provider failed.
+type TorrentSearchAggregator struct {
+	Providers []TorrentProvider
+}
+
+// NewTorrentSearchAggregator creates an aggregator over the given providers.
+func NewTorrentSearchAggregator(providers ...TorrentProvider) *TorrentSearchAggregator {
+	return &TorrentSearchAggregator{Providers: providers}
+}
+
+// SearchTorrents fans the query out to every provider and returns the merged, ranked results.
+func (a *TorrentSearchAggregator) SearchTorrents(ctx context.Context, query string, page int, orderBy TorrentSortOrder) ([]TorrentSearchResult, error) {
+	return a.search(ctx, orderBy, func(ctx context.Context, s TorrentSearcher) ([]TorrentSearchResult, error) {
+		return s.SearchTorrents(ctx, query, page, orderBy)
+	})
+}
+
+// SearchTitleTorrents searches every provider for a title, by ID where the provider supports
+// it and by the query's text elsewhere, and returns the merged results best-seeded first.
+func (a *TorrentSearchAggregator) SearchTitleTorrents(ctx context.Context, q TitleTorrentQuery) ([]TorrentSearchResult, error) {
+	return a.search(ctx, SortBySeeders, func(ctx context.Context, s TorrentSearcher) ([]TorrentSearchResult, error) {
+		return searchTitleTorrents(ctx, s, q)
+	})
+}
+
+// search runs search against every provider concurrently and merges the results.
+func (a *TorrentSearchAggregator) search(ctx context.Context, orderBy TorrentSortOrder, search func(context.Context, TorrentSearcher) ([]TorrentSearchResult, error)) ([]TorrentSearchResult, error) {
+	if len(a.Providers) == 0 {
+		return nil, errors.New("no torrent search providers configured")
+	}
+
+	type providerResult struct {
+		results []TorrentSearchResult
+		err     error
+	}
+	out := make([]providerResult, len(a.Providers))
+
+	var wg sync.WaitGroup
+	for i, p := range a.Providers {
+		wg.Add(1)
+		go func(i int, p TorrentProvider) {
+			defer wg.Done()
+			timeout := p.Timeout
+			if timeout <= 0 {
+				timeout = DefaultTorrentProviderTimeout
+			}
+			pctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			results, err := search(pctx, p.Searcher)
+			if err != nil && pctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+				err = fmt.Errorf("timed out after %s: %w", timeout, err)
+			}
+			out[i] = providerResult{results: results, err: err}
+		}(i, p)
+	}
+	wg.Wait()
+
+	var failures []ProviderError
+	var perProvider [][]TorrentSearchResult
+	for i, r := range out {
+		name := a.Providers[i].Name
+		if r.err != nil {
+			log.Printf("Torrent provider %s failed: %v", name, r.err)
+			failures = append(failures, ProviderError{Provider: name, Message: r.err.Error(), Code: UpstreamErrorCode(r.err), Err: r.err})
+			continue
+		}
+		// Copy the results: searchers such as the cache may hand out slices they keep.
+		results := make([]TorrentSearchResult, len(r.results))
+		for j, result := range r.results {
+			result.Providers = []string{name}
+			results[j] = result
+		}
+		perProvider = append(perProvider, results)
+	}
+
+	if len(failures) == len(a.Providers) {
+		errs := make([]error, len(failures))
+		for i, f := range failures {
+			errs[i] = f
+		}
+		return nil, fmt.Errorf("all torrent providers failed: %w", errors.Join(errs...))
+	}
+
+	merged := mergeTorrentResults(perProvider)
+	for i := range merged {
+		info := release.Parse(merged[i].Title)
+		merged[i].Release = &info
+	}
+	rankTorrentResults(merged, orderBy)
+	if len(failures) > 0 {
+		return merged, &PartialSearchError{Failures: failures}
+	}
+	return merged, nil
+}
+
+// mergeTorrentResults combines per-provider result lists, deduplicating by infohash (or by
+// magnet link when the infohash is unknown). The merged entry keeps the details of the copy
+// with the most seeders, fills in details the others lacked and lists every provider.
+func mergeTorrentResults(lists [][]TorrentSearchResult) []TorrentSearchResult {
+	var merged []TorrentSearchResult
+	index := make(map[string]int)
+	for _, list := range lists {
+		for _, r := range list {
+			key := strings.ToLower(r.InfoHash)
+			if key == "" {
+				key = strings.ToLower(r.MagnetURL)
+			}
+			i, seen := index[key]
+			if !seen {
+				index[key] = len(merged)
+				merged = append(merged, r)
+				continue
+			}
+
+			existing := &merged[i]
+			providers := mergeProviders(existing.Providers, r.Providers)
+			if r.Seeders > existing.Seeders {
+				r, *existing = *existing, r // Keep the better-seeded copy's details
+			}
+			existing.Providers = providers
+			if existing.Size == 0 {
+				existing.Size = r.Size
+			}
+			if existing.UploadDate == "" {
+				existing.UploadDate = r.UploadDate
+			}
+			if existing.Uploader == "" {
+				existing.Uploader = r.Uploader
+			}
+		}
+	}
+	return merged
+}
+
+// mergeProviders returns a new slice listing the providers of a and then those of b that
+// a lacks, so a provider returning the same torrent twice is listed once.
+func mergeProviders(a, b []string) []string {
+	merged := make([]string, 0, len(a)+len(b))
+	for _, list := range [][]string{a, b} {
+		for _, name := range list {
+			if !slices.Contains(merged, name) {
+				merged = append(merged, name)
+			}
+		}
+	}
+	return merged
+}
+
+// rankTorrentResults sorts merged results by the requested order, breaking ties by seeders.
+func rankTorrentResults(results []TorrentSearchResult, orderBy TorrentSortOrder) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		switch orderBy {
+		case SortBySize:
+			if a.Size != b.Size {
+				return a.Size > b.Size
+			}
+		case SortByDate:
+			// RFC 3339 UTC timestamps sort chronologically as strings.
+			if a.UploadDate != b.UploadDate {
+				return a.UploadDate > b.UploadDate
+			}
+		}
+		if a.Seeders != b.Seeders {
+			return a.Seeders > b.Seeders
+		}
+		return a.Leechers > b.Leechers
+	})
+}
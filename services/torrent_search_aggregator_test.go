@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSearcher is a TorrentSearcher returning fixed results or an error. A hang searcher
+// blocks until its context is done, like a provider that never answers.
+type fakeSearcher struct {
+	results []TorrentSearchResult
+	err     error
+	hang    bool
+}
+
+func (f fakeSearcher) SearchTorrents(ctx context.Context, query string, page int, orderBy TorrentSortOrder) ([]TorrentSearchResult, error) {
+	if f.hang {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return f.results, f.err
+}
+
+func TestMergeTorrentResults(t *testing.T) {
+	tests := []struct {
+		name  string
+		lists [][]TorrentSearchResult
+		want  []TorrentSearchResult
+	}{
+		{
+			name: "keeps the better-seeded copy and backfills its details",
+			lists: [][]TorrentSearchResult{
+				{{Title: "A", InfoHash: "aa", Seeders: 5, Size: 100, Uploader: "u1", Providers: []string{"p1"}}},
+				{{Title: "A 1080p", InfoHash: "AA", Seeders: 9, UploadDate: "2024-01-01T00:00:00Z", Providers: []string{"p2"}}},
+			},
+			want: []TorrentSearchResult{
+				{Title: "A 1080p", InfoHash: "AA", Seeders: 9, Size: 100, Uploader: "u1", UploadDate: "2024-01-01T00:00:00Z", Providers: []string{"p1", "p2"}},
+			},
+		},
+		{
+			name: "keeps the first copy on a tie",
+			lists: [][]TorrentSearchResult{
+				{{Title: "first", InfoHash: "aa", Seeders: 5, Providers: []string{"p1"}}},
+				{{Title: "second", InfoHash: "aa", Seeders: 5, Size: 7, Providers: []string{"p2"}}},
+			},
+			want: []TorrentSearchResult{
+				{Title: "first", InfoHash: "aa", Seeders: 5, Size: 7, Providers: []string{"p1", "p2"}},
+			},
+		},
+		{
+			name: "lists a provider with duplicate rows once",
+			lists: [][]TorrentSearchResult{
+				{
+					{Title: "A", InfoHash: "aa", Seeders: 1, Providers: []string{"p1"}},
+					{Title: "A", InfoHash: "aa", Seeders: 3, Providers: []string{"p1"}},
+				},
+			},
+			want: []TorrentSearchResult{
+				{Title: "A", InfoHash: "aa", Seeders: 3, Providers: []string{"p1"}},
+			},
+		},
+		{
+			name: "falls back to the magnet link without an infohash",
+			lists: [][]TorrentSearchResult{
+				{{Title: "A", MagnetURL: "magnet:?xt=urn:btih:X", Providers: []string{"p1"}}, {Title: "B", MagnetURL: "magnet:?xt=urn:btih:Y", Providers: []string{"p1"}}},
+				{{Title: "A", MagnetURL: "MAGNET:?XT=URN:BTIH:X", Providers: []string{"p2"}}},
+			},
+			want: []TorrentSearchResult{
+				{Title: "A", MagnetURL: "magnet:?xt=urn:btih:X", Providers: []string{"p1", "p2"}},
+				{Title: "B", MagnetURL: "magnet:?xt=urn:btih:Y", Providers: []string{"p1"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeTorrentResults(tt.lists); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeTorrentResults\n got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeTorrentResultsDoesNotAliasProviders(t *testing.T) {
+	// Spare capacity in the first copy's Providers must not be written into.
+	first := make([]string, 1, 4)
+	first[0] = "p1"
+	lists := [][]TorrentSearchResult{
+		{{InfoHash: "aa", Providers: first}, {InfoHash: "bb", Providers: first}},
+		{{InfoHash: "aa", Providers: []string{"p2"}}, {InfoHash: "bb", Providers: []string{"p3"}}},
+	}
+	merged := mergeTorrentResults(lists)
+	if want := []string{"p1", "p2"}; !reflect.DeepEqual(merged[0].Providers, want) {
+		t.Errorf("first providers = %v, want %v", merged[0].Providers, want)
+	}
+	if want := []string{"p1", "p3"}; !reflect.DeepEqual(merged[1].Providers, want) {
+		t.Errorf("second providers = %v, want %v", merged[1].Providers, want)
+	}
+}
+
+func TestRankTorrentResults(t *testing.T) {
+	results := []TorrentSearchResult{
+		{Title: "small", Seeders: 10, Size: 1, UploadDate: "2024-03-01T00:00:00Z"},
+		{Title: "big", Seeders: 5, Size: 3, UploadDate: "2023-01-01T00:00:00Z"},
+		{Title: "new", Seeders: 5, Leechers: 9, Size: 2, UploadDate: "2024-06-01T00:00:00Z"},
+		{Title: "undated", Seeders: 50, Size: 2},
+	}
+	tests := []struct {
+		orderBy TorrentSortOrder
+		want    string
+	}{
+		{SortBySeeders, "undated small new big"},
+		{SortBySize, "big undated new small"},
+		{SortByDate, "new small big undated"},
+	}
+	for _, tt := range tests {
+		ranked := append([]TorrentSearchResult(nil), results...)
+		rankTorrentResults(ranked, tt.orderBy)
+		var titles []string
+		for _, r := range ranked {
+			titles = append(titles, r.Title)
+		}
+		if got := strings.Join(titles, " "); got != tt.want {
+			t.Errorf("order by %v = %q, want %q", tt.orderBy, got, tt.want)
+		}
+	}
+}
+
+func TestTorrentSearchAggregator(t *testing.T) {
+	site := fakeSearcher{results: []TorrentSearchResult{
+		{Title: "Movie 2020 1080p", InfoHash: "aa", Seeders: 10},
+		{Title: "Movie 2020 720p", InfoHash: "bb", Seeders: 30},
+	}}
+	indexer := fakeSearcher{results: []TorrentSearchResult{
+		{Title: "Movie.2020.1080p.BluRay", InfoHash: "aa", Seeders: 40, Size: 8 << 30},
+	}}
+	failing := fakeSearcher{err: fmt.Errorf("torznab: %w", ErrQuotaExceeded)}
+	slow := fakeSearcher{hang: true}
+
+	t.Run("merges every provider", func(t *testing.T) {
+		a := NewTorrentSearchAggregator(TorrentProvider{Name: "site", Searcher: site}, TorrentProvider{Name: "indexer", Searcher: indexer})
+		got, err := a.SearchTorrents(context.Background(), "movie", 0, SortBySeeders)
+		if err != nil {
+			t.Fatalf("SearchTorrents: %v", err)
+		}
+		if len(got) != 2 || got[0].InfoHash != "aa" || got[0].Seeders != 40 || !reflect.DeepEqual(got[0].Providers, []string{"site", "indexer"}) {
+			t.Fatalf("got %+v, want the 1080p release from both providers first", got)
+		}
+		if got[0].Release == nil || got[0].Release.Resolution != 1080 {
+			t.Errorf("release info = %+v, want it parsed from the title", got[0].Release)
+		}
+		if site.results[0].Providers != nil {
+			t.Errorf("the provider's results were modified: %+v", site.results[0])
+		}
+	})
+
+	t.Run("reports failed and timed out providers", func(t *testing.T) {
+		a := NewTorrentSearchAggregator(
+			TorrentProvider{Name: "site", Searcher: site},
+			TorrentProvider{Name: "torznab", Searcher: failing},
+			TorrentProvider{Name: "slow", Searcher: slow, Timeout: 20 * time.Millisecond},
+		)
+		got, err := a.SearchTorrents(context.Background(), "movie", 0, SortBySeeders)
+		var partial *PartialSearchError
+		if !errors.As(err, &partial) {
+			t.Fatalf("got error %v, want a *PartialSearchError", err)
+		}
+		if len(got) != 2 {
+			t.Errorf("got %d results, want the site's 2", len(got))
+		}
+		if len(partial.Failures) != 2 {
+			t.Fatalf("failures = %+v, want two", partial.Failures)
+		}
+		quota, timeout := partial.Failures[0], partial.Failures[1]
+		if quota.Provider != "torznab" || quota.Code != UpstreamErrorCode(ErrQuotaExceeded) || !errors.Is(quota, ErrQuotaExceeded) {
+			t.Errorf("quota failure = %+v", quota)
+		}
+		if timeout.Provider != "slow" || !strings.Contains(timeout.Message, "timed out after 20ms") || !errors.Is(timeout, context.DeadlineExceeded) {
+			t.Errorf("timeout failure = %+v", timeout)
+		}
+	})
+
+	t.Run("fails when every provider fails", func(t *testing.T) {
+		a := NewTorrentSearchAggregator(
+			TorrentProvider{Name: "torznab", Searcher: failing},
+			TorrentProvider{Name: "slow", Searcher: slow, Timeout: 20 * time.Millisecond},
+		)
+		got, err := a.SearchTorrents(context.Background(), "movie", 0, SortBySeeders)
+		var partial *PartialSearchError
+		if err == nil || errors.As(err, &partial) || got != nil {
+			t.Fatalf("got %v, %v; want a plain error", got, err)
+		}
+		if !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("errors.Is(%v, ErrQuotaExceeded) = false", err)
+		}
+	})
+
+	t.Run("no providers", func(t *testing.T) {
+		if _, err := NewTorrentSearchAggregator().SearchTorrents(context.Background(), "movie", 0, SortBySeeders); err == nil {
+			t.Error("searched without providers")
+		}
+	})
+}
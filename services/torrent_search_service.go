@@ -1,46 +1,135 @@
 package services
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
+	"torrent-play/release"
+
+	"github.com/anacrolix/torrent/metainfo"
 	"golang.org/x/net/html"
 )
 
 // TorrentSearchResult represents a single torrent found from a search.
 type TorrentSearchResult struct {
-	Title     string `json:"title"`
-	MagnetURL string `json:"magnetUrl"`
-	// Future enhancements could include:
-	// Seeders   int    `json:"seeders,omitempty"`
-	// Leechers  int    `json:"leechers,omitempty"`
-	// Size      string `json:"size,omitempty"`
-	// UploadDate string `json:"uploadDate,omitempty"`
+	Title      string `json:"title"`
+	MagnetURL  string `json:"magnetUrl"`
+	InfoHash   string `json:"infoHash,omitempty"` // Lower-case hex, from the magnet link
+	Seeders    int    `json:"seeders"`
+	Leechers   int    `json:"leechers"`
+	Size       int64  `json:"size,omitempty"` // Bytes
+	Uploader   string `json:"uploader,omitempty"`
+	UploadDate string `json:"uploadDate,omitempty"` // RFC 3339, UTC
+	// Providers names the search providers that returned this torrent, when aggregated.
+	Providers []string `json:"providers,omitempty"`
+	// Release is the metadata parsed from Title, when aggregated.
+	Release *release.Info `json:"release,omitempty"`
+}
+
+// releaseInfo returns the parsed release metadata of a result, parsing its title if needed.
+func releaseInfo(r TorrentSearchResult) release.Info {
+	if r.Release != nil {
+		return *r.Release
+	}
+	return release.Parse(r.Title)
+}
+
+// TorrentSortOrder selects how torrent search results are ordered. Every order is descending.
+type TorrentSortOrder string
+
+const (
+	SortBySeeders TorrentSortOrder = "seeders" // Best-seeded first; the default
+	SortBySize    TorrentSortOrder = "size"    // Largest first
+	SortByDate    TorrentSortOrder = "date"    // Most recently uploaded first
+)
+
+// TorrentSortOrders lists the supported sort orders.
+var TorrentSortOrders = []TorrentSortOrder{SortBySeeders, SortBySize, SortByDate}
+
+// ParseTorrentSortOrder parses a sort order name; an empty name selects SortBySeeders.
+func ParseTorrentSortOrder(name string) (TorrentSortOrder, error) {
+	if name == "" {
+		return SortBySeeders, nil
+	}
+	for _, o := range TorrentSortOrders {
+		if strings.EqualFold(name, string(o)) {
+			return o, nil
+		}
+	}
+	return "", fmt.Errorf("unknown sort order %q", name)
 }
 
 // TorrentSearcher defines the interface for a torrent search service.
 type TorrentSearcher interface {
-	SearchTorrents(ctx context.Context, query string, page int, orderBy string) ([]TorrentSearchResult, error)
+	SearchTorrents(ctx context.Context, query string, page int, orderBy TorrentSortOrder) ([]TorrentSearchResult, error)
+}
+
+// TitleTorrentQuery identifies the title a torrent search is for: a movie, a series episode
+// or a whole season.
+type TitleTorrentQuery struct {
+	ImdbID  string // The movie or series
+	Title   string // As in release names, e.g. "Schindlers List"
+	Year    string // Movies only
+	Season  int    // Zero for movies
+	Episode int    // Zero for a whole season
+}
+
+// String returns the free-text query for the title: "Title Year" for movies, "Title S01E02"
+// for episodes and "Title S01" for whole seasons.
+func (q TitleTorrentQuery) String() string {
+	switch {
+	case q.Season > 0 && q.Episode > 0:
+		return fmt.Sprintf("%s S%02dE%02d", q.Title, q.Season, q.Episode)
+	case q.Season > 0:
+		return fmt.Sprintf("%s S%02d", q.Title, q.Season)
+	}
+	return strings.TrimSpace(q.Title + " " + q.Year)
+}
+
+// TitleTorrentSearcher is implemented by TorrentSearchers that can search for a title by ID
+// and episode number rather than by free text, such as Torznab indexers. Callers fall back to
+// SearchTorrents with the query's String when a searcher doesn't implement it.
+type TitleTorrentSearcher interface {
+	SearchTitleTorrents(ctx context.Context, q TitleTorrentQuery) ([]TorrentSearchResult, error)
+}
+
+// searchTitleTorrents searches for a title with s, by ID when s supports it.
+func searchTitleTorrents(ctx context.Context, s TorrentSearcher, q TitleTorrentQuery) ([]TorrentSearchResult, error) {
+	if ts, ok := s.(TitleTorrentSearcher); ok {
+		return ts.SearchTitleTorrents(ctx, q)
+	}
+	return s.SearchTorrents(ctx, q.String(), 0, SortBySeeders)
 }
 
 const (
 	// DefaultBaseURLForTorrentSearch is the default URL for the torrent search site.
-	// This should be configurable in a real application.
+	// Override it with TORRENT_SEARCH_BASE_URL.
 	DefaultBaseURLForTorrentSearch = "https://tpirbay.site/s/" // Example, as per curl
-	defaultTorrentSearchOrderBy    = "99"                      // Common default for seeders desc
 	// defaultTorrentSearchPage       = 0                         // Page is 0-indexed
 )
 
+// tpbOrderByCodes maps sort orders to the site's "orderby" parameter values.
+var tpbOrderByCodes = map[TorrentSortOrder]string{
+	SortBySeeders: "7",
+	SortBySize:    "5",
+	SortByDate:    "3",
+}
+
 // ConcreteTorrentSearchService implements the TorrentSearcher interface.
 type ConcreteTorrentSearchService struct {
-	Client  *http.Client
+	Client  *http.Client // Has a cookie jar, so cookies set by the site are sent back
 	BaseURL string
+	Profile ScraperProfile // Browser headers to send
 }
 
 // NewConcreteTorrentSearchService creates a new instance of ConcreteTorrentSearchService.
@@ -49,21 +138,38 @@ func NewConcreteTorrentSearchService(baseURL string) *ConcreteTorrentSearchServi
 	if baseURL == "" {
 		baseURL = DefaultBaseURLForTorrentSearch
 	}
+	jar, _ := cookiejar.New(nil) // Never fails without options
+	profile, _ := LookupScraperProfile(DefaultScraperProfile)
 	return &ConcreteTorrentSearchService{
 		Client: &http.Client{
 			Timeout: 20 * time.Second, // Reasonalble timeout for external HTTP calls
+			Jar:     jar,
 		},
 		BaseURL: baseURL,
+		Profile: profile,
 	}
 }
 
+// UseProfile switches to the given browser profile and seeds the cookie jar with its cookies.
+func (s *ConcreteTorrentSearchService) UseProfile(p ScraperProfile) error {
+	if err := p.seedCookies(s.Client.Jar, s.BaseURL); err != nil {
+		return err
+	}
+	s.Profile = p
+	return nil
+}
+
 // SearchTorrents fetches torrents from the configured torrent site based on the query.
-func (s *ConcreteTorrentSearchService) SearchTorrents(ctx context.Context, query string, page int, orderBy string) ([]TorrentSearchResult, error) {
+func (s *ConcreteTorrentSearchService) SearchTorrents(ctx context.Context, query string, page int, orderBy TorrentSortOrder) ([]TorrentSearchResult, error) {
 	if query == "" {
 		return nil, fmt.Errorf("search query cannot be empty")
 	}
 	if orderBy == "" {
-		orderBy = defaultTorrentSearchOrderBy
+		orderBy = SortBySeeders
+	}
+	orderCode, ok := tpbOrderByCodes[orderBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort order %q", orderBy)
 	}
 
 	reqURL, err := url.Parse(s.BaseURL)
@@ -74,7 +180,7 @@ func (s *ConcreteTorrentSearchService) SearchTorrents(ctx context.Context, query
 	params := url.Values{}
 	params.Add("q", query)
 	params.Add("page", strconv.Itoa(page))
-	params.Add("orderby", orderBy)
+	params.Add("orderby", orderCode)
 	reqURL.RawQuery = params.Encode()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
@@ -82,31 +188,7 @@ func (s *ConcreteTorrentSearchService) SearchTorrents(ctx context.Context, query
 		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
-	// Set headers based on the provided curl command
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
-	req.Header.Set("Dnt", "1")
-	req.Header.Set("Priority", "u=0, i")
-
-	// Derive Referer from BaseURL (e.g., "https://tpirbay.site/")
-	parsedBaseURL, err := url.Parse(s.BaseURL)
-	if err == nil && parsedBaseURL.Scheme != "" && parsedBaseURL.Host != "" {
-		refererURL := &url.URL{Scheme: parsedBaseURL.Scheme, Host: parsedBaseURL.Host}
-		req.Header.Set("Referer", refererURL.String()+"/")
-	} else {
-		// Fallback or log warning if BaseURL is unusual
-		// For now, we'll proceed without Referer if BaseURL is malformed for this purpose
-	}
-
-	req.Header.Set("Sec-Ch-Ua", `"Not:A-Brand";v="24", "Chromium";v="134"`) // Consider making these configurable
-	req.Header.Set("Sec-Ch-Ua-Mobile", "?0")
-	req.Header.Set("Sec-Ch-Ua-Platform", `"macOS"`) // This is quite specific
-	req.Header.Set("Sec-Fetch-Dest", "document")
-	req.Header.Set("Sec-Fetch-Mode", "navigate")
-	req.Header.Set("Sec-Fetch-Site", "same-origin") // Assumes referer is from the same base domain
-	req.Header.Set("Sec-Fetch-User", "?1")
-	req.Header.Set("Upgrade-Insecure-Requests", "1")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/134.0.0.0 Safari/537.36")
+	s.Profile.apply(req, reqURL)
 
 	resp, err := s.Client.Do(req)
 	if err != nil {
@@ -116,21 +198,30 @@ func (s *ConcreteTorrentSearchService) SearchTorrents(ctx context.Context, query
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body) // Attempt to read body for more context
-		return nil, fmt.Errorf("torrent site request failed with status %s: %s", resp.Status, string(bodyBytes))
+		// Challenge pages usually come with a 403 or 503; report them as blocks, not outages.
+		if doc, err := html.Parse(bytes.NewReader(bodyBytes)); err == nil {
+			if reason := detectBlockPage(doc); reason != "" {
+				return nil, &ScraperBlockedError{Site: reqURL.Host, Reason: reason}
+			}
+		}
+		return nil, upstreamStatusError("torrent site", resp, string(bodyBytes))
 	}
 
-	return s.parseHTMLResults(resp.Body)
+	// now is the reference for relative upload dates such as "Today" or "5 mins ago".
+	return s.parseHTMLResults(resp.Body, time.Now().UTC())
 }
 
 // parseHTMLResults parses the HTML from the reader and extracts torrent information.
 // This parser is specifically tailored for sites like tpirbay.site (table with id="searchResult").
-func (s *ConcreteTorrentSearchService) parseHTMLResults(body io.Reader) ([]TorrentSearchResult, error) {
+// A page without that table that looks like a captcha or block page gives a *ScraperBlockedError.
+func (s *ConcreteTorrentSearchService) parseHTMLResults(body io.Reader, now time.Time) ([]TorrentSearchResult, error) {
 	doc, err := html.Parse(body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse HTML: %w", err)
 	}
 
 	var results []TorrentSearchResult
+	foundTable := false
 	var findTableAndProcessRows func(*html.Node)
 
 	findTableAndProcessRows = func(n *html.Node) {
@@ -143,14 +234,15 @@ func (s *ConcreteTorrentSearchService) parseHTMLResults(body io.Reader) ([]Torre
 				}
 			}
 			if isSearchResultTable {
+				foundTable = true
 				// Found the table, now process its rows (typically within <tbody>)
 				for tbodyNode := n.FirstChild; tbodyNode != nil; tbodyNode = tbodyNode.NextSibling {
 					if tbodyNode.Type == html.ElementNode && tbodyNode.Data == "tbody" {
 						for trNode := tbodyNode.FirstChild; trNode != nil; trNode = trNode.NextSibling {
 							if trNode.Type == html.ElementNode && trNode.Data == "tr" {
-								title, magnetURL := s.extractTorrentDataFromRow(trNode)
-								if title != "" && magnetURL != "" {
-									results = append(results, TorrentSearchResult{Title: title, MagnetURL: magnetURL})
+								result := s.extractTorrentDataFromRow(trNode, now)
+								if result.Title != "" && result.MagnetURL != "" {
+									results = append(results, result)
 								}
 							}
 						}
@@ -166,11 +258,65 @@ func (s *ConcreteTorrentSearchService) parseHTMLResults(body io.Reader) ([]Torre
 	}
 
 	findTableAndProcessRows(doc)
+	if !foundTable {
+		if reason := detectBlockPage(doc); reason != "" {
+			site := s.BaseURL
+			if u, err := url.Parse(s.BaseURL); err == nil && u.Host != "" {
+				site = u.Host
+			}
+			return nil, &ScraperBlockedError{Site: site, Reason: reason}
+		}
+	}
 	return results, nil
 }
 
-// extractTorrentDataFromRow scans a <tr> node for torrent title and magnet link.
-func (s *ConcreteTorrentSearchService) extractTorrentDataFromRow(trNode *html.Node) (title string, magnetURL string) {
+// extractTorrentDataFromRow scans a <tr> node for the torrent's title, magnet link, details
+// and seeder/leecher counts. A row is laid out as:
+//
+//	<td class="vertTh">category</td>
+//	<td><div class="detName"><a class="detLink">title</a></div> <a href="magnet:...">
+//	    <font class="detDesc">Uploaded 03-14&nbsp;2019, Size 1.37&nbsp;GiB, ULed by <a>user</a></font></td>
+//	<td align="right">seeders</td>
+//	<td align="right">leechers</td>
+//
+// Missing or unparsable details are left at their zero values.
+func (s *ConcreteTorrentSearchService) extractTorrentDataFromRow(trNode *html.Node, now time.Time) TorrentSearchResult {
+	title, magnetURL := findTitleAndMagnet(trNode)
+	result := TorrentSearchResult{Title: title, MagnetURL: magnetURL}
+	if magnetURL == "" {
+		return result
+	}
+	result.InfoHash = magnetInfoHash(magnetURL)
+
+	var cells []*html.Node
+	for c := trNode.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "td" {
+			cells = append(cells, c)
+		}
+	}
+	// The last two cells hold the seeder and leecher counts.
+	if len(cells) >= 4 {
+		result.Seeders = parseCount(extractText(cells[len(cells)-2]))
+		result.Leechers = parseCount(extractText(cells[len(cells)-1]))
+	}
+
+	if desc := findElementWithClass(trNode, "font", "detDesc"); desc != nil {
+		result.UploadDate, result.Size, result.Uploader = parseDetDesc(extractText(desc), now)
+	}
+	return result
+}
+
+// magnetInfoHash returns the lower-case hex infohash of a magnet link, or "" if it has none.
+func magnetInfoHash(magnetURL string) string {
+	m, err := metainfo.ParseMagnetUri(magnetURL)
+	if err != nil {
+		return ""
+	}
+	return m.InfoHash.HexString()
+}
+
+// findTitleAndMagnet returns the text of the first detLink and the first magnet link under trNode.
+func findTitleAndMagnet(trNode *html.Node) (title string, magnetURL string) {
 	var findLinks func(*html.Node)
 	findLinks = func(n *html.Node) {
 		if n.Type == html.ElementNode && n.Data == "a" {
@@ -218,6 +364,128 @@ func (s *ConcreteTorrentSearchService) extractTorrentDataFromRow(trNode *html.No
 	return
 }
 
+// findElementWithClass returns the first element named tag under n that has the given class.
+func findElementWithClass(n *html.Node, tag, class string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		for _, attr := range n.Attr {
+			if attr.Key == "class" && slices.Contains(strings.Fields(attr.Val), class) {
+				return n
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElementWithClass(c, tag, class); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// parseCount parses a seeder or leecher count such as "1,234"; anything else counts as 0.
+func parseCount(s string) int {
+	n, err := strconv.Atoi(strings.ReplaceAll(strings.TrimSpace(s), ",", ""))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// parseDetDesc parses a description such as "Uploaded 03-14 2019, Size 1.37 GiB, ULed by someone"
+// into an RFC 3339 upload date, a size in bytes and the uploader's name.
+func parseDetDesc(desc string, now time.Time) (uploadDate string, size int64, uploader string) {
+	// The site separates values with &nbsp;, which the HTML parser turns into U+00A0.
+	desc = strings.ReplaceAll(desc, "\u00a0", " ")
+	for _, part := range strings.Split(desc, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case strings.HasPrefix(part, "Uploaded "):
+			if t, ok := parseUploadDate(strings.TrimPrefix(part, "Uploaded "), now); ok {
+				uploadDate = t.Format(time.RFC3339)
+			}
+		case strings.HasPrefix(part, "Size "):
+			size, _ = parseSize(strings.TrimPrefix(part, "Size "))
+		case strings.HasPrefix(part, "ULed by "):
+			uploader = strings.TrimSpace(strings.TrimPrefix(part, "ULed by "))
+		}
+	}
+	return uploadDate, size, uploader
+}
+
+// sizeUnits maps size suffixes to their multipliers. The site uses binary units; the decimal
+// spellings are accepted with the same meaning, as mirrors label binary sizes either way.
+var sizeUnits = map[string]float64{
+	"B":   1,
+	"KIB": 1 << 10, "KB": 1 << 10,
+	"MIB": 1 << 20, "MB": 1 << 20,
+	"GIB": 1 << 30, "GB": 1 << 30,
+	"TIB": 1 << 40, "TB": 1 << 40,
+}
+
+// parseSize parses a size such as "1.37 GiB" or "500MB" into bytes.
+func parseSize(s string) (int64, bool) {
+	s = strings.TrimSpace(s)
+	number, unitName := s, "B"
+	if i := strings.IndexFunc(s, unicode.IsLetter); i >= 0 {
+		number, unitName = strings.TrimSpace(s[:i]), s[i:]
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return 0, false
+	}
+	unit, ok := sizeUnits[strings.ToUpper(unitName)]
+	if !ok {
+		return 0, false
+	}
+	return int64(value * unit), true
+}
+
+// parseUploadDate parses the site's upload date formats, all in UTC:
+//
+//	"03-14 2019"  month-day year, for uploads before this year
+//	"03-14 12:34" month-day time, for uploads this year
+//	"Today 12:34", "Y-day 12:34"
+//	"5 mins ago"
+func parseUploadDate(s string, now time.Time) (time.Time, bool) {
+	s = strings.Join(strings.Fields(s), " ")
+	if mins, ok := strings.CutSuffix(s, " mins ago"); ok {
+		n, err := strconv.Atoi(mins)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return now.Add(-time.Duration(n) * time.Minute).Truncate(time.Minute), true
+	}
+
+	day, clock, ok := strings.Cut(s, " ")
+	if !ok {
+		return time.Time{}, false
+	}
+	switch day {
+	case "Today", "Y-day":
+		t, err := time.Parse("15:04", clock)
+		if err != nil {
+			return time.Time{}, false
+		}
+		date := now
+		if day == "Y-day" {
+			date = now.AddDate(0, 0, -1)
+		}
+		return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC), true
+	}
+	if t, err := time.Parse("01-02 2006", s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("01-02 15:04", s); err == nil {
+		// The year is left out for uploads within the last year, so a date after now, such
+		// as 12-31 seen in January, is from last year.
+		year := now.Year()
+		if time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC).After(now) {
+			year--
+		}
+		return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC), true
+	}
+	return time.Time{}, false
+}
+
 // extractText recursively extracts all text from an HTML node and its children,
 // skipping script and style contents.
 func extractText(n *html.Node) string {
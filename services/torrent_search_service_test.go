@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testNow is the reference time for relative upload dates in the golden pages.
+var testNow = time.Date(2024, time.June, 10, 12, 0, 0, 0, time.UTC)
+
+func TestParseHTMLResults(t *testing.T) {
+	tests := []struct {
+		page string
+		want []TorrentSearchResult
+	}{
+		{
+			page: "tpb_search.html",
+			want: []TorrentSearchResult{
+				{
+					Title:      "Some Movie 2019 1080p BluRay x264-GRP",
+					MagnetURL:  "magnet:?xt=urn:btih:DD8255ECDC7CA55FB0BBF81323D87062DB1F6D1C&dn=Some+Movie",
+					InfoHash:   "dd8255ecdc7ca55fb0bbf81323d87062db1f6d1c",
+					Seeders:    1234,
+					Leechers:   56,
+					Size:       1471026298,
+					Uploader:   "uploader1",
+					UploadDate: "2019-03-14T00:00:00Z",
+				},
+				{
+					Title:      "Some Movie 2019 720p WEBRip",
+					MagnetURL:  "magnet:?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d53056&dn=Some+Movie+720p",
+					InfoHash:   "c9e15763f722f23e98a29decdfae341b98d53056",
+					Seeders:    98,
+					Leechers:   7,
+					Size:       734003200,
+					Uploader:   "uploader2",
+					UploadDate: "2024-05-02T08:15:00Z",
+				},
+				{
+					Title:      "Some Movie 2019 2160p WEB-DL",
+					MagnetURL:  "magnet:?xt=urn:btih:08ada5a7a6183aae1e09d831df6748d566095a10&dn=Some+Movie+2160p",
+					InfoHash:   "08ada5a7a6183aae1e09d831df6748d566095a10",
+					Seeders:    45,
+					Leechers:   120,
+					Size:       16320875724,
+					Uploader:   "uploader3",
+					UploadDate: "2024-06-10T09:30:00Z",
+				},
+				{
+					Title:      "Some Movie 2019 480p DVDRip",
+					MagnetURL:  "magnet:?xt=urn:btih:a88fda5954e89178c372716a6a78b8180ed4dad3&dn=Some+Movie+480p",
+					InfoHash:   "a88fda5954e89178c372716a6a78b8180ed4dad3",
+					Seeders:    3,
+					Leechers:   0,
+					Size:       367525888,
+					Uploader:   "uploader4",
+					UploadDate: "2024-06-09T23:59:00Z",
+				},
+				{
+					Title:      "Some Movie 2019 CAM",
+					MagnetURL:  "magnet:?xt=urn:btih:209c8226b299b308beaf2b9cd3fb49212dbd13ec&dn=Some+Movie+CAM",
+					InfoHash:   "209c8226b299b308beaf2b9cd3fb49212dbd13ec",
+					Seeders:    0,
+					Leechers:   2,
+					Size:       1181116006,
+					Uploader:   "Anonymous",
+					UploadDate: "2024-06-10T11:55:00Z",
+				},
+				{
+					// No description: the details stay at their zero values.
+					Title:     "Some Movie 2019 No Description",
+					MagnetURL: "magnet:?xt=urn:btih:5e5bb1ac2a4ac7d8a27be1a1b2bd1c6b5d2d6c7e&dn=Some+Movie",
+					InfoHash:  "5e5bb1ac2a4ac7d8a27be1a1b2bd1c6b5d2d6c7e",
+					Seeders:   10,
+					Leechers:  1,
+				},
+				// The row without a magnet link and the pagination row are skipped.
+			},
+		},
+		{page: "tpb_empty.html", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.page, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			s := NewConcreteTorrentSearchService("https://example.org/s/")
+			got, err := s.parseHTMLResults(f, testNow)
+			if err != nil {
+				t.Fatalf("parseHTMLResults: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d results, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range tt.want {
+				if !reflect.DeepEqual(got[i], tt.want[i]) {
+					t.Errorf("result %d\n got %+v\nwant %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseHTMLResultsBlocked(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "tpb_blocked.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s := NewConcreteTorrentSearchService("https://example.org/s/")
+	_, err = s.parseHTMLResults(f, testNow)
+	var blocked *ScraperBlockedError
+	if !errors.As(err, &blocked) || blocked.Site != "example.org" {
+		t.Fatalf("got error %v, want a *ScraperBlockedError for example.org", err)
+	}
+	if !errors.Is(err, ErrScraperBlocked) {
+		t.Errorf("errors.Is(%v, ErrScraperBlocked) = false", err)
+	}
+}
+
+func TestParseDetDesc(t *testing.T) {
+	tests := []struct {
+		desc     string
+		date     string
+		size     int64
+		uploader string
+	}{
+		{"Uploaded 03-14 2019, Size 1.37 GiB, ULed by someone", "2019-03-14T00:00:00Z", 1471026298, "someone"},
+		{"Uploaded 12-31 23:59, Size 4 KiB, ULed by a b", "2023-12-31T23:59:00Z", 4096, "a b"},
+		{"Uploaded 06-10 11:00, Size 4 KiB, ULed by a b", "2024-06-10T11:00:00Z", 4096, "a b"},
+		{"Uploaded 06-10 12:01, Size 4 KiB, ULed by a b", "2023-06-10T12:01:00Z", 4096, "a b"},
+		{"Uploaded Today 00:00, Size 1 TiB, ULed by x", "2024-06-10T00:00:00Z", 1 << 40, "x"},
+		{"Uploaded Y-day 06:07, Size 2 GB, ULed by x", "2024-06-09T06:07:00Z", 2 << 30, "x"},
+		{"Uploaded 1 mins ago, Size 10 B, ULed by x", "2024-06-10T11:59:00Z", 10, "x"},
+		{"Uploaded 90 mins ago, Size 500MB", "2024-06-10T10:30:00Z", 500 << 20, ""},
+		// Unparsable values are left empty.
+		{"Uploaded sometime, Size lots, ULed by x", "", 0, "x"},
+		{"Uploaded Today 25:00, Size -1 GiB", "", 0, ""},
+		{"Uploaded 2 days ago, Size 1 PiB", "", 0, ""},
+		{"", "", 0, ""},
+	}
+	for _, tt := range tests {
+		date, size, uploader := parseDetDesc(tt.desc, testNow)
+		if date != tt.date || size != tt.size || uploader != tt.uploader {
+			t.Errorf("parseDetDesc(%q) = %q, %d, %q; want %q, %d, %q", tt.desc, date, size, uploader, tt.date, tt.size, tt.uploader)
+		}
+	}
+}
+
+func TestParseUploadDateAcrossMidnight(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 3, 0, 0, time.UTC)
+	tests := map[string]string{
+		"Y-day 22:00": "2023-12-31T22:00:00Z",
+		"5 mins ago":  "2023-12-31T23:58:00Z",
+		"12-31 23:59": "2023-12-31T23:59:00Z",
+		"01-01 00:02": "2024-01-01T00:02:00Z",
+	}
+	for s, want := range tests {
+		got, ok := parseUploadDate(s, now)
+		if !ok || got.Format(time.RFC3339) != want {
+			t.Errorf("parseUploadDate(%q) = %v, %v; want %s", s, got, ok, want)
+		}
+	}
+}
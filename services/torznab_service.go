@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TorznabSearchType selects the Torznab search function ("t" parameter).
+type TorznabSearchType string
+
+const (
+	TorznabSearch   TorznabSearchType = "search"   // Free-text search
+	TorznabMovie    TorznabSearchType = "movie"    // Movie search, optionally by IMDb ID
+	TorznabTVSearch TorznabSearchType = "tvsearch" // TV search, optionally by season and episode
+)
+
+// torznabPageSize is the number of results requested per page.
+const torznabPageSize = 50
+
+// TorznabQuery describes a Torznab search. Season and Episode only apply to TorznabTVSearch
+// and are ignored when zero; ImdbID applies to TorznabMovie.
+type TorznabQuery struct {
+	Type    TorznabSearchType
+	Query   string
+	ImdbID  string // e.g. "tt0111161"
+	Season  int
+	Episode int
+	Page    int // 0-indexed
+}
+
+// TorznabService implements TorrentSearcher against a Torznab API, such as the one Jackett
+// or Prowlarr exposes for each indexer (or for all of them at once).
+type TorznabService struct {
+	Client  *http.Client
+	BaseURL string // The API endpoint, e.g. http://jackett:9117/api/v2.0/indexers/all/results/torznab/api
+	APIKey  string
+}
+
+// NewTorznabService creates a new TorznabService for the given API endpoint.
+func NewTorznabService(baseURL, apiKey string) *TorznabService {
+	return &TorznabService{
+		Client: &http.Client{
+			Timeout: 30 * time.Second, // Aggregating indexers answer slower than a single site
+		},
+		BaseURL: baseURL,
+		APIKey:  apiKey,
+	}
+}
+
+// SearchTorrents performs a free-text search. Torznab has no sort parameter, so orderBy is
+// left to the caller (the aggregator ranks merged results).
+func (s *TorznabService) SearchTorrents(ctx context.Context, query string, page int, orderBy TorrentSortOrder) ([]TorrentSearchResult, error) {
+	if query == "" {
+		return nil, fmt.Errorf("search query cannot be empty")
+	}
+	return s.Search(ctx, TorznabQuery{Type: TorznabSearch, Query: query, Page: page})
+}
+
+// SearchTitleTorrents searches movies by IMDb ID and series by season and episode, so that
+// indexers match releases however they're named. The ID is sent alone, since indexers that
+// combine it with a text query drop releases whose names don't match the text; movies without
+// an ID are searched by title and year.
+func (s *TorznabService) SearchTitleTorrents(ctx context.Context, q TitleTorrentQuery) ([]TorrentSearchResult, error) {
+	if q.Season > 0 {
+		return s.Search(ctx, TorznabQuery{Type: TorznabTVSearch, Query: q.Title, Season: q.Season, Episode: q.Episode})
+	}
+	if q.ImdbID != "" {
+		return s.Search(ctx, TorznabQuery{Type: TorznabMovie, ImdbID: q.ImdbID})
+	}
+	return s.Search(ctx, TorznabQuery{Type: TorznabMovie, Query: q.String()})
+}
+
+// Search runs any Torznab search function. Results without a magnet link or infohash are
+// skipped, since streams can only be started from magnets.
+func (s *TorznabService) Search(ctx context.Context, q TorznabQuery) ([]TorrentSearchResult, error) {
+	reqURL, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Torznab URL '%s': %w", s.BaseURL, err)
+	}
+
+	if q.Type == "" {
+		q.Type = TorznabSearch
+	}
+	params := reqURL.Query()
+	params.Set("t", string(q.Type))
+	if s.APIKey != "" {
+		params.Set("apikey", s.APIKey)
+	}
+	if q.Query != "" {
+		params.Set("q", q.Query)
+	}
+	if q.Type == TorznabMovie && q.ImdbID != "" {
+		// The Newznab spec takes the numeric part only: "0111161" for "tt0111161".
+		params.Set("imdbid", strings.TrimPrefix(strings.ToLower(q.ImdbID), "tt"))
+	}
+	if q.Type == TorznabTVSearch {
+		if q.Season > 0 {
+			params.Set("season", strconv.Itoa(q.Season))
+		}
+		if q.Episode > 0 {
+			params.Set("ep", strconv.Itoa(q.Episode))
+		}
+	}
+	params.Set("limit", strconv.Itoa(torznabPageSize))
+	params.Set("offset", strconv.Itoa(q.Page*torznabPageSize))
+	reqURL.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/xml, text/xml")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute Torznab request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Torznab response: %w", err)
+	}
+	// Torznab reports API errors as <error code="..." description="..."/>, sometimes with a 200.
+	var apiErr torznabError
+	if xml.Unmarshal(body, &apiErr) == nil && apiErr.XMLName.Local == "error" {
+		// Codes 500 and 501 are the indexer's request and download limits.
+		if apiErr.Code == "500" || apiErr.Code == "501" {
+			return nil, fmt.Errorf("%w: torznab error %s: %s", ErrQuotaExceeded, apiErr.Code, apiErr.Description)
+		}
+		return nil, fmt.Errorf("torznab error %s: %s", apiErr.Code, apiErr.Description)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, upstreamStatusError("torznab", resp, string(body))
+	}
+
+	return parseTorznabFeed(body)
+}
+
+// torznabError is the error document returned by Torznab APIs.
+type torznabError struct {
+	XMLName     xml.Name
+	Code        string `xml:"code,attr"`
+	Description string `xml:"description,attr"`
+}
+
+// torznabFeed is the subset of a Torznab RSS feed this service reads.
+type torznabFeed struct {
+	Items []torznabItem `xml:"channel>item"`
+}
+
+type torznabItem struct {
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	PubDate   string `xml:"pubDate"`
+	Size      int64  `xml:"size"`
+	Enclosure struct {
+		URL    string `xml:"url,attr"`
+		Length int64  `xml:"length,attr"`
+	} `xml:"enclosure"`
+	// Attrs are the <torznab:attr name="..." value="..."/> elements.
+	Attrs []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"attr"`
+}
+
+// attr returns the value of the named torznab attribute, or "".
+func (it torznabItem) attr(name string) string {
+	for _, a := range it.Attrs {
+		if a.Name == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// parseTorznabFeed converts a Torznab RSS document into search results.
+func parseTorznabFeed(data []byte) ([]TorrentSearchResult, error) {
+	var feed torznabFeed
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		return nil, fmt.Errorf("failed to parse Torznab feed: %w", err)
+	}
+
+	var results []TorrentSearchResult
+	for _, it := range feed.Items {
+		result := TorrentSearchResult{
+			Title:    strings.TrimSpace(it.Title),
+			InfoHash: strings.ToLower(it.attr("infohash")),
+			Seeders:  parseCount(it.attr("seeders")),
+			Size:     it.Size,
+		}
+
+		result.MagnetURL = it.attr("magneturl")
+		if result.MagnetURL == "" {
+			for _, link := range []string{it.Link, it.Enclosure.URL} {
+				if strings.HasPrefix(link, "magnet:") {
+					result.MagnetURL = link
+					break
+				}
+			}
+		}
+		if result.MagnetURL == "" && result.InfoHash != "" {
+			result.MagnetURL = "magnet:?xt=urn:btih:" + result.InfoHash + "&dn=" + url.QueryEscape(result.Title)
+		}
+		if result.MagnetURL == "" || result.Title == "" {
+			continue
+		}
+		if result.InfoHash == "" {
+			result.InfoHash = magnetInfoHash(result.MagnetURL)
+		}
+
+		// "peers" counts seeders and leechers together.
+		if peers := parseCount(it.attr("peers")); peers > result.Seeders {
+			result.Leechers = peers - result.Seeders
+		}
+		if result.Size == 0 {
+			if size, err := strconv.ParseInt(it.attr("size"), 10, 64); err == nil {
+				result.Size = size
+			} else {
+				result.Size = it.Enclosure.Length
+			}
+		}
+		if t, err := time.Parse(time.RFC1123Z, it.PubDate); err == nil {
+			result.UploadDate = t.UTC().Format(time.RFC3339)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTorznab serves the fixture for each Torznab search function and records the queries.
+type fakeTorznab struct {
+	fixtures map[string]string // By the "t" parameter; others give an error document
+	status   int               // Response status; zero means 200
+
+	mu      sync.Mutex
+	queries []url.Values
+}
+
+func (f *fakeTorznab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.queries = append(f.queries, r.URL.Query())
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/rss+xml")
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+	}
+	name, ok := f.fixtures[r.URL.Query().Get("t")]
+	if !ok {
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><error code="202" description="No such function"/>`))
+		return
+	}
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(data)
+}
+
+func newTestTorznab(t *testing.T, fake *fakeTorznab) *TorznabService {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return NewTorznabService(server.URL+"/api/v2.0/indexers/all/results/torznab/api?cat=2000", "secret")
+}
+
+func TestTorznabSearch(t *testing.T) {
+	fake := &fakeTorznab{fixtures: map[string]string{"search": "torznab_movie.xml"}}
+	s := newTestTorznab(t, fake)
+
+	got, err := s.SearchTorrents(context.Background(), "shawshank redemption", 1, SortBySeeders)
+	if err != nil {
+		t.Fatalf("SearchTorrents: %v", err)
+	}
+	want := []TorrentSearchResult{
+		{
+			Title:      "The.Shawshank.Redemption.1994.1080p.BluRay.x264-AMIABLE",
+			MagnetURL:  "magnet:?xt=urn:btih:8AC3731AD4B039C05393B5404AFA6E7397810B41&dn=The.Shawshank.Redemption",
+			InfoHash:   "8ac3731ad4b039c05393b5404afa6e7397810b41",
+			Seeders:    120,
+			Leechers:   15,
+			Size:       10737418240,
+			UploadDate: "2019-06-14T08:20:30Z",
+		},
+		{
+			// A magnet link as the item link; the size from the torznab attribute.
+			Title:     "The Shawshank Redemption (1994) 720p",
+			MagnetURL: "magnet:?xt=urn:btih:0f7d8a5b8c0c9e6e2a6e1d7f1b0c9a8e7d6c5b4a&dn=Shawshank+720p",
+			InfoHash:  "0f7d8a5b8c0c9e6e2a6e1d7f1b0c9a8e7d6c5b4a",
+			Seeders:   7,
+			Size:      1073741824,
+		},
+		{
+			// Only an infohash: the magnet link is built from it.
+			Title:     "The Shawshank Redemption 1994 DVDRip",
+			MagnetURL: "magnet:?xt=urn:btih:1234567890abcdef1234567890abcdef12345678&dn=The+Shawshank+Redemption+1994+DVDRip",
+			InfoHash:  "1234567890abcdef1234567890abcdef12345678",
+			Seeders:   2,
+			Size:      734003200,
+		},
+		// The item with only a .torrent link is skipped.
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SearchTorrents\n got %+v\nwant %+v", got, want)
+	}
+
+	q := fake.queries[0]
+	wantQuery := url.Values{
+		"t": {"search"}, "q": {"shawshank redemption"}, "apikey": {"secret"}, "cat": {"2000"},
+		"limit": {"50"}, "offset": {"50"},
+	}
+	if !reflect.DeepEqual(q, wantQuery) {
+		t.Errorf("query = %v, want %v", q, wantQuery)
+	}
+}
+
+func TestTorznabSearchTitleTorrents(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     TitleTorrentQuery
+		wantQuery url.Values
+		wantTitle string
+	}{
+		{
+			name:      "movie",
+			query:     TitleTorrentQuery{ImdbID: "tt0111161", Title: "The Shawshank Redemption", Year: "1994"},
+			wantQuery: url.Values{"t": {"movie"}, "imdbid": {"0111161"}},
+			wantTitle: "The.Shawshank.Redemption.1994.1080p.BluRay.x264-AMIABLE",
+		},
+		{
+			name:      "movie without an ID",
+			query:     TitleTorrentQuery{Title: "The Shawshank Redemption", Year: "1994"},
+			wantQuery: url.Values{"t": {"movie"}, "q": {"The Shawshank Redemption 1994"}},
+			wantTitle: "The.Shawshank.Redemption.1994.1080p.BluRay.x264-AMIABLE",
+		},
+		{
+			name:      "episode",
+			query:     TitleTorrentQuery{ImdbID: "tt0903747", Title: "Breaking Bad", Season: 1, Episode: 2},
+			wantQuery: url.Values{"t": {"tvsearch"}, "q": {"Breaking Bad"}, "season": {"1"}, "ep": {"2"}},
+			wantTitle: "Breaking.Bad.S01E02.720p.BluRay.x264-DEMAND",
+		},
+		{
+			name:      "season",
+			query:     TitleTorrentQuery{ImdbID: "tt0903747", Title: "Breaking Bad", Season: 3},
+			wantQuery: url.Values{"t": {"tvsearch"}, "q": {"Breaking Bad"}, "season": {"3"}},
+			wantTitle: "Breaking.Bad.S01E02.720p.BluRay.x264-DEMAND",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeTorznab{fixtures: map[string]string{"movie": "torznab_movie.xml", "tvsearch": "torznab_tvsearch.xml"}}
+			s := newTestTorznab(t, fake)
+			got, err := s.SearchTitleTorrents(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("SearchTitleTorrents: %v", err)
+			}
+			if len(got) == 0 || got[0].Title != tt.wantTitle {
+				t.Errorf("SearchTitleTorrents = %+v, want %s first", got, tt.wantTitle)
+			}
+			q := fake.queries[0]
+			for key := range tt.wantQuery {
+				if q.Get(key) != tt.wantQuery.Get(key) {
+					t.Errorf("%s = %q, want %q", key, q.Get(key), tt.wantQuery.Get(key))
+				}
+			}
+			for _, key := range []string{"q", "imdbid", "season", "ep"} {
+				if _, want := tt.wantQuery[key]; !want && q.Has(key) {
+					t.Errorf("unexpected %s=%s", key, q.Get(key))
+				}
+			}
+		})
+	}
+}
+
+func TestTorznabErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fake    *fakeTorznab
+		wantErr error
+	}{
+		{"request limit", &fakeTorznab{fixtures: map[string]string{"search": "torznab_error.xml"}}, ErrQuotaExceeded},
+		{"request limit with a 429", &fakeTorznab{fixtures: map[string]string{"search": "torznab_error.xml"}, status: http.StatusTooManyRequests}, ErrQuotaExceeded},
+		{"unavailable", &fakeTorznab{status: http.StatusServiceUnavailable, fixtures: map[string]string{"search": "torznab_movie.xml"}}, ErrUpstreamUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestTorznab(t, tt.fake)
+			if _, err := s.SearchTorrents(context.Background(), "x", 0, SortBySeeders); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Other error documents are reported with their description.
+	s := newTestTorznab(t, &fakeTorznab{})
+	if _, err := s.SearchTorrents(context.Background(), "x", 0, SortBySeeders); err == nil || err.Error() != "torznab error 202: No such function" {
+		t.Errorf("got %v, want the torznab error", err)
+	}
+}
+
+// textOnlySearcher is a TorrentSearcher without ID search that records its queries.
+type textOnlySearcher struct {
+	results []TorrentSearchResult
+	queries []string
+}
+
+func (s *textOnlySearcher) SearchTorrents(ctx context.Context, query string, page int, orderBy TorrentSortOrder) ([]TorrentSearchResult, error) {
+	s.queries = append(s.queries, query)
+	return s.results, nil
+}
+
+// fixedTitles is an ImdbSearcher that knows a single title.
+type fixedTitles struct{ title SearchResult }
+
+func (f fixedTitles) Search(ctx context.Context, query SearchQuery) (*SearchPage, error) {
+	return nil, ErrUnsupportedQuery
+}
+
+func (f fixedTitles) LookupByID(ctx context.Context, imdbID string) (*SearchResult, error) {
+	if imdbID != f.title.ImdbID {
+		return nil, ErrTitleNotFound
+	}
+	result := f.title
+	return &result, nil
+}
+
+func (f fixedTitles) Details(ctx context.Context, imdbID string) (*TitleDetails, error) {
+	return nil, ErrTitleNotFound
+}
+
+func (f fixedTitles) Season(ctx context.Context, imdbID string, season int) (*SeasonDetails, error) {
+	return nil, ErrTitleNotFound
+}
+
+func TestPlayResolverSearchesTorznabByEpisode(t *testing.T) {
+	fake := &fakeTorznab{fixtures: map[string]string{"tvsearch": "torznab_tvsearch.xml"}}
+	site := &textOnlySearcher{results: []TorrentSearchResult{{
+		Title:     "Breaking Bad S01E02 1080p WEB",
+		MagnetURL: "magnet:?xt=urn:btih:dd8255ecdc7ca55fb0bbf81323d87062db1f6d1c",
+		InfoHash:  "dd8255ecdc7ca55fb0bbf81323d87062db1f6d1c",
+		Seeders:   5,
+	}}}
+	aggregator := NewTorrentSearchAggregator(
+		TorrentProvider{Name: "torznab", Searcher: newTestTorznab(t, fake)},
+		TorrentProvider{Name: "site", Searcher: site},
+	)
+	torrents := NewCachingTorrentSearcher(aggregator, time.Minute, "")
+	titles := fixedTitles{SearchResult{Title: "Breaking Bad", Year: "2008–2013", ImdbID: "tt0903747", Type: "series"}}
+	resolver := NewPlayResolver(titles, torrents, DefaultPlayPreferences)
+
+	_, candidates, err := resolver.Resolve(context.Background(), "tt0903747", 1, 2)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("got %d candidates, want one from each provider: %+v", len(candidates), candidates)
+	}
+	if q := fake.queries[0]; q.Get("t") != "tvsearch" || q.Get("season") != "1" || q.Get("ep") != "2" {
+		t.Errorf("torznab query = %v, want a tvsearch for season 1 episode 2", q)
+	}
+	if want := []string{"Breaking Bad S01E02"}; !reflect.DeepEqual(site.queries, want) {
+		t.Errorf("site queries = %q, want %q", site.queries, want)
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SegmentType is the container used for HLS media segments.
+type SegmentType string
+
+const (
+	SegmentMPEGTS SegmentType = "mpegts" // .ts segments, playable everywhere but limited to H.264 in practice
+	SegmentFMP4   SegmentType = "fmp4"   // CMAF .m4s segments with an init.mp4, required for HEVC/AV1 in HLS
+)
+
+// TranscodeProfile describes how a stream's video is encoded and packaged.
+type TranscodeProfile struct {
+	Name        string      `json:"name"`
+	SegmentType SegmentType `json:"segmentType"`
+	// VideoEncoder is the ffmpeg encoder used whenever the source can't be copied as-is.
+	VideoEncoder string `json:"videoEncoder"`
+	// PassthroughCodecs lists source video codecs (ffprobe names) that are copied without
+	// re-encoding. Only honoured when nothing has to be drawn onto the video.
+	PassthroughCodecs []string `json:"passthroughCodecs,omitempty"`
+}
+
+// DefaultTranscodeProfile is used when a stream doesn't ask for a profile.
+const DefaultTranscodeProfile = "ts"
+
+// transcodeProfiles are the built-in profiles, selectable per stream by name.
+var transcodeProfiles = map[string]TranscodeProfile{
+	// Re-encode everything to H.264 in MPEG-TS: the original behaviour, for any HLS client.
+	"ts": {Name: "ts", SegmentType: SegmentMPEGTS, VideoEncoder: "libx264"},
+	// CMAF packaging of H.264; H.264 sources are copied rather than re-encoded.
+	"cmaf": {Name: "cmaf", SegmentType: SegmentFMP4, VideoEncoder: "libx264", PassthroughCodecs: []string{"h264"}},
+	// CMAF packaging that also passes HEVC and AV1 through, for clients that can decode them.
+	"hevc": {Name: "hevc", SegmentType: SegmentFMP4, VideoEncoder: "libx264", PassthroughCodecs: []string{"h264", "hevc", "av1"}},
+}
+
+// LookupTranscodeProfile returns the named profile; an empty name selects the default profile.
+func LookupTranscodeProfile(name string) (TranscodeProfile, bool) {
+	if name == "" {
+		name = DefaultTranscodeProfile
+	}
+	p, ok := transcodeProfiles[strings.ToLower(name)]
+	return p, ok
+}
+
+// TranscodeProfileNames returns the names of all built-in profiles, sorted.
+func TranscodeProfileNames() []string {
+	names := make([]string, 0, len(transcodeProfiles))
+	for name := range transcodeProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// canPassthrough reports whether video in sourceCodec can be copied into this profile's segments.
+func (p TranscodeProfile) canPassthrough(sourceCodec string) bool {
+	for _, c := range p.PassthroughCodecs {
+		if c == sourceCodec {
+			return true
+		}
+	}
+	return false
+}
+
+// videoCodecArgs returns the ffmpeg options encoding (or copying) the mapped video stream.
+func (p TranscodeProfile) videoCodecArgs(sourceCodec string, filtered bool) []string {
+	if filtered || !p.canPassthrough(sourceCodec) {
+		return []string{"-c:v", p.VideoEncoder}
+	}
+	args := []string{"-c:v", "copy"}
+	if sourceCodec == "hevc" {
+		// Apple players only accept HEVC in fMP4 when tagged hvc1 rather than hev1.
+		args = append(args, "-tag:v", "hvc1")
+	}
+	return args
+}
+
+// segmentExt returns the file extension of this profile's media segments.
+func (p TranscodeProfile) segmentExt() string {
+	if p.SegmentType == SegmentFMP4 {
+		return ".m4s"
+	}
+	return ".ts"
+}
+
+// hlsOutputArgs returns the ffmpeg hls muxer options writing segments named
+// <segmentPrefix>NNN<ext> next to playlistPath, followed by playlistPath itself.
+// For fMP4, initName is the init segment, also written next to the playlist.
+func (p TranscodeProfile) hlsOutputArgs(playlistPath, segmentPrefix, initName string, segmenting hlsSegmenting) []string {
+	dir := filepath.Dir(playlistPath)
+	args := []string{
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(segmenting.SegmentSeconds),
+		"-hls_list_size", "0", // Keep all segments in the playlist
+	}
+	if segmenting.PlaylistType != "" {
+		args = append(args, "-hls_playlist_type", segmenting.PlaylistType)
+	}
+	if p.SegmentType == SegmentFMP4 {
+		args = append(args,
+			"-hls_segment_type", "fmp4",
+			"-hls_fmp4_init_filename", initName,
+		)
+	}
+	return append(args,
+		"-hls_segment_filename", filepath.Join(dir, segmentPrefix+"%03d"+p.segmentExt()),
+		playlistPath,
+	)
+}
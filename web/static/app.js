@@ -0,0 +1,393 @@
+'use strict';
+
+// Library UI for the torrent-play server. Everything talks to the JSON endpoints served
+// by the same mux: /search, /titles, /torrents/search, /play, /add, /streams and the HLS URLs they return.
+
+const POLL_INTERVAL_MS = 2000;
+
+const $ = (id) => document.getElementById(id);
+
+let hls = null;          // Active hls.js instance, if the browser lacks native HLS
+let playingStream = null; // ID of the stream in the player
+let waitingFor = null;   // ID of a stream to play as soon as it becomes playable
+let titlePage = 1;       // Current page of title results (1-indexed, like /search)
+let torrentPage = 0;     // Current page of torrent results
+
+async function getJSON(url, options) {
+  const resp = await fetch(url, options);
+  if (!resp.ok) {
+    let text = (await resp.text()).trim();
+    if (resp.headers.get('Content-Type') === 'application/json') {
+      try {
+        text = JSON.parse(text).error; // Provider errors: { error, code }
+      } catch {
+        // Keep the raw text
+      }
+    }
+    throw new Error(text || `${resp.status} ${resp.statusText}`);
+  }
+  return resp.json();
+}
+
+function formatBytes(n) {
+  if (!n) return '';
+  const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return `${n.toFixed(i ? 1 : 0)} ${units[i]}`;
+}
+
+// releaseSummary describes parsed release metadata, e.g. "1080p BluRay x265 HDR10".
+function releaseSummary(release) {
+  if (!release) return '';
+  return [
+    release.resolution && `${release.resolution}p`,
+    release.source,
+    release.remux && 'Remux',
+    release.codec,
+    ...(release.hdr || []),
+    release.audio,
+  ].filter(Boolean).join(' ');
+}
+
+// --- Player ---
+
+function play(stream) {
+  const video = $('player');
+  stopPlayer();
+  playingStream = stream.id;
+  $('player-section').hidden = false;
+  $('player-title').textContent = stream.fileName || stream.id;
+  $('player-message').textContent = '';
+  if (stream.posterUrl) video.poster = stream.posterUrl;
+
+  if (video.canPlayType('application/vnd.apple.mpegurl')) {
+    video.src = stream.hlsUrl;
+  } else if (window.Hls && window.Hls.isSupported()) {
+    hls = new window.Hls();
+    hls.on(window.Hls.Events.ERROR, (_event, data) => {
+      if (data.fatal) $('player-message').textContent = `Playback error: ${data.details}`;
+    });
+    hls.loadSource(stream.hlsUrl);
+    hls.attachMedia(video);
+  } else {
+    $('player-message').textContent = 'This browser cannot play HLS. Open the HLS link in an external player.';
+    return;
+  }
+  video.play().catch(() => { /* Autoplay may be blocked; the controls still work. */ });
+  $('player-section').scrollIntoView({ behavior: 'smooth' });
+}
+
+function stopPlayer() {
+  const video = $('player');
+  if (hls) {
+    hls.destroy();
+    hls = null;
+  }
+  video.pause();
+  video.removeAttribute('src');
+  video.removeAttribute('poster');
+  video.load();
+  playingStream = null;
+}
+
+// --- Streams ---
+
+function renderStreams(streams) {
+  const list = $('streams');
+  const template = $('stream-template');
+  $('streams-empty').hidden = streams.length > 0;
+  list.replaceChildren(...streams.map((stream) => {
+    const item = template.content.firstElementChild.cloneNode(true);
+    const poster = item.querySelector('.poster');
+    if (stream.posterUrl) {
+      poster.src = stream.posterUrl;
+    } else {
+      poster.hidden = true;
+    }
+    item.querySelector('.stream-name').textContent = stream.fileName || stream.id;
+
+    const meta = [stream.state.replace('_', ' ')];
+    if (stream.fileSize) {
+      meta.push(`${formatBytes(stream.bytesCompleted)} of ${formatBytes(stream.fileSize)}`);
+    }
+    if (releaseSummary(stream.release)) meta.push(releaseSummary(stream.release));
+    meta.push(stream.profile + (stream.fastStart ? (stream.fastStartIgnored ? ', fast start (no effect: video copied)' : ', fast start') : ''));
+    if (stream.timeToFirstSegmentMs) {
+      meta.push(`first segment after ${(stream.timeToFirstSegmentMs / 1000).toFixed(1)}s`);
+    }
+    if (stream.error) meta.push(stream.error);
+    item.querySelector('.stream-meta').textContent = meta.join(' · ');
+    item.querySelector('progress').value = stream.progress || 0;
+
+    const button = item.querySelector('.play');
+    button.disabled = !stream.playable;
+    button.textContent = stream.playable ? 'Play' : 'Preparing…';
+    button.addEventListener('click', () => play(stream));
+    item.querySelector('.hls-link').href = stream.hlsUrl;
+    if (stream.dashUrl) {
+      const dash = item.querySelector('.dash-link');
+      dash.href = stream.dashUrl;
+      dash.hidden = false;
+    }
+    return item;
+  }));
+}
+
+async function refreshStreams() {
+  try {
+    const streams = await getJSON('/streams');
+    renderStreams(streams);
+    if (waitingFor) {
+      const stream = streams.find((s) => s.id === waitingFor);
+      if (stream && stream.playable) {
+        waitingFor = null;
+        $('add-message').textContent = '';
+        play(stream);
+      } else if (stream && stream.state === 'error') {
+        waitingFor = null;
+        $('add-message').textContent = `Stream failed: ${stream.error}`;
+      }
+    }
+  } catch (err) {
+    console.warn('Could not refresh streams:', err);
+  }
+}
+
+// --- Adding magnets ---
+
+async function addMagnet(magnet) {
+  const params = new URLSearchParams({ magnet, profile: $('profile').value });
+  if ($('audio').value) params.set('audio', $('audio').value);
+  if ($('burn').value) params.set('burn', $('burn').value);
+  if ($('fast').checked) params.set('fast', '1');
+
+  $('add-message').textContent = 'Adding…';
+  try {
+    const added = await getJSON(`/add?${params}`);
+    waitingFor = added.streamId;
+    $('add-message').textContent = 'Waiting for the first segment…';
+    refreshStreams();
+  } catch (err) {
+    $('add-message').textContent = err.message;
+  }
+}
+
+// --- Play by IMDb ID ---
+
+// playTitle resolves a title (or one episode of it) to its best torrent and starts streaming,
+// reporting progress in the given message element.
+async function playTitle(title, messageId, season, episode) {
+  const params = new URLSearchParams({ imdbId: title.imdbId, profile: $('profile').value });
+  if (season) params.set('season', String(season));
+  if (episode) params.set('episode', String(episode));
+  if ($('audio').value) params.set('audio', $('audio').value);
+  if ($('fast').checked) params.set('fast', '1');
+
+  $(messageId).textContent = `Finding the best torrent for ${title.title}…`;
+  try {
+    const started = await getJSON(`/play?${params}`, { method: 'POST' });
+    waitingFor = started.streamId;
+    $(messageId).textContent = `Playing ${started.chosen.title}; waiting for the first segment…`;
+    refreshStreams();
+  } catch (err) {
+    $(messageId).textContent = err.message;
+  }
+}
+
+// --- Title details ---
+
+let shownTitle = null; // Title in the detail section
+
+function findTorrentsFor(title) {
+  $('torrent-query').value = [title.title, title.year].filter(Boolean).join(' ');
+  searchTorrents(0);
+  $('torrents-section').scrollIntoView({ behavior: 'smooth' });
+}
+
+async function showTitle(title) {
+  shownTitle = title;
+  $('title-section').hidden = false;
+  $('title-heading').textContent = title.title;
+  $('title-facts').textContent = 'Loading…';
+  $('title-plot').textContent = '';
+  $('title-people').textContent = '';
+  $('title-message').textContent = '';
+  $('title-play').hidden = title.type !== 'movie';
+  $('title-seasons').hidden = true;
+  $('title-backdrop').hidden = true;
+  $('title-poster').hidden = !title.poster || title.poster === 'N/A';
+  if (!$('title-poster').hidden) $('title-poster').src = title.poster;
+  $('title-section').scrollIntoView({ behavior: 'smooth' });
+
+  try {
+    const details = await getJSON(`/titles/${encodeURIComponent(title.imdbId)}`);
+    if (shownTitle !== title) return; // Another title was picked meanwhile
+    const facts = [details.year, details.rated, details.genres.join(', ')];
+    if (details.runtimeMinutes) facts.push(`${details.runtimeMinutes} min`);
+    facts.push(...details.ratings.map((r) => `${r.source}: ${r.value}`));
+    $('title-facts').textContent = facts.filter(Boolean).join(' · ');
+    $('title-plot').textContent = details.plot || '';
+    if (details.backdrop) {
+      $('title-backdrop').src = details.backdrop;
+      $('title-backdrop').hidden = false;
+    }
+    const people = [];
+    if (details.directors.length) people.push(`Directed by ${details.directors.join(', ')}`);
+    if (details.cast.length) people.push(`With ${details.cast.join(', ')}`);
+    $('title-people').textContent = people.join(' · ');
+
+    if (details.totalSeasons > 0) {
+      const select = $('season-select');
+      select.replaceChildren(...Array.from({ length: details.totalSeasons }, (_, i) => new Option(`Season ${i + 1}`, String(i + 1))));
+      $('title-seasons').hidden = false;
+      showSeason(title, 1);
+    }
+  } catch (err) {
+    $('title-facts').textContent = err.message;
+  }
+}
+
+async function showSeason(title, season) {
+  $('episodes').replaceChildren();
+  try {
+    const details = await getJSON(`/titles/${encodeURIComponent(title.imdbId)}/seasons/${season}`);
+    if (shownTitle !== title) return;
+    const template = $('episode-template');
+    $('episodes').replaceChildren(...details.episodes.map((episode) => {
+      const item = template.content.firstElementChild.cloneNode(true);
+      item.querySelector('.episode-name').textContent = `${episode.episode}. ${episode.title}`;
+      item.querySelector('.episode-meta').textContent = [episode.released, episode.imdbRating && `IMDb ${episode.imdbRating}`].filter(Boolean).join(' · ');
+      item.querySelector('.play').addEventListener('click', () => playTitle(title, 'title-message', season, episode.episode));
+      return item;
+    }));
+  } catch (err) {
+    $('title-message').textContent = err.message;
+  }
+}
+
+// --- Title search ---
+
+async function searchTitles(page) {
+  titlePage = page;
+  const params = new URLSearchParams({ q: $('query').value.trim(), page: String(page) });
+  if ($('title-type').value) params.set('type', $('title-type').value);
+  if ($('title-year').value.trim()) params.set('year', $('title-year').value.trim());
+  $('search-message').textContent = 'Searching…';
+  $('titles').replaceChildren();
+  $('title-prev').hidden = true;
+  $('title-next').hidden = true;
+  try {
+    const { results: titles, totalResults, nextPage } = await getJSON(`/search?${params}`);
+    $('search-message').textContent = titles.length ? `${totalResults} titles found.` : 'No titles found.';
+    $('title-prev').hidden = page <= 1;
+    $('title-next').hidden = !nextPage;
+    const template = $('title-template');
+    $('titles').replaceChildren(...titles.map((title) => {
+      const item = template.content.firstElementChild.cloneNode(true);
+      const poster = item.querySelector('.poster');
+      if (title.poster && title.poster !== 'N/A') {
+        poster.src = title.poster;
+      } else {
+        poster.hidden = true;
+      }
+      item.querySelector('.title-name').textContent = title.title;
+      item.querySelector('.title-meta').textContent = [title.year, title.type].filter(Boolean).join(' · ');
+      if (title.type === 'movie') {
+        const playBest = item.querySelector('.play-best');
+        playBest.hidden = false;
+        playBest.addEventListener('click', (event) => {
+          event.stopPropagation(); // Don't also open the details
+          playTitle(title, 'search-message');
+        });
+      }
+      item.addEventListener('click', () => showTitle(title));
+      return item;
+    }));
+  } catch (err) {
+    $('search-message').textContent = err.message;
+  }
+}
+
+// --- Torrent search ---
+
+async function searchTorrents(page) {
+  torrentPage = page;
+  const params = new URLSearchParams({
+    q: $('torrent-query').value.trim(),
+    page: String(page),
+    orderBy: $('order-by').value,
+  });
+  $('torrent-message').textContent = 'Searching…';
+  $('torrents').replaceChildren();
+  $('torrent-prev').hidden = true;
+  $('torrent-next').hidden = true;
+  try {
+    const { results: torrents, errors } = await getJSON(`/torrents/search?${params}`);
+    const notes = errors.map((e) => `${e.provider} ${e.code === 'quota_exceeded' ? 'over quota' : 'unavailable'}`);
+    if (!torrents.length) notes.unshift('No torrents found.');
+    $('torrent-message').textContent = notes.join(' · ');
+    const template = $('torrent-template');
+    $('torrents').replaceChildren(...torrents.map((torrent) => {
+      const item = template.content.firstElementChild.cloneNode(true);
+      item.querySelector('.torrent-name').textContent = torrent.title;
+      const meta = [`${torrent.seeders} seeders`, `${torrent.leechers} leechers`];
+      if (releaseSummary(torrent.release)) meta.push(releaseSummary(torrent.release));
+      if (torrent.size) meta.push(formatBytes(torrent.size));
+      if (torrent.uploadDate) meta.push(torrent.uploadDate.slice(0, 10));
+      if (torrent.uploader) meta.push(`by ${torrent.uploader}`);
+      if (torrent.providers && torrent.providers.length > 1) meta.push(`via ${torrent.providers.join(', ')}`);
+      item.querySelector('.torrent-meta').textContent = meta.join(' · ');
+      item.querySelector('.play').addEventListener('click', () => {
+        $('magnet').value = torrent.magnetUrl;
+        addMagnet(torrent.magnetUrl);
+        window.scrollTo({ top: 0, behavior: 'smooth' });
+      });
+      return item;
+    }));
+    $('torrent-prev').hidden = page === 0;
+    $('torrent-next').hidden = torrents.length === 0;
+  } catch (err) {
+    $('torrent-message').textContent = err.message;
+  }
+}
+
+// --- Wiring ---
+
+$('add-form').addEventListener('submit', (event) => {
+  event.preventDefault();
+  addMagnet($('magnet').value.trim());
+});
+
+$('search-form').addEventListener('submit', (event) => {
+  event.preventDefault();
+  searchTitles(1);
+});
+$('title-prev').addEventListener('click', () => searchTitles(titlePage - 1));
+$('title-next').addEventListener('click', () => searchTitles(titlePage + 1));
+
+$('torrent-form').addEventListener('submit', (event) => {
+  event.preventDefault();
+  searchTorrents(0);
+});
+$('torrent-prev').addEventListener('click', () => searchTorrents(torrentPage - 1));
+$('torrent-next').addEventListener('click', () => searchTorrents(torrentPage + 1));
+
+$('title-close').addEventListener('click', () => {
+  shownTitle = null;
+  $('title-section').hidden = true;
+});
+$('title-play').addEventListener('click', () => playTitle(shownTitle, 'title-message'));
+$('title-torrents').addEventListener('click', () => findTorrentsFor(shownTitle));
+$('season-select').addEventListener('change', (event) => showSeason(shownTitle, Number(event.target.value)));
+
+$('player-close').addEventListener('click', () => {
+  stopPlayer();
+  $('player-section').hidden = true;
+});
+
+refreshStreams();
+setInterval(refreshStreams, POLL_INTERVAL_MS);
@@ -0,0 +1,25 @@
+// Package web embeds the browser UI: a small library page that searches titles, adds
+// magnet links, shows stream progress and plays streams with hls.js.
+//
+// The page loads hls.js (release 1.5.20) from static/hls.min.js, embedded with the rest of
+// the UI, rather than from a CDN.
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+// Handler serves the embedded UI. It is meant to be mounted at "/" on the server's mux,
+// where it only answers paths that match an embedded file; everything else is a 404.
+func Handler() http.Handler {
+	static, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		panic(err) // The embedded directory is fixed at build time
+	}
+	return http.FileServer(http.FS(static))
+}